@@ -2,12 +2,18 @@ package main
 
 import (
 	"ddns-watchdog/internal/client"
+	"ddns-watchdog/internal/common"
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	flag "github.com/spf13/pflag"
@@ -24,11 +30,38 @@ var (
 		"1 -> "+client.DNSPodConfFilename+"\n"+
 		"2 -> "+client.AliDNSConfFilename+"\n"+
 		"3 -> "+client.CloudflareConfFilename+"\n"+
-		"4 -> "+client.HuaweiCloudConfFilename)
+		"4 -> "+client.HuaweiCloudConfFilename+"\n"+
+		"5 -> "+client.VolcengineConfFilename+"\n"+
+		"6 -> "+client.BaiduCloudConfFilename+"\n"+
+		"7 -> "+client.JDCloudConfFilename)
 	printNetworkCardInfo = flag.BoolP("network-card", "n", false, "输出网卡信息并退出")
 )
 
+const (
+	// shutdownGrace 收到退出信号后等待正在进行的更新完成的时间，超时后取消未完成的请求
+	shutdownGrace = 15 * time.Second
+	// cancelWait 取消后等待更新流程返回的时间，SDK 的请求无法取消
+	cancelWait = 5 * time.Second
+)
+
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		var sub func([]string) error
+		switch os.Args[1] {
+		case "history":
+			sub = history
+		case "validate":
+			sub = validate
+		}
+		if sub != nil {
+			if err := sub(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	// 处理 flag
 	exit, err := processFlag()
 	if err != nil {
@@ -38,23 +71,169 @@ func main() {
 		return
 	}
 
+	// 设置日志级别和格式
+	if err = common.SetupLog(client.Client.Log); err != nil {
+		log.Fatal(err)
+	}
+
 	// 加载服务配置
 	if err = loadConf(); err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+	client.SetupNotifier()
+	if err = client.SetupHistory(); err != nil {
+		fatal(err)
+	}
+	client.PublishConf()
+
+	// 收到 SIGINT 或 SIGTERM 时等待正在进行的更新完成后退出
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	plan, err := client.NewPlan(client.Client, time.Now())
+	if err != nil {
+		fatal(err)
 	}
 
 	// 一次性
-	if client.Client.CheckCycleMinutes <= 0 {
-		check()
+	if !client.Client.Periodic() {
+		runCheck(stop, plan.All(), false)
 		return
 	}
 
-	// 周期循环
-	cycle := time.NewTicker(time.Duration(client.Client.CheckCycleMinutes) * time.Minute)
+	// 提供 Prometheus 指标
+	if client.Client.MetricsAddr != "" {
+		if err = client.ServeMetrics(client.Client.MetricsAddr); err != nil {
+			fatal(err)
+		}
+	}
+
+	// 提供本地 API
+	if client.Client.API.Addr != "" {
+		if err = client.ServeAPI(); err != nil {
+			fatal(err)
+		}
+	}
+
+	// 提供网页管理
+	if client.Client.Web.Addr != "" {
+		if err = client.ServeWeb(); err != nil {
+			fatal(err)
+		}
+	}
+
+	// 周期循环，监听到网络变化时立即检查
+	var events <-chan struct{}
+	if client.Client.WatchNetwork {
+		if events, err = client.WatchNetwork(); err != nil {
+			slog.Warn("无法监听网络变化，仅按计划检查", "error", err)
+		}
+	}
+	// 收到 SIGHUP 或配置文件变化时重新加载配置
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var changed <-chan struct{}
+	if client.Client.WatchConf {
+		changed = common.WatchFiles(client.ConfFiles(), common.ConfWatchInterval)
+	}
+
+	// 启动时同步全部服务，之后按计划同步到期的服务
+	due, force := plan.All(), false
 	for {
-		check()
-		<-cycle.C
+		switch {
+		case len(due) == 0:
+		case client.Paused():
+			slog.Info("更新已暂停，跳过本次检查")
+		case runCheck(stop, due, force):
+			return
+		}
+		client.SetNextRun(plan.Next())
+		timer := time.NewTimer(time.Until(plan.Next()))
+		select {
+		case sig := <-stop:
+			slog.Info("已退出", "signal", sig.String())
+			return
+		case now := <-timer.C:
+			due, force = plan.Fire(now)
+		case _, ok := <-events:
+			if !ok {
+				// 监听意外停止，退回只按计划检查
+				events = nil
+			}
+			due, force = plan.Default(), false
+		case <-hup:
+			plan, due, _ = reload(plan)
+			force = false
+		case <-changed:
+			plan, due, _ = reload(plan)
+			force = false
+		case req := <-client.APIRequests():
+			if req.IsReload() {
+				// 网页修改配置后重新加载，失败时由网页恢复原来的配置文件
+				var err error
+				plan, due, err = reload(plan)
+				req.Reply(err)
+				force = false
+			} else {
+				due, force = req.Accept(plan)
+			}
+		}
+		timer.Stop()
+	}
+}
+
+// runCheck 在后台检查，期间收到退出信号时给正在进行的更新 shutdownGrace 的时间完成
+// 超时后取消未完成的请求，返回 true 表示需要退出
+func runCheck(stop <-chan os.Signal, due map[string]bool, force bool) (exit bool) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		check(due, force)
+	}()
+
+	var sig os.Signal
+	select {
+	case <-done:
+		return false
+	case sig = <-stop:
 	}
+
+	slog.Info("收到退出信号，等待正在进行的更新完成", "signal", sig.String())
+	select {
+	case <-done:
+		slog.Info("更新已完成，已退出")
+		return true
+	case <-time.After(shutdownGrace):
+	}
+
+	slog.Warn("等待更新超时，取消未完成的请求", "grace", shutdownGrace)
+	client.CancelRequests()
+	select {
+	case <-done:
+	case <-time.After(cancelWait):
+	}
+	// 被取消的更新没有确认结果，下次启动时会重新同步
+	slog.Info("已退出")
+	return true
+}
+
+// reload 新配置校验失败时继续使用原配置和计划，成功时按新计划同步全部服务
+func reload(plan *client.Plan) (*client.Plan, map[string]bool, error) {
+	err := client.Reload()
+	var p *client.Plan
+	if err == nil {
+		p, err = client.NewPlan(client.Client, time.Now())
+	}
+	if err != nil {
+		slog.Error("重新加载配置失败，继续使用原配置", "error", err)
+		return plan, plan.Default(), err
+	}
+	if err = common.SetupLog(client.Client.Log); err != nil {
+		slog.Error("重新设置日志失败", "error", err)
+	}
+	clear(synced)
+	slog.Info("已重新加载配置")
+	return p, p.All(), nil
 }
 
 func processFlag() (exit bool, err error) {
@@ -117,6 +296,26 @@ func processFlag() (exit bool, err error) {
 	return
 }
 
+// history 查询历史记录，例如 history --record www.example.com --since 7d
+func history(args []string) error {
+	return common.HistoryCommand(args, func(dir string) (string, error) {
+		if dir != "" {
+			client.ConfDir = filepath.Clean(dir)
+		}
+		return client.LoadHistoryPath()
+	})
+}
+
+// validate 校验配置文件，例如 validate --online
+func validate(args []string) error {
+	return common.ValidateCommand(args, func(dir string, online bool) *common.ConfReport {
+		if dir != "" {
+			client.ConfDir = filepath.Clean(dir)
+		}
+		return client.Validate(online)
+	})
+}
+
 func initConf(event string) (err error) {
 	var msg string
 	switch event {
@@ -130,6 +329,12 @@ func initConf(event string) (err error) {
 		msg, err = client.Cf.InitConf()
 	case "4":
 		msg, err = client.HC.InitConf()
+	case "5":
+		msg, err = client.VC.InitConf()
+	case "6":
+		msg, err = client.BC.InitConf()
+	case "7":
+		msg, err = client.JC.InitConf()
 	default:
 		err = errors.New("你初始化了一个寂寞")
 	}
@@ -166,58 +371,187 @@ func loadConf() (err error) {
 			return
 		}
 	}
+	if client.Client.Services.Volcengine {
+		if err = client.VC.LoadConf(); err != nil {
+			return
+		}
+	}
+	if client.Client.Services.BaiduCloud {
+		if err = client.BC.LoadConf(); err != nil {
+			return
+		}
+	}
+	if client.Client.Services.JDCloud {
+		if err = client.JC.LoadConf(); err != nil {
+			return
+		}
+	}
 	return
 }
 
-func check() {
+// synced 各服务上一次同步时的地址，只在检查和重新加载配置时读写，两者不会同时进行
+var synced = make(map[string]string)
+
+// check 同步 due 中地址有变化的服务，force 时跳过本地比对
+func check(due map[string]bool, force bool) {
 	// 获取 IP
-	ipv4, ipv6, err := client.GetOwnIP(client.Client.Enable, client.Client.APIUrl, client.Client.NetworkCard, client.Client.EnableIPv6Fallback)
+	ipv4, ipv6, err := client.GetOwnIP(client.Client.Enable, client.Client.APIUrl, client.Client.IPSources, client.Client.NetworkCard, client.Client.Gateway, client.Client.DNS, client.Client.STUN, client.Client.EnableIPv6Fallback)
+	client.ObserveDetect(ipv4, ipv6, err)
 	if err != nil {
-		log.Println(err)
+		slog.Error("获取 IP 失败", "error", err)
 		if ipv4 == "" && ipv6 == "" {
 			return
 		}
 	}
 
-	if ipv4 == client.Client.LatestIPv4 && ipv6 == client.Client.LatestIPv6 && !*enforcement {
-		return
+	// 整组同步时以整组地址判断是否变化
+	var ipv4s, ipv6s []string
+	if client.Client.RecordSet.Enable {
+		ipv4s, ipv6s, err = client.GetRecordSet(client.Client.Enable, client.Client.RecordSet, ipv4, ipv6)
+		if err != nil {
+			slog.Error("获取 record_set 地址失败", "error", err)
+			return
+		}
+		ipv4, ipv6 = strings.Join(ipv4s, ","), strings.Join(ipv6s, ",")
 	}
 
-	// 进入更新流程
-	if ipv4 != client.Client.LatestIPv4 {
-		client.Client.LatestIPv4 = ipv4
+	// 局域网主机的地址随 IPv6 前缀变化
+	var lanPrefix string
+	var hosts []common.HostAddr
+	if client.Client.LANHosts.Enable && client.Client.Enable.IPv6 {
+		if lanPrefix, hosts, err = client.GetLANHosts(client.Client.LANHosts, ipv6); err != nil {
+			slog.Error("获取局域网主机地址失败", "error", err)
+		}
 	}
-	if ipv6 != client.Client.LatestIPv6 {
-		client.Client.LatestIPv6 = ipv6
+
+	client.Client.LatestIPv4, client.Client.LatestIPv6, client.Client.LatestLANPrefix = ipv4, ipv6, lanPrefix
+	client.ObserveIP(ipv4, ipv6)
+
+	// 各服务按自己上一次同步的地址判断是否需要更新
+	state := ipv4 + "|" + ipv6 + "|" + lanPrefix
+	force = force || *enforcement
+	pending := func(name string) bool {
+		if !due[name] || (!force && synced[name] == state) {
+			return false
+		}
+		synced[name] = state
+		return true
 	}
 
 	if client.Client.Center.Enable {
-		client.AccessCenter(ipv4, ipv6)
+		if pending(client.PlanCenter) {
+			client.AccessCenter(ipv4, ipv6)
+		}
 		return
 	}
 
+	// 确认生效时需要知道每条记录期望的值
+	if !client.Client.RecordSet.Enable {
+		ipv4s, ipv6s = []string{ipv4}, []string{ipv6}
+	}
+
 	wg := sync.WaitGroup{}
 	defer wg.Wait()
+	for _, svc := range enabledServices() {
+		if !pending(svc.name) {
+			continue
+		}
+		callback := svc.run
+		if svc.runSet != nil {
+			callback = withRecordSet(callback, svc.runSet, ipv4s, ipv6s)
+		}
+		callback = withLANHosts(callback, svc.runHosts, hosts)
+		callback = withVerify(callback, svc.name, svc.names, ipv4s, ipv6s, hosts)
+		wg.Go(func() { serviceInterface(svc.name, ipv4, ipv6, callback) })
+	}
+}
+
+// dnsService 一个服务商的各项操作，runSet 为空表示不支持 record_set
+type dnsService struct {
+	name     string
+	run      client.ServiceCallback
+	runSet   client.RecordSetCallback
+	runHosts client.LANHostCallback
+	names    common.Subdomain
+}
+
+func enabledServices() (services []dnsService) {
 	if client.Client.Services.DNSPod {
-		wg.Go(func() { serviceInterface(ipv4, ipv6, client.DP.Run) })
+		services = append(services, dnsService{common.DNSPod, client.DP.Run, client.DP.RunSet, client.DP.RunHosts, client.DP.RecordNames()})
 	}
 	if client.Client.Services.AliDNS {
-		wg.Go(func() { serviceInterface(ipv4, ipv6, client.AD.Run) })
+		services = append(services, dnsService{common.AliDNS, client.AD.Run, client.AD.RunSet, client.AD.RunHosts, client.AD.RecordNames()})
 	}
 	if client.Client.Services.Cloudflare {
-		wg.Go(func() { serviceInterface(ipv4, ipv6, client.Cf.Run) })
+		services = append(services, dnsService{common.Cloudflare, client.Cf.Run, client.Cf.RunSet, client.Cf.RunHosts, client.Cf.RecordNames()})
 	}
 	if client.Client.Services.HuaweiCloud {
-		wg.Go(func() { serviceInterface(ipv4, ipv6, client.HC.Run) })
+		services = append(services, dnsService{common.HuaweiCloud, client.HC.Run, client.HC.RunSet, client.HC.RunHosts, client.HC.RecordNames()})
+	}
+	if client.Client.Services.Volcengine {
+		services = append(services, dnsService{common.Volcengine, client.VC.Run, nil, client.VC.RunHosts, client.VC.RecordNames()})
+	}
+	if client.Client.Services.BaiduCloud {
+		services = append(services, dnsService{common.BaiduCloud, client.BC.Run, nil, client.BC.RunHosts, client.BC.RecordNames()})
+	}
+	if client.Client.Services.JDCloud {
+		services = append(services, dnsService{common.JDCloud, client.JC.Run, nil, client.JC.RunHosts, client.JC.RecordNames()})
+	}
+	return
+}
+
+// withRecordSet 启用 record_set 时改为整组同步解析记录
+func withRecordSet(run client.ServiceCallback, runSet client.RecordSetCallback, ipv4s, ipv6s []string) client.ServiceCallback {
+	if !client.Client.RecordSet.Enable {
+		return run
+	}
+	return func(enabledServices common.Enable, _, _ string) ([]string, []error) {
+		return runSet(enabledServices, ipv4s, ipv6s)
 	}
 }
 
-func serviceInterface(ipv4, ipv6 string, callback client.ServiceCallback) {
-	msg, err := callback(client.Client.Enable, ipv4, ipv6)
-	for _, row := range err {
-		log.Println(row)
+// withLANHosts 在同步本机记录之后为局域网主机发布 AAAA 记录
+func withLANHosts(run client.ServiceCallback, runHosts client.LANHostCallback, hosts []common.HostAddr) client.ServiceCallback {
+	if len(hosts) == 0 {
+		return run
+	}
+	return func(enabledServices common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
+		msg, errs = run(enabledServices, ipv4, ipv6)
+		m, e := runHosts(hosts)
+		return append(msg, m...), append(errs, e...)
+	}
+}
+
+// withVerify 有记录新建或更新时，确认解析记录已经生效
+func withVerify(run client.ServiceCallback, provider string, names common.Subdomain, ipv4s, ipv6s []string, hosts []common.HostAddr) client.ServiceCallback {
+	if !client.Client.Verify.Enable {
+		return run
+	}
+	return func(enabledServices common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
+		msg, errs = run(enabledServices, ipv4, ipv6)
+		if len(msg) == 0 {
+			return
+		}
+		m, e := client.VerifyRecords(provider, client.Client.Verify, client.ExpectedRecords(enabledServices, names, ipv4s, ipv6s, hosts))
+		return append(msg, m...), append(errs, e...)
+	}
+}
+
+// serviceInterface 每条解析记录的结果已由服务商输出，这里只补充其他错误，msg 仅在 debug 级别输出
+func serviceInterface(provider, ipv4, ipv6 string, callback client.ServiceCallback) {
+	msg, errs := callback(client.Client.Enable, ipv4, ipv6)
+	for _, err := range errs {
+		if !client.Logged(err) {
+			slog.Error(err.Error(), "provider", provider)
+		}
 	}
 	for _, row := range msg {
-		log.Println(row)
+		slog.Debug(row, "provider", provider)
 	}
 }
+
+// fatal 设置日志之后出错时使用，按 error 级别输出后退出
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"ddns-watchdog/internal/common"
 	"ddns-watchdog/internal/server"
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	flag "github.com/spf13/pflag"
@@ -33,13 +38,36 @@ var (
 		common.DNSPod+"\n"+
 		common.AliDNS+"\n"+
 		common.Cloudflare+"\n"+
-		common.HuaweiCloud)
+		common.HuaweiCloud+"\n"+
+		common.Volcengine+"\n"+
+		common.BaiduCloud+"\n"+
+		common.JDCloud)
 	domain = flag.StringP("domain", "D", "", "指定需要操作的域名")
 	a      = flag.StringP("A", "A", "", "指定需要修改的 A 记录")
 	aaaa   = flag.StringP("AAAA", "", "", "指定需要修改的 AAAA 记录 (默认同 A 记录，除非单独指定)")
 )
 
+// shutdownTimeout 收到退出信号后等待进行中的请求处理完成的时间
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		var sub func([]string) error
+		switch os.Args[1] {
+		case "history":
+			sub = history
+		case "validate":
+			sub = validate
+		}
+		if sub != nil {
+			if err := sub(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	// 处理 flag
 	exit, err := processFlag()
 	if err != nil {
@@ -49,10 +77,20 @@ func main() {
 		return
 	}
 
+	// 设置日志级别和格式
+	if err = common.SetupLog(server.Srv.Log); err != nil {
+		log.Fatal(err)
+	}
+
+	server.SetupNotifier()
+	if err = server.SetupHistory(); err != nil {
+		fatal(err)
+	}
+
 	// 加载白名单
 	if server.Srv.CenterService {
 		if err = server.Services.LoadConf(); err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 		// 路由绑定函数
 		http.HandleFunc(server.Srv.Route.Center, server.RespCenterReq)
@@ -60,6 +98,20 @@ func main() {
 
 	// 路由绑定函数
 	http.HandleFunc(server.Srv.Route.GetIP, server.RespGetIPReq)
+	if server.Srv.Route.Metrics != "" {
+		http.Handle(server.Srv.Route.Metrics, server.Metrics)
+	}
+
+	// 启动 STUN 和回显
+	closeEcho := func() {}
+	if server.Srv.Echo.Enable {
+		if closeEcho, err = server.ListenEcho(server.Srv.Echo); err != nil {
+			fatal(err)
+		}
+	}
+
+	// 收到 SIGHUP 或配置文件变化时重新加载配置
+	go reloadLoop()
 
 	// 设置超时参数和最低 TLS 版本
 	httpSrv := http.Server{
@@ -74,19 +126,89 @@ func main() {
 	}
 	httpSrv.SetKeepAlivesEnabled(false)
 
+	// 收到 SIGINT 或 SIGTERM 时停止接受新连接，等待进行中的请求和回显处理完成
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sig := <-stop
+		slog.Info("收到退出信号，等待进行中的请求处理完成", "signal", sig.String())
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpSrv.Shutdown(ctx); err != nil {
+			slog.Warn("等待请求处理超时，强制关闭连接", "error", err)
+			_ = httpSrv.Close()
+		}
+		closeEcho()
+	}()
+
 	// 启动监听
 	if server.Srv.TLS.Enable {
-		log.Println("Work on", server.Srv.ServerAddr, "with TLS")
+		slog.Info("开始监听", "addr", server.Srv.ServerAddr, "tls", true)
 		err = httpSrv.ListenAndServeTLS(server.Srv.TLS.CertFile, server.Srv.TLS.KeyFile)
 	} else {
-		log.Println("Work on", server.Srv.ServerAddr)
+		slog.Info("开始监听", "addr", server.Srv.ServerAddr, "tls", false)
 		err = httpSrv.ListenAndServe()
 	}
-	if err != nil {
-		log.Fatal(err)
+	if !errors.Is(err, http.ErrServerClosed) {
+		fatal(err)
+	}
+	<-stopped
+	slog.Info("已退出")
+}
+
+// fatal 设置日志之后出错时使用，按 error 级别输出后退出
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// reloadLoop 新配置读取失败时继续使用原配置
+func reloadLoop() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var changed <-chan struct{}
+	if server.Srv.WatchConf {
+		changed = common.WatchFiles(server.ConfFiles(), common.ConfWatchInterval)
+	}
+
+	for {
+		select {
+		case <-hup:
+		case <-changed:
+		}
+		if err := server.Reload(); err != nil {
+			slog.Error("重新加载配置失败，继续使用原配置", "error", err)
+			continue
+		}
+		if err := common.SetupLog(server.Srv.Log); err != nil {
+			slog.Error("重新设置日志失败", "error", err)
+		}
+		slog.Info("已重新加载配置")
 	}
 }
 
+// history 查询历史记录，例如 history --record example.com --since 7d
+func history(args []string) error {
+	return common.HistoryCommand(args, func(dir string) (string, error) {
+		if dir != "" {
+			server.ConfDir = filepath.Clean(dir)
+		}
+		return server.LoadHistoryPath()
+	})
+}
+
+// validate 校验配置文件，例如 validate --online
+func validate(args []string) error {
+	return common.ValidateCommand(args, func(dir string, online bool) *common.ConfReport {
+		if dir != "" {
+			server.ConfDir = filepath.Clean(dir)
+		}
+		return server.Validate(online)
+	})
+}
+
 func processFlag() (exit bool, err error) {
 	flag.Parse()
 
@@ -3,25 +3,35 @@ package client
 import (
 	"ddns-watchdog/internal/common"
 	"errors"
+	"strings"
+	"time"
 
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/alidns"
 )
 
 const (
-	AliDNSConfFilename = "alidns.json"
-	aliDNSPrefix       = "AliDNS: "
+	AliDNSConfFilename  = "alidns.json"
+	aliDNSPrefix        = "AliDNS: "
+	aliDNSDefaultRegion = "cn-hangzhou"
+	aliDNSPageSize      = 500
 )
 
 type AliDNS struct {
 	AccessKeyId     string           `json:"access_key_id"`
 	AccessKeySecret string           `json:"access_key_secret"`
+	Region          string           `json:"region"`
+	Endpoint        string           `json:"endpoint"`
 	Domain          string           `json:"domain"`
 	SubDomain       common.Subdomain `json:"sub_domain"`
+	dnsClient       *alidns.Client
+	scheme          string
 }
 
 func (ad *AliDNS) InitConf() (msg string, err error) {
 	*ad = AliDNS{
 		AccessKeyId: "在 https://ram.console.aliyun.com/users 获取",
+		Region:      aliDNSDefaultRegion,
 		Domain:      "example.com",
 		SubDomain: common.Subdomain{
 			A:    "A记录子域名",
@@ -38,88 +48,220 @@ func (ad *AliDNS) LoadConf() (err error) {
 	if err = common.LoadAndUnmarshal(ConfDir+"/"+AliDNSConfFilename, &ad); err != nil {
 		return
 	}
+	return ad.check()
+}
 
+func (ad *AliDNS) check() error {
 	if ad.AccessKeyId == "" || ad.AccessKeySecret == "" || ad.Domain == "" || (ad.SubDomain.A == "" && ad.SubDomain.AAAA == "") {
 		return errors.New("请打开配置文件 " + ConfDir + "/" + AliDNSConfFilename + " 检查你的 access_key_id, access_key_secret, domain, sub_domain 并重新启动")
 	}
+	return nil
+}
+
+// getClient 每个实例只构造一次 SDK 客户端
+func (ad *AliDNS) getClient() (dnsClient *alidns.Client, err error) {
+	if ad.dnsClient != nil {
+		return ad.dnsClient, nil
+	}
+
+	if ad.Region == "" {
+		ad.Region = aliDNSDefaultRegion
+	}
+	dnsClient, err = alidns.NewClientWithAccessKey(ad.Region, ad.AccessKeyId, ad.AccessKeySecret)
+	if err != nil {
+		return
+	}
+
+	// endpoint 可以只写主机名，也可以带上协议
+	ad.scheme = "https"
+	if ad.Endpoint != "" {
+		endpoint := ad.Endpoint
+		if idx := strings.Index(endpoint, "://"); idx != -1 {
+			ad.scheme = endpoint[:idx]
+			endpoint = endpoint[idx+3:]
+		}
+		dnsClient.Domain = strings.TrimSuffix(endpoint, "/")
+	}
+
+	ad.dnsClient = dnsClient
 	return
 }
 
 func (ad *AliDNS) Run(enabled common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
 	if ipv4 != "" && enabled.IPv4 && ad.SubDomain.A != "" {
-		// 获取解析记录
-		recordId, recordIP, err := ad.getParseRecord(ad.SubDomain.A, "A")
-		if err != nil {
+		if m, err := ad.syncParseRecord(ipv4, "A", ad.SubDomain.A); err != nil {
 			errs = append(errs, err)
-		} else if recordIP != ipv4 {
-			// 更新解析记录
-			if err = ad.updateParseRecord(ipv4, recordId, "A", ad.SubDomain.A); err != nil {
-				errs = append(errs, err)
-			} else {
-				msg = append(msg, aliDNSPrefix+ad.SubDomain.A+"."+ad.Domain+" 已更新解析记录 "+ipv4)
-			}
+		} else if m != "" {
+			msg = append(msg, m)
 		}
 	}
 	if ipv6 != "" && enabled.IPv6 && ad.SubDomain.AAAA != "" {
-		// 获取解析记录
-		recordId, recordIP, err := ad.getParseRecord(ad.SubDomain.AAAA, "AAAA")
-		if err != nil {
+		if m, err := ad.syncParseRecord(ipv6, "AAAA", ad.SubDomain.AAAA); err != nil {
 			errs = append(errs, err)
-		} else if recordIP != ipv6 {
-			// 更新解析记录
-			if err = ad.updateParseRecord(ipv6, recordId, "AAAA", ad.SubDomain.AAAA); err != nil {
-				errs = append(errs, err)
-			} else {
-				msg = append(msg, aliDNSPrefix+ad.SubDomain.AAAA+"."+ad.Domain+" 已更新解析记录 "+ipv6)
-			}
+		} else if m != "" {
+			msg = append(msg, m)
+		}
+	}
+	return
+}
+
+// RunSet 同步整组解析记录，使同名记录恰好为 ipv4s 和 ipv6s
+func (ad *AliDNS) RunSet(enabled common.Enable, ipv4s, ipv6s []string) (msg []string, errs []error) {
+	return runRecordSet(enabled, ad.SubDomain, ipv4s, ipv6s, ad.syncRecordSet)
+}
+
+func (ad *AliDNS) syncRecordSet(recordType, subDomain string, values []string) ([]string, []error) {
+	return syncRecordSet(aliDNSPrefix, subDomain+"."+ad.Domain, values, recordSetOps{
+		provider:   common.AliDNS,
+		recordType: recordType,
+		list: func() ([]setRecord, error) {
+			return ad.listParseRecords(subDomain, recordType)
+		},
+		create: func(value string) error {
+			return ad.createParseRecord(value, recordType, subDomain)
+		},
+		update: func(rec setRecord, value string) error {
+			return ad.updateParseRecord(value, rec.id, recordType, subDomain)
+		},
+		remove: func(rec setRecord) error {
+			return ad.deleteParseRecord(rec.id)
+		},
+	})
+}
+
+// RunHosts 为局域网主机发布 AAAA 记录，主机的完整域名需要属于 domain
+func (ad *AliDNS) RunHosts(hosts []common.HostAddr) (msg []string, errs []error) {
+	return runHosts(aliDNSPrefix, hosts, func(fqdn string) (string, error) {
+		return subDomainOf(fqdn, ad.Domain)
+	}, ad.syncParseRecord)
+}
+
+// RecordNames 返回 A 和 AAAA 记录的完整域名
+func (ad *AliDNS) RecordNames() common.Subdomain {
+	return common.Subdomain{A: fqdnOf(ad.SubDomain.A, ad.Domain), AAAA: fqdnOf(ad.SubDomain.AAAA, ad.Domain)}
+}
+
+func (ad *AliDNS) syncParseRecord(ipAddr, recordType, subDomain string) (msg string, err error) {
+	ev := updateEvent{provider: common.AliDNS, record: fqdnOf(subDomain, ad.Domain), recordType: recordType, newIP: ipAddr}
+	defer func() { err = ev.done(msg != "", err) }()
+
+	// 获取解析记录
+	recordId, recordIP, err := ad.getParseRecord(subDomain, recordType)
+	ev.oldIP = recordIP
+	switch {
+	case err != nil:
+	case recordId == "":
+		// 新建解析记录
+		if err = ad.createParseRecord(ipAddr, recordType, subDomain); err == nil {
+			msg = aliDNSPrefix + subDomain + "." + ad.Domain + " 已新建解析记录 " + ipAddr
+		}
+	case recordIP != ipAddr:
+		// 更新解析记录
+		if err = ad.updateParseRecord(ipAddr, recordId, recordType, subDomain); err == nil {
+			msg = aliDNSPrefix + subDomain + "." + ad.Domain + " 已更新解析记录 " + ipAddr
 		}
 	}
 	return
 }
 
 func (ad *AliDNS) getParseRecord(subDomain, recordType string) (recordId, recordIP string, err error) {
-	dnsClient, err := alidns.NewClientWithAccessKey("cn-hangzhou", ad.AccessKeyId, ad.AccessKeySecret)
+	records, err := ad.listParseRecords(subDomain, recordType)
+	// 解析记录不存在时 recordId 为空
+	if err != nil || len(records) == 0 {
+		return
+	}
+	return records[0].id, records[0].value, nil
+}
+
+func (ad *AliDNS) listParseRecords(subDomain, recordType string) (records []setRecord, err error) {
+	dnsClient, err := ad.getClient()
 	if err != nil {
 		return
 	}
 
+	// 按主机记录和类型在服务端精确过滤，并按页遍历
 	request := alidns.CreateDescribeDomainRecordsRequest()
-	request.Scheme = "https"
+	request.Scheme = ad.scheme
 	request.DomainName = ad.Domain
+	request.RRKeyWord = subDomain
+	request.TypeKeyWord = recordType
+	request.SearchMode = "EXACT"
+	request.PageSize = requests.NewInteger(aliDNSPageSize)
 
-	response, err := dnsClient.DescribeDomainRecords(request)
-	if err != nil {
-		return
-	}
+	for page, seen := 1, 0; ; page++ {
+		request.PageNumber = requests.NewInteger(page)
 
-	for i := range response.DomainRecords.Record {
-		if response.DomainRecords.Record[i].RR == subDomain &&
-			response.DomainRecords.Record[i].Type == recordType {
-			recordId = response.DomainRecords.Record[i].RecordId
-			recordIP = response.DomainRecords.Record[i].Value
-			break
+		var response *alidns.DescribeDomainRecordsResponse
+		start := time.Now()
+		response, err = dnsClient.DescribeDomainRecords(request)
+		observeAPI(common.AliDNS, start)
+		if err != nil {
+			return
+		}
+
+		for _, v := range response.DomainRecords.Record {
+			if v.RR == subDomain && v.Type == recordType {
+				records = append(records, setRecord{id: v.RecordId, value: v.Value})
+			}
+		}
+
+		seen += len(response.DomainRecords.Record)
+		if len(response.DomainRecords.Record) == 0 || int64(seen) >= response.TotalCount {
+			return
 		}
 	}
+}
 
-	if recordId == "" || recordIP == "" {
-		err = errors.New(aliDNSPrefix + subDomain + "." + ad.Domain + " 的 " + recordType + " 解析记录不存在")
+func (ad *AliDNS) createParseRecord(ipAddr, recordType, subDomain string) (err error) {
+	dnsClient, err := ad.getClient()
+	if err != nil {
+		return
 	}
+
+	request := alidns.CreateAddDomainRecordRequest()
+	request.Scheme = ad.scheme
+	request.DomainName = ad.Domain
+	request.RR = subDomain
+	request.Type = recordType
+	request.Value = ipAddr
+
+	start := time.Now()
+	_, err = dnsClient.AddDomainRecord(request)
+	observeAPI(common.AliDNS, start)
 	return
 }
 
 func (ad *AliDNS) updateParseRecord(ipAddr, recordId, recordType, subDomain string) (err error) {
-	dnsClient, err := alidns.NewClientWithAccessKey("cn-hangzhou", ad.AccessKeyId, ad.AccessKeySecret)
+	dnsClient, err := ad.getClient()
 	if err != nil {
 		return
 	}
 
 	request := alidns.CreateUpdateDomainRecordRequest()
-	request.Scheme = "https"
+	request.Scheme = ad.scheme
 	request.RecordId = recordId
 	request.RR = subDomain
 	request.Type = recordType
 	request.Value = ipAddr
 
+	start := time.Now()
 	_, err = dnsClient.UpdateDomainRecord(request)
+	observeAPI(common.AliDNS, start)
+	return
+}
+
+func (ad *AliDNS) deleteParseRecord(recordId string) (err error) {
+	dnsClient, err := ad.getClient()
+	if err != nil {
+		return
+	}
+
+	request := alidns.CreateDeleteDomainRecordRequest()
+	request.Scheme = ad.scheme
+	request.RecordId = recordId
+
+	start := time.Now()
+	_, err = dnsClient.DeleteDomainRecord(request)
+	observeAPI(common.AliDNS, start)
 	return
 }
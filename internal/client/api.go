@@ -0,0 +1,198 @@
+package client
+
+import (
+	"crypto/subtle"
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	apiUnixPrefix = "unix:"
+	// apiAcceptTimeout 检查正在进行时，操作请求最多等待这么久
+	apiAcceptTimeout = 10 * time.Second
+)
+
+// apiRequests 本地 API 请求的检查，由主流程在空闲时取出
+var apiRequests = make(chan APIRequest)
+
+// APIRequest 通过本地 API 请求的一次检查，provider 为空表示全部服务
+// reload 为 true 时请求重新加载配置，由主流程重新加载后调用 Reply
+type APIRequest struct {
+	provider string
+	force    bool
+	reload   bool
+	reply    chan error
+}
+
+// APIRequests 主流程从这里取出本地 API 请求的检查
+func APIRequests() <-chan APIRequest {
+	return apiRequests
+}
+
+// Accept 按当前计划确定需要同步的服务，服务不存在时回复错误并返回空
+func (req APIRequest) Accept(p *Plan) (due map[string]bool, force bool) {
+	due = p.All()
+	if req.provider != "" {
+		if !due[req.provider] {
+			req.reply <- errors.New(req.provider + " 不是已启用的服务")
+			return nil, false
+		}
+		due = map[string]bool{req.provider: true}
+	}
+	req.reply <- nil
+	return due, req.force
+}
+
+// IsReload 是否为重新加载配置的请求
+func (req APIRequest) IsReload() bool {
+	return req.reload
+}
+
+// Reply 回复重新加载配置的结果
+func (req APIRequest) Reply(err error) {
+	req.reply <- err
+}
+
+// check 校验 api 的配置，错误信息由调用方补充配置文件位置
+func (conf api) check() error {
+	if conf.Addr == "" || strings.HasPrefix(conf.Addr, apiUnixPrefix) {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(conf.Addr)
+	if err != nil {
+		return errors.New("addr " + err.Error())
+	}
+	if ip := net.ParseIP(host); conf.Token == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errors.New("addr 不是本机回环地址时需要填写 token")
+	}
+	return nil
+}
+
+// ServeAPI 按 Client.API 提供本地 API，监听失败时立即返回错误
+func ServeAPI() (err error) {
+	conf := Client.API
+	var ln net.Listener
+	if path, ok := strings.CutPrefix(conf.Addr, apiUnixPrefix); ok {
+		// 上次异常退出时留下的 socket 文件会导致监听失败
+		_ = os.Remove(path)
+		if ln, err = net.Listen("unix", path); err == nil {
+			err = os.Chmod(path, 0o600)
+		}
+	} else {
+		ln, err = net.Listen("tcp", conf.Addr)
+	}
+	if err != nil {
+		return errors.New("api 的 addr " + err.Error())
+	}
+
+	srv := &http.Server{
+		Handler:           apiHandler(conf.Token),
+		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      apiAcceptTimeout + 5*time.Second,
+	}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	return
+}
+
+func apiHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, req *http.Request) {
+		writeAPIJson(w, http.StatusOK, currentStatus())
+	})
+	mux.HandleFunc("GET /api/config", func(w http.ResponseWriter, req *http.Request) {
+		writeAPIJson(w, http.StatusOK, currentConf())
+	})
+	mux.HandleFunc("POST /api/check", func(w http.ResponseWriter, req *http.Request) {
+		requestCheck(w, req.FormValue("provider"), false)
+	})
+	mux.HandleFunc("POST /api/reconcile", func(w http.ResponseWriter, req *http.Request) {
+		requestCheck(w, req.FormValue("provider"), true)
+	})
+	mux.HandleFunc("POST /api/pause", func(w http.ResponseWriter, req *http.Request) {
+		setPaused(true)
+		writeAPIMessage(w, http.StatusOK, "已暂停更新")
+	})
+	mux.HandleFunc("POST /api/resume", func(w http.ResponseWriter, req *http.Request) {
+		setPaused(false)
+		writeAPIMessage(w, http.StatusOK, "已恢复更新")
+	})
+	return apiAuth(token, apiRejectBrowser(mux))
+}
+
+// apiRejectBrowser 拒绝浏览器发出的修改请求，本地 API 只给脚本使用
+// 没有 token 时本机打开的任意网页都可以向回环地址提交表单，浏览器发出的请求会带有 Origin 或 Sec-Fetch-Site
+func apiRejectBrowser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead &&
+			(req.Header.Get("Origin") != "" || req.Header.Get("Sec-Fetch-Site") != "") {
+			writeAPIMessage(w, http.StatusForbidden, "本地 API 不接受来自网页的请求")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// apiAuth token 不为空时要求 Authorization: Bearer <token>
+func apiAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeAPIMessage(w, http.StatusUnauthorized, "token 错误")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// requestCheck 交给主流程检查，主流程接受后立即返回，不等待检查完成
+func requestCheck(w http.ResponseWriter, provider string, force bool) {
+	if Paused() {
+		writeAPIMessage(w, http.StatusConflict, "更新已暂停")
+		return
+	}
+	req := APIRequest{provider: provider, force: force, reply: make(chan error, 1)}
+	select {
+	case apiRequests <- req:
+	case <-time.After(apiAcceptTimeout):
+		writeAPIMessage(w, http.StatusServiceUnavailable, "正在检查，请稍后重试")
+		return
+	}
+	if err := <-req.reply; err != nil {
+		writeAPIMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeAPIMessage(w, http.StatusAccepted, "已开始检查")
+}
+
+// requestReload 交给主流程重新加载配置并等待结果，主流程正在检查时最多等待 apiAcceptTimeout
+func requestReload() error {
+	req := APIRequest{reload: true, reply: make(chan error, 1)}
+	select {
+	case apiRequests <- req:
+	case <-time.After(apiAcceptTimeout):
+		return errors.New("正在检查，请稍后重试")
+	}
+	return <-req.reply
+}
+
+func writeAPIJson(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIMessage(w http.ResponseWriter, code int, msg string) {
+	writeAPIJson(w, code, common.GeneralResp{Message: msg})
+}
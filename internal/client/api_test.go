@@ -0,0 +1,137 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	srv := httptest.NewServer(apiHandler("secret-token"))
+	defer srv.Close()
+	t.Cleanup(func() { setPaused(false) })
+
+	do := func(method, path, token string) (code int, body string) {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if code, _ := do(http.MethodGet, "/api/status", ""); code != http.StatusUnauthorized {
+		t.Errorf("没有 token 时状态码 = %d", code)
+	}
+	setRecordStatus(common.HistoryEntry{Time: time.Now(), Provider: common.DNSPod, Record: "www.example.com",
+		Type: "A", NewIP: "192.0.2.1", Result: resultUpdated})
+	code, body := do(http.MethodGet, "/api/status", "secret-token")
+	var st apiStatus
+	if err := json.Unmarshal([]byte(body), &st); err != nil || code != http.StatusOK || len(st.Records) == 0 {
+		t.Fatalf("status = %d %s", code, body)
+	}
+
+	// 主流程按计划接受检查
+	plan, err := NewPlan(client{Services: service{DNSPod: true}}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan map[string]bool, 2)
+	go func() {
+		for range 2 {
+			due, force := (<-APIRequests()).Accept(plan)
+			if force {
+				accepted <- due
+			}
+		}
+	}()
+	if code, body = do(http.MethodPost, "/api/reconcile?provider=cloudflare", "secret-token"); code != http.StatusBadRequest {
+		t.Errorf("未启用的服务 = %d %s", code, body)
+	}
+	if code, body = do(http.MethodPost, "/api/reconcile?provider=dnspod", "secret-token"); code != http.StatusAccepted {
+		t.Errorf("reconcile = %d %s", code, body)
+	}
+	if due := <-accepted; !due[common.DNSPod] || len(due) != 1 {
+		t.Errorf("due = %v", due)
+	}
+
+	do(http.MethodPost, "/api/pause", "secret-token")
+	if code, _ = do(http.MethodPost, "/api/check", "secret-token"); code != http.StatusConflict || !Paused() {
+		t.Errorf("暂停后检查 = %d", code)
+	}
+}
+
+// TestAPIRejectBrowser 没有 token 时网页不能通过提交表单暂停更新
+func TestAPIRejectBrowser(t *testing.T) {
+	srv := httptest.NewServer(apiHandler(""))
+	defer srv.Close()
+	t.Cleanup(func() { setPaused(false) })
+
+	for header, value := range map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/pause", strings.NewReader("x=1"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(header, value)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || Paused() {
+			t.Errorf("带有 %s 的请求 = %d, paused = %v", header, resp.StatusCode, Paused())
+		}
+	}
+
+	resp, err := http.Post(srv.URL+"/api/pause", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !Paused() {
+		t.Errorf("脚本的请求 = %d", resp.StatusCode)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	conf := redact(map[string]any{
+		"center":  center{APIUrl: "https://example.com/center?key=1", Token: "abc"},
+		"alidns":  AliDNS{AccessKeyId: "id", AccessKeySecret: "secret", Domain: "example.com"},
+		"headers": map[string]string{"Authorization": "Bearer abc"},
+	}).(map[string]any)
+	b, _ := json.Marshal(conf)
+	for _, s := range []string{"abc", `:"secret"`, "key=1", `:"id"`} {
+		if strings.Contains(string(b), s) {
+			t.Errorf("%s 中包含 %s", b, s)
+		}
+	}
+	if !strings.Contains(string(b), "example.com") {
+		t.Errorf("%s 中缺少非敏感字段", b)
+	}
+}
+
+func TestAPIConfCheck(t *testing.T) {
+	tests := map[api]bool{
+		{}:                                 false,
+		{Addr: "127.0.0.1:9778"}:           false,
+		{Addr: "localhost:9778"}:           false,
+		{Addr: "[::1]:9778"}:               false,
+		{Addr: "unix:/run/ddns.sock"}:      false,
+		{Addr: ":9778"}:                    true,
+		{Addr: "0.0.0.0:9778", Token: "t"}: false,
+		{Addr: "127.0.0.1"}:                true,
+	}
+	for conf, wantErr := range tests {
+		if err := conf.check(); (err != nil) != wantErr {
+			t.Errorf("%+v: err = %v, wantErr %v", conf, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package client
+
+import (
+	"bytes"
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	BaiduCloudConfFilename = "baiducloud.json"
+	baiduCloudPrefix       = "BaiduCloud: "
+	baiduCloudEndpoint     = "https://bcd.baidubce.com"
+	baiduCloudDefaultTTL   = 600
+	baiduCloudPageSize     = 1000
+)
+
+type BaiduCloud struct {
+	AccessKeyId     string           `json:"access_key_id"`
+	SecretAccessKey string           `json:"secret_access_key"`
+	Endpoint        string           `json:"endpoint"`
+	Domain          string           `json:"domain"`
+	SubDomain       common.Subdomain `json:"sub_domain"`
+}
+
+type baiduCloudRecord struct {
+	RecordId uint64 `json:"recordId"`
+	Domain   string `json:"domain"`
+	View     string `json:"view"`
+	RdType   string `json:"rdtype"`
+	TTL      int    `json:"ttl"`
+	Rdata    string `json:"rdata"`
+	ZoneName string `json:"zoneName"`
+}
+
+type baiduCloudListRequest struct {
+	Domain   string `json:"domain"`
+	PageNum  int    `json:"pageNum"`
+	PageSize int    `json:"pageSize"`
+}
+
+type baiduCloudListResp struct {
+	TotalCount int                `json:"totalCount"`
+	Result     []baiduCloudRecord `json:"result"`
+}
+
+type baiduCloudModifyRequest struct {
+	RecordId uint64 `json:"recordId"`
+	Domain   string `json:"domain"`
+	View     string `json:"view"`
+	RdType   string `json:"rdType"`
+	TTL      int    `json:"ttl"`
+	Rdata    string `json:"rdata"`
+	ZoneName string `json:"zoneName"`
+}
+
+type baiduCloudCreateRequest struct {
+	Domain   string `json:"domain"`
+	RdType   string `json:"rdType"`
+	TTL      int    `json:"ttl"`
+	Rdata    string `json:"rdata"`
+	ZoneName string `json:"zoneName"`
+}
+
+type baiduCloudErrorResp struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (bc *BaiduCloud) InitConf() (msg string, err error) {
+	*bc = BaiduCloud{
+		AccessKeyId: "在 https://console.bce.baidu.com/iam/#/iam/accesslist 获取",
+		Domain:      "example.com",
+		SubDomain: common.Subdomain{
+			A:    "A记录子域名",
+			AAAA: "AAAA记录子域名",
+		},
+	}
+	bc.SecretAccessKey = bc.AccessKeyId
+
+	return "初始化 " + ConfDir + "/" + BaiduCloudConfFilename,
+		common.MarshalAndSave(bc, ConfDir+"/"+BaiduCloudConfFilename)
+}
+
+func (bc *BaiduCloud) LoadConf() (err error) {
+	if err = common.LoadAndUnmarshal(ConfDir+"/"+BaiduCloudConfFilename, &bc); err != nil {
+		return
+	}
+	return bc.check()
+}
+
+func (bc *BaiduCloud) check() error {
+	if bc.AccessKeyId == "" || bc.SecretAccessKey == "" || bc.Domain == "" || (bc.SubDomain.A == "" && bc.SubDomain.AAAA == "") {
+		return errors.New("请打开配置文件 " + ConfDir + "/" + BaiduCloudConfFilename + " 检查你的 access_key_id, secret_access_key, domain, sub_domain 并重新启动")
+	}
+	return nil
+}
+
+func (bc *BaiduCloud) Run(enabled common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
+	if ipv4 != "" && enabled.IPv4 && bc.SubDomain.A != "" {
+		if m, err := bc.syncParseRecord(ipv4, "A", bc.SubDomain.A); err != nil {
+			errs = append(errs, err)
+		} else if m != "" {
+			msg = append(msg, m)
+		}
+	}
+	if ipv6 != "" && enabled.IPv6 && bc.SubDomain.AAAA != "" {
+		if m, err := bc.syncParseRecord(ipv6, "AAAA", bc.SubDomain.AAAA); err != nil {
+			errs = append(errs, err)
+		} else if m != "" {
+			msg = append(msg, m)
+		}
+	}
+	return
+}
+
+// RunHosts 为局域网主机发布 AAAA 记录，主机的完整域名需要属于 domain
+func (bc *BaiduCloud) RunHosts(hosts []common.HostAddr) (msg []string, errs []error) {
+	return runHosts(baiduCloudPrefix, hosts, func(fqdn string) (string, error) {
+		return subDomainOf(fqdn, bc.Domain)
+	}, bc.syncParseRecord)
+}
+
+// RecordNames 返回 A 和 AAAA 记录的完整域名
+func (bc *BaiduCloud) RecordNames() common.Subdomain {
+	return common.Subdomain{A: fqdnOf(bc.SubDomain.A, bc.Domain), AAAA: fqdnOf(bc.SubDomain.AAAA, bc.Domain)}
+}
+
+func (bc *BaiduCloud) syncParseRecord(ipAddr, recordType, subDomain string) (msg string, err error) {
+	ev := updateEvent{provider: common.BaiduCloud, record: fqdnOf(subDomain, bc.Domain), recordType: recordType, newIP: ipAddr}
+	defer func() { err = ev.done(msg != "", err) }()
+
+	// 获取解析记录
+	record, err := bc.getParseRecord(subDomain, recordType)
+	ev.oldIP = record.Rdata
+	switch {
+	case err != nil:
+	case record.RecordId == 0:
+		// 新建解析记录
+		if err = bc.createParseRecord(ipAddr, recordType, subDomain); err == nil {
+			msg = baiduCloudPrefix + subDomain + "." + bc.Domain + " 已新建解析记录 " + ipAddr
+		}
+	case record.Rdata != ipAddr:
+		// 更新解析记录
+		if err = bc.updateParseRecord(ipAddr, record); err == nil {
+			msg = baiduCloudPrefix + subDomain + "." + bc.Domain + " 已更新解析记录 " + ipAddr
+		}
+	}
+	return
+}
+
+func (bc *BaiduCloud) getParseRecord(subDomain, recordType string) (record baiduCloudRecord, err error) {
+	// 接口不能按名称过滤，按页遍历整个域名的记录
+	for page, seen := 1, 0; ; page++ {
+		reqData := baiduCloudListRequest{
+			Domain:   bc.Domain,
+			PageNum:  page,
+			PageSize: baiduCloudPageSize,
+		}
+
+		var result baiduCloudListResp
+		if err = bc.request("/v1/domain/resolve/list", reqData, &result); err != nil {
+			return
+		}
+
+		for _, v := range result.Result {
+			if v.Domain == subDomain && v.RdType == recordType {
+				return v, nil
+			}
+		}
+
+		seen += len(result.Result)
+		if len(result.Result) == 0 || seen >= result.TotalCount {
+			return
+		}
+	}
+}
+
+func (bc *BaiduCloud) createParseRecord(ipAddr, recordType, subDomain string) (err error) {
+	reqData := baiduCloudCreateRequest{
+		Domain:   subDomain,
+		RdType:   recordType,
+		TTL:      baiduCloudDefaultTTL,
+		Rdata:    ipAddr,
+		ZoneName: bc.Domain,
+	}
+	return bc.request("/v1/domain/resolve/add", reqData, nil)
+}
+
+func (bc *BaiduCloud) updateParseRecord(ipAddr string, record baiduCloudRecord) (err error) {
+	reqData := baiduCloudModifyRequest{
+		RecordId: record.RecordId,
+		Domain:   record.Domain,
+		View:     record.View,
+		RdType:   record.RdType,
+		TTL:      record.TTL,
+		Rdata:    ipAddr,
+		ZoneName: bc.Domain,
+	}
+	return bc.request("/v1/domain/resolve/edit", reqData, nil)
+}
+
+func (bc *BaiduCloud) request(path string, body, result any) (err error) {
+	reqJson, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	req, err := httpNewRequest(http.MethodPost, endpointOr(bc.Endpoint, baiduCloudEndpoint)+path, bytes.NewReader(reqJson))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	bceSign(req, bc.AccessKeyId, bc.SecretAccessKey, time.Now())
+
+	start := time.Now()
+	resp, err := common.DefaultHttpClient.Do(req)
+	observeAPI(common.BaiduCloud, start)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	respJson, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var res baiduCloudErrorResp
+		if err = json.Unmarshal(respJson, &res); err != nil || res.Code == "" {
+			return errors.New(baiduCloudPrefix + "HTTP " + strconv.Itoa(resp.StatusCode))
+		}
+		return errors.New(baiduCloudPrefix + res.Code + ": " + res.Message)
+	}
+
+	if result == nil || len(respJson) == 0 {
+		return
+	}
+	return json.Unmarshal(respJson, result)
+}
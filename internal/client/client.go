@@ -10,15 +10,32 @@ import (
 const ConfFilename = "client.json"
 
 type client struct {
-	APIUrl             apiUrl        `json:"api_url"`
-	Center             center        `json:"center"`
-	Enable             common.Enable `json:"enable"`
-	NetworkCard        networkCard   `json:"network_card"`
-	Services           service       `json:"services"`
-	EnableIPv6Fallback bool          `json:"enable_ipv6_fallback"`
-	CheckCycleMinutes  int           `json:"check_cycle_minutes"`
-	LatestIPv4         string        `json:"-"`
-	LatestIPv6         string        `json:"-"`
+	APIUrl             apiUrl             `json:"api_url"`
+	Center             center             `json:"center"`
+	Enable             common.Enable      `json:"enable"`
+	IPSources          ipSources          `json:"ip_sources"`
+	NetworkCard        networkCard        `json:"network_card"`
+	Gateway            gatewayDetect      `json:"gateway"`
+	DNS                dnsDetect          `json:"dns"`
+	STUN               stunDetect         `json:"stun"`
+	RecordSet          recordSet          `json:"record_set"`
+	LANHosts           lanHosts           `json:"lan_hosts"`
+	Verify             verify             `json:"verify"`
+	Services           service            `json:"services"`
+	EnableIPv6Fallback bool               `json:"enable_ipv6_fallback"`
+	CheckCycleMinutes  int                `json:"check_cycle_minutes"`
+	Schedule           schedule           `json:"schedule"`
+	WatchNetwork       bool               `json:"watch_network"`
+	WatchConf          bool               `json:"watch_conf"`
+	MetricsAddr        string             `json:"metrics_addr"`
+	Log                common.LogConf     `json:"log"`
+	Notify             common.NotifyConf  `json:"notify"`
+	History            common.HistoryConf `json:"history"`
+	API                api                `json:"api"`
+	Web                web                `json:"web"`
+	LatestIPv4         string             `json:"-"`
+	LatestIPv6         string             `json:"-"`
+	LatestLANPrefix    string             `json:"-"`
 }
 
 type apiUrl struct {
@@ -33,17 +50,125 @@ type center struct {
 	Enable bool   `json:"enable"`
 }
 
+// ipSources 配置后代替 api_url 获取 IP，并行查询并按多数结果取值
+type ipSources struct {
+	IPv4           []ipSource `json:"ipv4"`
+	IPv6           []ipSource `json:"ipv6"`
+	Quorum         int        `json:"quorum"`
+	TimeoutSeconds int        `json:"timeout_seconds"`
+}
+
+// ipSource format 为空或 ddns-watchdog 时按服务端接口解析，text 为纯文本，json 时取 field 指定的字段
+type ipSource struct {
+	URL    string `json:"url"`
+	Format string `json:"format"`
+	Field  string `json:"field"`
+}
+
+// networkCard ipv4 / ipv6 为 "eth0 0" 这样的名称，ipv4_rule / ipv6_rule 的 interface 不为空时代替其按规则选择
 type networkCard struct {
+	Enable   bool     `json:"enable"`
+	IPv4     string   `json:"ipv4"`
+	IPv6     string   `json:"ipv6"`
+	IPv4Rule addrRule `json:"ipv4_rule"`
+	IPv6Rule addrRule `json:"ipv6_rule"`
+}
+
+// addrRule 按规则选择网卡地址，interface 为网卡名或正则表达式 (需完整匹配)
+// scope 为空或 global 时只选择公网地址，private 时只选择内网、ULA 和 CGNAT 地址
+// prefix 不为空时只选择该前缀内的地址；已弃用的地址总是排除，临时地址需要 allow_temporary
+type addrRule struct {
+	Interface      string `json:"interface"`
+	Scope          string `json:"scope"`
+	Prefix         string `json:"prefix"`
+	AllowTemporary bool   `json:"allow_temporary"`
+}
+
+// gatewayDetect 向路由器询问 WAN 口 IPv4
+// method 可选 natpmp, pcp, upnp，为空时依次尝试；address 为空时自动查找默认网关
+type gatewayDetect struct {
+	Enable  bool   `json:"enable"`
+	Method  string `json:"method"`
+	Address string `json:"address"`
+}
+
+// dnsDetect 通过 DNS 查询获取 IP，ipv4 / ipv6 可选 opendns, cloudflare, google，为空时该类型不使用 DNS
+type dnsDetect struct {
 	Enable bool   `json:"enable"`
 	IPv4   string `json:"ipv4"`
 	IPv6   string `json:"ipv6"`
 }
 
+// stunDetect 通过 STUN 获取 IP，servers 为空时使用内置的服务器
+type stunDetect struct {
+	Enable  common.Enable `json:"enable"`
+	Servers []string      `json:"servers"`
+}
+
+// recordSet 启用后管理同名的整组解析记录
+// ipv4 / ipv6 为空时只保留获取到的 IP 并删除多余记录，否则发布所列网卡的全部地址
+type recordSet struct {
+	Enable bool     `json:"enable"`
+	IPv4   []string `json:"ipv4"`
+	IPv6   []string `json:"ipv6"`
+}
+
+// lanHosts 启用后以当前 IPv6 前缀加上固定的接口标识为局域网主机发布 AAAA 记录
+// network_card 为空时从获取到的 IPv6 中取前缀，prefix_length 为空时按 64 处理
+type lanHosts struct {
+	Enable       bool      `json:"enable"`
+	NetworkCard  string    `json:"network_card"`
+	PrefixLength int       `json:"prefix_length"`
+	Hosts        []lanHost `json:"hosts"`
+}
+
+// lanHost name 为完整域名，suffix 为 "::1234" 这样的主机部分，mac 不为空时按 EUI-64 生成接口标识
+// mac 和 suffix 同时填写时 suffix 只用于补充子网号
+type lanHost struct {
+	Name   string `json:"name"`
+	Suffix string `json:"suffix"`
+	MAC    string `json:"mac"`
+}
+
+// verify 更新后确认解析记录已经生效
+// authoritative 为 true 时查询域名的权威服务器，resolvers 为额外查询的公共 DNS，全部返回期望的值才算生效
+type verify struct {
+	Enable         bool     `json:"enable"`
+	Authoritative  bool     `json:"authoritative"`
+	Resolvers      []string `json:"resolvers"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+// api addr 为空时不提供本地 API，可以是 "127.0.0.1:9778" 这样的本机地址，或 "unix:/run/ddns-watchdog.sock"
+// token 不为空时请求需要带上 Authorization: Bearer <token>，addr 不是本机回环地址时必须填写
+type api struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+}
+
+// web addr 为空时不提供网页管理，password 为登录密码，addr 不为空时必须填写
+type web struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+}
+
+// schedule check 不为空时代替 check_cycle_minutes，reconcile 为强制同步全部解析记录的时间
+// services 按服务名单独指定同步时间，这些服务只在自己的时间到了才同步
+// 时间可以写作 "30s"、"@every 5m"、"@daily" 或 "0 4 * * *" 这样的五段式表达式 (本地时间)
+type schedule struct {
+	Check     string            `json:"check"`
+	Reconcile string            `json:"reconcile"`
+	Services  map[string]string `json:"services"`
+}
+
 type service struct {
 	DNSPod      bool `json:"dnspod"`
 	AliDNS      bool `json:"alidns"`
 	Cloudflare  bool `json:"cloudflare"`
 	HuaweiCloud bool `json:"huawei_cloud"`
+	Volcengine  bool `json:"volcengine"`
+	BaiduCloud  bool `json:"baidu_cloud"`
+	JDCloud     bool `json:"jd_cloud"`
 }
 
 func (conf *client) InitConf() (msg string, err error) {
@@ -53,6 +178,7 @@ func (conf *client) InitConf() (msg string, err error) {
 	conf.APIUrl.Version = common.DefaultAPIUrl
 	conf.EnableIPv6Fallback = true
 	conf.CheckCycleMinutes = 0
+	conf.WatchNetwork = true
 
 	return "初始化 " + ConfDir + "/" + ConfFilename,
 		common.MarshalAndSave(conf, ConfDir+"/"+ConfFilename)
@@ -62,7 +188,11 @@ func (conf *client) LoadConf() (err error) {
 	if err = common.LoadAndUnmarshal(ConfDir+"/"+ConfFilename, &conf); err != nil {
 		return
 	}
+	return conf.check()
+}
 
+// check 校验客户端配置，网页修改配置时用于校验尚未保存的内容
+func (conf *client) check() (err error) {
 	// 检查启用 IP 类型
 	if !conf.Enable.IPv4 && !conf.Enable.IPv6 {
 		return errors.New("请打开客户端配置文件 " + ConfDir + "/" + ConfFilename + " 启用需要使用的 IP 类型并重新启动")
@@ -73,9 +203,95 @@ func (conf *client) LoadConf() (err error) {
 		!conf.Services.DNSPod &&
 		!conf.Services.AliDNS &&
 		!conf.Services.Cloudflare &&
-		!conf.Services.HuaweiCloud {
+		!conf.Services.HuaweiCloud &&
+		!conf.Services.Volcengine &&
+		!conf.Services.BaiduCloud &&
+		!conf.Services.JDCloud {
 		return errors.New("请打开客户端配置文件 " + ConfDir + "/" + ConfFilename + " 启用需要使用的服务并重新启动")
 	}
+
+	// 检查 DNS 查询方式
+	if conf.DNS.Enable {
+		for _, v := range []string{conf.DNS.IPv4, conf.DNS.IPv6} {
+			if _, ok := dnsDetectors[v]; v != "" && !ok {
+				return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 dns 不支持 " + v + "，可选 opendns, cloudflare, google")
+			}
+		}
+	}
+
+	// 检查 IP 来源
+	if err = conf.IPSources.check(); err != nil {
+		return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 ip_sources " + err.Error())
+	}
+
+	// 检查网卡地址规则
+	for _, rule := range []addrRule{conf.NetworkCard.IPv4Rule, conf.NetworkCard.IPv6Rule} {
+		if rule.Interface == "" {
+			continue
+		}
+		if err = rule.check(); err != nil {
+			return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 network_card 规则 " + rule.Interface + " " + err.Error())
+		}
+	}
+
+	// 检查网关查询方式
+	if conf.Gateway.Enable {
+		switch conf.Gateway.Method {
+		case "", gatewayMethodNATPMP, gatewayMethodPCP, gatewayMethodUPnP:
+		default:
+			return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 gateway 不支持 " + conf.Gateway.Method + "，可选 natpmp, pcp, upnp")
+		}
+	}
+
+	// 检查局域网主机
+	if conf.LANHosts.Enable {
+		if conf.Center.Enable {
+			return errors.New("lan_hosts 不支持 center 模式，请修改客户端配置文件 " + ConfDir + "/" + ConfFilename)
+		}
+		if err = conf.LANHosts.check(); err != nil {
+			return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 lan_hosts " + err.Error())
+		}
+	}
+
+	// 检查生效确认方式
+	if conf.Verify.Enable && !conf.Verify.Authoritative && len(conf.Verify.Resolvers) == 0 {
+		return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 verify 需要启用 authoritative 或填写 resolvers")
+	}
+
+	// 检查计划
+	if err = conf.Schedule.check(conf.Services, conf.Center.Enable); err != nil {
+		return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 schedule " + err.Error())
+	}
+
+	// 检查日志配置
+	if err = conf.Log.Check(); err != nil {
+		return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 log " + err.Error())
+	}
+
+	// 检查通知配置
+	if err = conf.Notify.Check(); err != nil {
+		return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 notify " + err.Error())
+	}
+
+	// 检查本地 API
+	if err = conf.API.check(); err != nil {
+		return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 api " + err.Error())
+	}
+
+	// 检查网页管理
+	if err = conf.Web.check(); err != nil {
+		return errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 web " + err.Error())
+	}
+
+	// 检查 record_set 支持的服务
+	if conf.RecordSet.Enable {
+		if conf.Center.Enable {
+			return errors.New("record_set 不支持 center 模式，请修改客户端配置文件 " + ConfDir + "/" + ConfFilename)
+		}
+		if conf.Services.Volcengine || conf.Services.BaiduCloud || conf.Services.JDCloud {
+			return errors.New("record_set 目前仅支持 dnspod, alidns, cloudflare, huawei_cloud，请修改客户端配置文件 " + ConfDir + "/" + ConfFilename)
+		}
+	}
 	return
 }
 
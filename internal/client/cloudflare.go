@@ -7,18 +7,23 @@ import (
 	"errors"
 	"io"
 	"net/http"
-
-	"github.com/bitly/go-simplejson"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	CloudflareConfFilename = "cloudflare.json"
 	cloudflarePrefix       = "Cloudflare: "
+	cloudflareEndpoint     = "https://api.cloudflare.com/client/v4"
+	cloudflarePageSize     = 100
 )
 
 type Cloudflare struct {
 	ZoneID   string           `json:"zone_id"`
 	APIToken string           `json:"api_token"`
+	Endpoint string           `json:"endpoint"`
 	Domain   common.Subdomain `json:"domain"`
 	Proxied  bool             `json:"proxied"`
 }
@@ -31,6 +36,27 @@ type cloudflareUpdateRequest struct {
 	Ttl     int    `json:"ttl"`
 }
 
+type cloudflareResp struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Error      string          `json:"error"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+type cloudflareRecord struct {
+	Id      string `json:"id"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
 func (cfc *Cloudflare) InitConf() (msg string, err error) {
 	*cfc = Cloudflare{
 		ZoneID:   "在你域名页面的右下角有个区域 ID",
@@ -49,103 +75,141 @@ func (cfc *Cloudflare) LoadConf() (err error) {
 	if err = common.LoadAndUnmarshal(ConfDir+"/"+CloudflareConfFilename, &cfc); err != nil {
 		return
 	}
+	return cfc.check()
+}
 
+func (cfc *Cloudflare) check() error {
 	if cfc.ZoneID == "" || cfc.APIToken == "" || (cfc.Domain.A == "" && cfc.Domain.AAAA == "") {
 		return errors.New("请打开配置文件 " + ConfDir + "/" + CloudflareConfFilename + " 检查你的 zone_id, api_token, domain 并重新启动")
 	}
-	return
+	return nil
 }
 
 func (cfc *Cloudflare) Run(enabled common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
 	if ipv4 != "" && enabled.IPv4 && cfc.Domain.A != "" {
-		// 获取解析记录
-		domainId, recordIP, err := cfc.getParseRecord(cfc.Domain.A, "A")
-		if err != nil {
+		if m, err := cfc.syncParseRecord(ipv4, "A", cfc.Domain.A); err != nil {
 			errs = append(errs, err)
-		} else if recordIP != ipv4 {
-			// 更新解析记录
-			if err = cfc.updateParseRecord(ipv4, domainId, "A", cfc.Domain.A); err != nil {
-				errs = append(errs, err)
-			} else {
-				msg = append(msg, cloudflarePrefix+cfc.Domain.A+" 已更新解析记录 "+ipv4)
-			}
+		} else if m != "" {
+			msg = append(msg, m)
 		}
 	}
 	if ipv6 != "" && enabled.IPv6 && cfc.Domain.AAAA != "" {
-		// 获取解析记录
-		domainId, recordIP, err := cfc.getParseRecord(cfc.Domain.AAAA, "AAAA")
-		if err != nil {
+		if m, err := cfc.syncParseRecord(ipv6, "AAAA", cfc.Domain.AAAA); err != nil {
 			errs = append(errs, err)
-		} else if recordIP != ipv6 {
-			// 更新解析记录
-			if err = cfc.updateParseRecord(ipv6, domainId, "AAAA", cfc.Domain.AAAA); err != nil {
-				errs = append(errs, err)
-			} else {
-				msg = append(msg, cloudflarePrefix+cfc.Domain.AAAA+" 已更新解析记录 "+ipv6)
-			}
+		} else if m != "" {
+			msg = append(msg, m)
 		}
 	}
 	return
 }
 
-func (cfc *Cloudflare) getParseRecord(domain, recordType string) (domainId, recordIP string, err error) {
-	url := "https://api.cloudflare.com/client/v4/zones/" + cfc.ZoneID + "/dns_records?name=" + domain
-	req, err := httpNewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return
-	}
+// RunSet 同步整组解析记录，使同名记录恰好为 ipv4s 和 ipv6s
+func (cfc *Cloudflare) RunSet(enabled common.Enable, ipv4s, ipv6s []string) (msg []string, errs []error) {
+	return runRecordSet(enabled, cfc.Domain, ipv4s, ipv6s, cfc.syncRecordSet)
+}
 
-	req.Header.Set("Authorization", "Bearer "+cfc.APIToken)
-	req.Header.Set("Content-Type", "application/json")
+func (cfc *Cloudflare) syncRecordSet(recordType, domain string, values []string) ([]string, []error) {
+	return syncRecordSet(cloudflarePrefix, domain, values, recordSetOps{
+		provider:   common.Cloudflare,
+		recordType: recordType,
+		list: func() ([]setRecord, error) {
+			return cfc.listParseRecords(domain, recordType)
+		},
+		create: func(value string) error {
+			return cfc.updateParseRecord(value, "", recordType, domain)
+		},
+		update: func(rec setRecord, value string) error {
+			return cfc.updateParseRecord(value, rec.id, recordType, domain)
+		},
+		remove: func(rec setRecord) error {
+			return cfc.deleteParseRecord(rec.id)
+		},
+	})
+}
 
-	resp, err := common.DefaultHttpClient.Do(req)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
+// RunHosts 为局域网主机发布 AAAA 记录
+func (cfc *Cloudflare) RunHosts(hosts []common.HostAddr) (msg []string, errs []error) {
+	return runHosts(cloudflarePrefix, hosts, func(fqdn string) (string, error) {
+		return strings.TrimSuffix(fqdn, "."), nil
+	}, cfc.syncParseRecord)
+}
 
-	respJson, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return
-	}
+// RecordNames 返回 A 和 AAAA 记录的完整域名
+func (cfc *Cloudflare) RecordNames() common.Subdomain {
+	return common.Subdomain{A: cfc.Domain.A, AAAA: cfc.Domain.AAAA}
+}
 
-	jsonObj, err := simplejson.NewJson(respJson)
-	if err != nil {
-		return
-	}
+func (cfc *Cloudflare) syncParseRecord(ipAddr, recordType, domain string) (msg string, err error) {
+	ev := updateEvent{provider: common.Cloudflare, record: domain, recordType: recordType, newIP: ipAddr}
+	defer func() { err = ev.done(msg != "", err) }()
 
-	if errMsg := jsonObj.Get("error").MustString(); errMsg != "" {
-		err = errors.New(cloudflarePrefix + errMsg)
-		return
-	}
-	if !jsonObj.Get("success").MustBool() {
-		err = errors.New(cloudflarePrefix + "身份认证似乎有问题")
-		return
+	// 获取解析记录
+	domainId, recordIP, err := cfc.getParseRecord(domain, recordType)
+	ev.oldIP = recordIP
+	switch {
+	case err != nil:
+	case domainId == "":
+		// 新建解析记录
+		if err = cfc.updateParseRecord(ipAddr, "", recordType, domain); err == nil {
+			msg = cloudflarePrefix + domain + " 已新建解析记录 " + ipAddr
+		}
+	case recordIP != ipAddr:
+		// 更新解析记录
+		if err = cfc.updateParseRecord(ipAddr, domainId, recordType, domain); err == nil {
+			msg = cloudflarePrefix + domain + " 已更新解析记录 " + ipAddr
+		}
 	}
+	return
+}
 
-	records, err := jsonObj.Get("result").Array()
-	if len(records) == 0 {
-		err = errors.New(cloudflarePrefix + domain + " 解析记录不存在")
+func (cfc *Cloudflare) getParseRecord(domain, recordType string) (domainId, recordIP string, err error) {
+	records, err := cfc.listParseRecords(domain, recordType)
+	// 解析记录不存在时 domainId 为空
+	if err != nil || len(records) == 0 {
 		return
 	}
+	return records[0].id, records[0].value, nil
+}
 
-	for _, v := range records {
-		element := v.(map[string]any)
-		if element["name"].(string) == domain && element["type"].(string) == recordType {
-			domainId = element["id"].(string)
-			recordIP = element["content"].(string)
-			break
+func (cfc *Cloudflare) listParseRecords(domain, recordType string) (records []setRecord, err error) {
+	// 按名称和类型在服务端过滤，并按页遍历
+	for page := 1; ; page++ {
+		query := url.Values{
+			"name":     {domain},
+			"type":     {recordType},
+			"page":     {strconv.Itoa(page)},
+			"per_page": {strconv.Itoa(cloudflarePageSize)},
+		}
+
+		var res cloudflareResp
+		res, err = cfc.request(http.MethodGet, "/dns_records?"+query.Encode(), nil)
+		if err != nil {
+			return
 		}
-	}
 
-	if domainId == "" || recordIP == "" {
-		err = errors.New(cloudflarePrefix + domain + " 的 " + recordType + " 解析记录不存在")
+		var result []cloudflareRecord
+		if err = json.Unmarshal(res.Result, &result); err != nil {
+			return
+		}
+
+		for _, v := range result {
+			if v.Name == domain && v.Type == recordType {
+				records = append(records, setRecord{id: v.Id, value: v.Content})
+			}
+		}
+
+		if len(result) == 0 || page >= res.ResultInfo.TotalPages {
+			return
+		}
 	}
-	return
 }
 
+// updateParseRecord domainId 为空时新建解析记录
 func (cfc *Cloudflare) updateParseRecord(ipAddr, domainId, recordType, domain string) (err error) {
-	url := "https://api.cloudflare.com/client/v4/zones/" + cfc.ZoneID + "/dns_records/" + domainId
+	method, path := http.MethodPut, "/dns_records/"+domainId
+	if domainId == "" {
+		method, path = http.MethodPost, "/dns_records"
+	}
 	reqData := cloudflareUpdateRequest{
 		Type:    recordType,
 		Name:    domain,
@@ -154,12 +218,24 @@ func (cfc *Cloudflare) updateParseRecord(ipAddr, domainId, recordType, domain st
 		Ttl:     1,
 	}
 
-	reqJson, err := json.Marshal(reqData)
-	if err != nil {
-		return
+	_, err = cfc.request(method, path, reqData)
+	return
+}
+
+func (cfc *Cloudflare) deleteParseRecord(domainId string) (err error) {
+	_, err = cfc.request(http.MethodDelete, "/dns_records/"+domainId, nil)
+	return
+}
+
+func (cfc *Cloudflare) request(method, path string, body any) (res cloudflareResp, err error) {
+	var reqJson []byte
+	if body != nil {
+		if reqJson, err = json.Marshal(body); err != nil {
+			return
+		}
 	}
 
-	req, err := httpNewRequest(http.MethodPut, url, bytes.NewReader(reqJson))
+	req, err := httpNewRequest(method, endpointOr(cfc.Endpoint, cloudflareEndpoint)+"/zones/"+cfc.ZoneID+path, bytes.NewReader(reqJson))
 	if err != nil {
 		return
 	}
@@ -167,7 +243,9 @@ func (cfc *Cloudflare) updateParseRecord(ipAddr, domainId, recordType, domain st
 	req.Header.Set("Authorization", "Bearer "+cfc.APIToken)
 	req.Header.Set("Content-Type", "application/json")
 
+	start := time.Now()
 	resp, err := common.DefaultHttpClient.Do(req)
+	observeAPI(common.Cloudflare, start)
 	if err != nil {
 		return
 	}
@@ -178,32 +256,24 @@ func (cfc *Cloudflare) updateParseRecord(ipAddr, domainId, recordType, domain st
 		return
 	}
 
-	jsonObj, err := simplejson.NewJson(respJson)
-	if err != nil {
+	if err = json.Unmarshal(respJson, &res); err != nil {
 		return
 	}
 
-	if getErr := jsonObj.Get("error").MustString(); getErr != "" {
-		err = errors.New(getErr)
+	if res.Error != "" {
+		err = errors.New(cloudflarePrefix + res.Error)
 		return
 	}
-
-	if !jsonObj.Get("success").MustBool() {
-		var errorsMsg string
-		errorsArr, getErr := jsonObj.Get("errors").Array()
-		if getErr != nil {
-			err = getErr
+	if !res.Success {
+		if len(res.Errors) == 0 {
+			err = errors.New(cloudflarePrefix + "身份认证似乎有问题")
 			return
 		}
-
-		for _, value := range errorsArr {
-			element := value.(map[string]any)
-			errCode := element["code"].(json.Number)
-			errMsg := element["message"].(string)
-			errorsMsg = errorsMsg + cloudflarePrefix + errCode.String() + ": " + errMsg + "\n"
+		var errorsMsg []string
+		for _, v := range res.Errors {
+			errorsMsg = append(errorsMsg, cloudflarePrefix+strconv.Itoa(v.Code)+": "+v.Message)
 		}
-
-		err = errors.New(errorsMsg)
+		err = errors.New(strings.Join(errorsMsg, "\n"))
 	}
 	return
 }
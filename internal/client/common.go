@@ -4,6 +4,7 @@ import (
 	"ddns-watchdog/internal/common"
 	"io"
 	"net/http"
+	"strings"
 )
 
 const (
@@ -19,11 +20,35 @@ func httpGet(url string) (*http.Response, error) {
 	return common.DefaultHttpClient.Do(req)
 }
 
+// ipHttpGet 强制通过对应协议请求，保证 API 看到的是该协议的地址
+func ipHttpGet(url string, ipv6 bool) (*http.Response, error) {
+	req, err := httpNewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ipHttpClient(ipv6).Do(req)
+}
+
+func ipHttpClient(ipv6 bool) *http.Client {
+	if ipv6 {
+		return common.IPv6HttpClient
+	}
+	return common.IPv4HttpClient
+}
+
 func httpNewRequest(method, url string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(requestCtx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", projName+"/"+common.Version)
 	return req, nil
 }
+
+// endpointOr 配置了 endpoint 时使用配置的 API 地址，否则使用默认地址
+func endpointOr(endpoint, defaultEndpoint string) string {
+	if endpoint == "" {
+		return defaultEndpoint
+	}
+	return strings.TrimSuffix(endpoint, "/")
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+type providerConf interface {
+	confChecker
+	RecordNames() common.Subdomain
+}
+
+// TestCredential 按服务商解析配置，用其中的密钥查询一条已配置的解析记录，不做任何修改
+// 记录不存在不算失败，同步时会新建
+func TestCredential(provider string, data []byte) (msg string, err error) {
+	var (
+		conf providerConf
+		// find 查询 A 或 AAAA 记录当前的值，记录不存在时为空
+		find func(recordType string) (value string, err error)
+	)
+	switch provider {
+	case common.DNSPod:
+		p := &DNSPod{}
+		conf, find = p, func(recordType string) (value string, err error) {
+			_, _, value, err = p.getParseRecord(subdomainOf(p.SubDomain, recordType), recordType)
+			return
+		}
+	case common.AliDNS:
+		p := &AliDNS{}
+		conf, find = p, func(recordType string) (value string, err error) {
+			_, value, err = p.getParseRecord(subdomainOf(p.SubDomain, recordType), recordType)
+			return
+		}
+	case common.Cloudflare:
+		p := &Cloudflare{}
+		conf, find = p, func(recordType string) (value string, err error) {
+			_, value, err = p.getParseRecord(subdomainOf(p.Domain, recordType), recordType)
+			return
+		}
+	case common.HuaweiCloud:
+		p := &HuaweiCloud{}
+		conf, find = p, func(recordType string) (value string, err error) {
+			if err = p.getZoneId(); err != nil {
+				return
+			}
+			_, records, err := p.getParseRecord(subdomainOf(p.Domain, recordType), recordType)
+			return strings.Join(records, ","), err
+		}
+	case common.Volcengine:
+		p := &Volcengine{}
+		conf, find = p, func(recordType string) (value string, err error) {
+			if err = p.getZoneId(); err != nil {
+				return
+			}
+			record, err := p.getParseRecord(subdomainOf(p.SubDomain, recordType), recordType)
+			return record.Value, err
+		}
+	case common.BaiduCloud:
+		p := &BaiduCloud{}
+		conf, find = p, func(recordType string) (value string, err error) {
+			record, err := p.getParseRecord(subdomainOf(p.SubDomain, recordType), recordType)
+			return record.Rdata, err
+		}
+	case common.JDCloud:
+		p := &JDCloud{}
+		conf, find = p, func(recordType string) (value string, err error) {
+			if err = p.getDomainId(); err != nil {
+				return
+			}
+			record, err := p.getParseRecord(subdomainOf(p.SubDomain, recordType), recordType)
+			return record.HostValue, err
+		}
+	default:
+		return "", errors.New("不支持的服务 " + provider)
+	}
+
+	if err = json.Unmarshal(data, conf); err != nil {
+		return
+	}
+	if err = conf.check(); err != nil {
+		return
+	}
+
+	recordType, name := "A", conf.RecordNames().A
+	if name == "" {
+		recordType, name = "AAAA", conf.RecordNames().AAAA
+	}
+	value, err := find(recordType)
+	if err != nil {
+		return
+	}
+	if value == "" {
+		return "密钥可用，" + name + " 还没有 " + recordType + " 记录，同步时会新建", nil
+	}
+	return "密钥可用，" + name + " 的 " + recordType + " 记录为 " + value, nil
+}
+
+// subdomainOf 按记录类型取配置中的名称
+func subdomainOf(names common.Subdomain, recordType string) string {
+	if recordType == "AAAA" {
+		return names.AAAA
+	}
+	return names.A
+}
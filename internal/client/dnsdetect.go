@@ -0,0 +1,251 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTypeA    uint16 = 1
+	dnsTypeTXT  uint16 = 16
+	dnsTypeAAAA uint16 = 28
+	dnsClassIN  uint16 = 1
+	dnsClassCH  uint16 = 3
+
+	dnsDetectTimeout = 5 * time.Second
+	dnsMaxMessage    = 1232
+)
+
+// dnsDetector 通过向特定权威服务器查询特殊域名得到本机公网 IP
+type dnsDetector struct {
+	name  string
+	qtype uint16
+	// qtypeV6 查询 IPv6 时使用的记录类型
+	qtypeV6 uint16
+	qclass  uint16
+	server4 string
+	server6 string
+}
+
+// dnsDetectors 可以在 client.json 的 dns 中选择的查询方式
+var dnsDetectors = map[string]dnsDetector{
+	"opendns": {
+		name:    "myip.opendns.com",
+		qtype:   dnsTypeA,
+		qtypeV6: dnsTypeAAAA,
+		qclass:  dnsClassIN,
+		server4: "208.67.222.222:53",
+		server6: "[2620:119:35::35]:53",
+	},
+	"cloudflare": {
+		name:    "whoami.cloudflare",
+		qtype:   dnsTypeTXT,
+		qtypeV6: dnsTypeTXT,
+		qclass:  dnsClassCH,
+		server4: "1.1.1.1:53",
+		server6: "[2606:4700:4700::1111]:53",
+	},
+	"google": {
+		name:    "o-o.myaddr.l.google.com",
+		qtype:   dnsTypeTXT,
+		qtypeV6: dnsTypeTXT,
+		qclass:  dnsClassIN,
+		server4: "216.239.32.10:53",
+		server6: "[2001:4860:4802:32::a]:53",
+	},
+}
+
+// getIPByDNS 按 detector 查询本机 IP，查询通过对应协议的 UDP 发出
+func getIPByDNS(detector string, ipv6 bool) (ip string, err error) {
+	d, ok := dnsDetectors[detector]
+	if !ok {
+		return "", errors.New("dns 不支持 " + detector + "，可选 opendns, cloudflare, google")
+	}
+
+	network, server, qtype := "udp4", d.server4, d.qtype
+	if ipv6 {
+		network, server, qtype = "udp6", d.server6, d.qtypeV6
+	}
+
+	answers, err := dnsQuery(network, server, d.name, qtype, d.qclass, false)
+	if err != nil {
+		return "", errors.New("dns " + detector + ": " + err.Error())
+	}
+
+	// TXT 记录里可能还有其他信息，取第一个对应类型的地址
+	for _, v := range answers {
+		if ip, err = normalizeIP(v, ipv6); err == nil {
+			return
+		}
+	}
+	return "", errors.New("dns " + detector + ": 响应中没有本机地址")
+}
+
+// dnsQuery 发出一次 DNS 查询，A / AAAA 记录返回地址，TXT 记录返回拼接后的文本
+// 向权威服务器查询时 rd 为 false，向公共 DNS 查询时需要请求递归
+func dnsQuery(network, server, name string, qtype, qclass uint16, rd bool) (answers []string, err error) {
+	conn, err := net.DialTimeout(network, server, dnsDetectTimeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(dnsDetectTimeout)); err != nil {
+		return
+	}
+
+	var id [2]byte
+	_, _ = rand.Read(id[:])
+	query, err := dnsBuildQuery(binary.BigEndian.Uint16(id[:]), name, qtype, qclass, rd)
+	if err != nil {
+		return
+	}
+	if _, err = conn.Write(query); err != nil {
+		return
+	}
+
+	buf := make([]byte, dnsMaxMessage)
+	for {
+		var n int
+		n, err = conn.Read(buf)
+		if err != nil {
+			return
+		}
+		// 忽略不是这次查询的响应
+		if n < 2 || binary.BigEndian.Uint16(buf) != binary.BigEndian.Uint16(id[:]) {
+			continue
+		}
+		return dnsParseResponse(buf[:n], qtype)
+	}
+}
+
+func dnsBuildQuery(id uint16, name string, qtype, qclass uint16, rd bool) ([]byte, error) {
+	msg := make([]byte, 12, 12+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	if rd {
+		msg[2] = 0x01 // RD
+	}
+	binary.BigEndian.PutUint16(msg[4:], 1) // QDCOUNT
+
+	for label := range strings.SplitSeq(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, errors.New("域名格式错误 " + name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, qclass)
+	return msg, nil
+}
+
+var errDNSMessage = errors.New("DNS 响应格式错误")
+
+func dnsParseResponse(msg []byte, qtype uint16) (answers []string, err error) {
+	if len(msg) < 12 {
+		return nil, errDNSMessage
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	switch {
+	case flags&0x8000 == 0:
+		return nil, errDNSMessage
+	case flags&0x0200 != 0:
+		return nil, errors.New("DNS 响应被截断")
+	case flags&0x000f != 0:
+		return nil, errors.New("DNS 响应码 " + dnsRcodeText(flags&0x000f))
+	}
+	qdCount := binary.BigEndian.Uint16(msg[4:])
+	anCount := binary.BigEndian.Uint16(msg[6:])
+
+	off := 12
+	for range qdCount {
+		if off, err = dnsSkipName(msg, off); err != nil {
+			return
+		}
+		off += 4
+	}
+
+	for range anCount {
+		if off, err = dnsSkipName(msg, off); err != nil {
+			return
+		}
+		if off+10 > len(msg) {
+			return nil, errDNSMessage
+		}
+		rrType := binary.BigEndian.Uint16(msg[off:])
+		rdLength := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdLength > len(msg) {
+			return nil, errDNSMessage
+		}
+		rdata := msg[off : off+rdLength]
+		off += rdLength
+
+		// 跳过 CNAME 等其他类型
+		if rrType != qtype {
+			continue
+		}
+		switch rrType {
+		case dnsTypeA, dnsTypeAAAA:
+			if addr, ok := netip.AddrFromSlice(rdata); ok {
+				answers = append(answers, addr.String())
+			}
+		case dnsTypeTXT:
+			var txt strings.Builder
+			for i := 0; i < len(rdata); {
+				l := int(rdata[i])
+				if i+1+l > len(rdata) {
+					return nil, errDNSMessage
+				}
+				txt.Write(rdata[i+1 : i+1+l])
+				i += 1 + l
+			}
+			answers = append(answers, txt.String())
+		}
+	}
+	return
+}
+
+// dnsSkipName 跳过可能带压缩指针的域名，返回其后的偏移
+func dnsSkipName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errDNSMessage
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			if off+2 > len(msg) {
+				return 0, errDNSMessage
+			}
+			return off + 2, nil
+		case l&0xc0 != 0:
+			return 0, errDNSMessage
+		}
+		off += 1 + l
+	}
+}
+
+func dnsRcodeText(rcode uint16) string {
+	switch rcode {
+	case 1:
+		return "FORMERR"
+	case 2:
+		return "SERVFAIL"
+	case 3:
+		return "NXDOMAIN"
+	case 4:
+		return "NOTIMP"
+	case 5:
+		return "REFUSED"
+	}
+	return strconv.Itoa(int(rcode))
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// startFakeDNS 回复一条指定类型的记录，并校验查询的类型和类别
+func startFakeDNS(t *testing.T, qtype, qclass uint16, rdata []byte) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			resp := append([]byte{}, query...)
+			resp[2], resp[3] = 0x84, 0x00 // QR AA
+			gotType := binary.BigEndian.Uint16(query[n-4:])
+			gotClass := binary.BigEndian.Uint16(query[n-2:])
+			if gotType != qtype || gotClass != qclass {
+				resp[3] = 0x03 // NXDOMAIN
+				_, _ = conn.WriteTo(resp, addr)
+				continue
+			}
+			binary.BigEndian.PutUint16(resp[6:], 2) // ANCOUNT
+			// 先放一条 CNAME，确认会被跳过
+			resp = append(resp, 0xc0, 0x0c)
+			resp = binary.BigEndian.AppendUint16(resp, 5)
+			resp = binary.BigEndian.AppendUint16(resp, qclass)
+			resp = binary.BigEndian.AppendUint32(resp, 0)
+			resp = binary.BigEndian.AppendUint16(resp, 2)
+			resp = append(resp, 0xc0, 0x0c)
+			resp = append(resp, 0xc0, 0x0c)
+			resp = binary.BigEndian.AppendUint16(resp, qtype)
+			resp = binary.BigEndian.AppendUint16(resp, qclass)
+			resp = binary.BigEndian.AppendUint32(resp, 0)
+			resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+			resp = append(resp, rdata...)
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestGetIPByDNS(t *testing.T) {
+	txt := func(parts ...string) (b []byte) {
+		for _, p := range parts {
+			b = append(b, byte(len(p)))
+			b = append(b, p...)
+		}
+		return
+	}
+
+	tests := []struct {
+		name     string
+		detector dnsDetector
+		rdata    []byte
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "A",
+			detector: dnsDetector{name: "myip.opendns.com", qtype: dnsTypeA, qclass: dnsClassIN},
+			rdata:    []byte{192, 0, 2, 1},
+			want:     "192.0.2.1",
+		},
+		{
+			name:     "TXT CH",
+			detector: dnsDetector{name: "whoami.cloudflare", qtype: dnsTypeTXT, qclass: dnsClassCH},
+			rdata:    txt("192.0.2.", "2"),
+			want:     "192.0.2.2",
+		},
+		{
+			name:     "TXT without address",
+			detector: dnsDetector{name: "o-o.myaddr.l.google.com", qtype: dnsTypeTXT, qclass: dnsClassIN},
+			rdata:    txt("edns0-client-subnet 192.0.2.0/24"),
+			wantErr:  true,
+		},
+		{
+			name:     "truncated rdata",
+			detector: dnsDetector{name: "o-o.myaddr.l.google.com", qtype: dnsTypeTXT, qclass: dnsClassIN},
+			rdata:    []byte{9, '1'},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.detector.server4 = startFakeDNS(t, tt.detector.qtype, tt.detector.qclass, tt.rdata)
+			dnsDetectors["test"] = tt.detector
+			t.Cleanup(func() { delete(dnsDetectors, "test") })
+
+			got, err := getIPByDNS("test", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
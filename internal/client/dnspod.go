@@ -2,22 +2,28 @@ package client
 
 import (
 	"ddns-watchdog/internal/common"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
-
-	"github.com/bitly/go-simplejson"
+	"time"
 )
 
 const (
 	DNSPodConfFilename = "dnspod.json"
 	dnsPodPrefix       = "DNSPod: "
+	dnsPodEndpoint     = "https://dnsapi.cn"
+	dnsPodDefaultLine  = "0"
+	dnsPodPageSize     = 100
 )
 
 type DNSPod struct {
 	ID        string           `json:"id"`
 	Token     string           `json:"token"`
+	Endpoint  string           `json:"endpoint"`
 	Domain    string           `json:"domain"`
 	SubDomain common.Subdomain `json:"sub_domain"`
 }
@@ -41,131 +47,240 @@ func (dpc *DNSPod) LoadConf() (err error) {
 	if err = common.LoadAndUnmarshal(ConfDir+"/"+DNSPodConfFilename, &dpc); err != nil {
 		return
 	}
+	return dpc.check()
+}
 
+func (dpc *DNSPod) check() error {
 	if dpc.ID == "" || dpc.Token == "" || dpc.Domain == "" || (dpc.SubDomain.A == "" && dpc.SubDomain.AAAA == "") {
 		return errors.New("请打开配置文件 " + ConfDir + "/" + DNSPodConfFilename + " 检查你的 id, token, domain, sub_domain 并重新启动")
 	}
-	return
+	return nil
 }
 
 func (dpc *DNSPod) Run(enabled common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
 	if ipv4 != "" && enabled.IPv4 && dpc.SubDomain.A != "" {
-		// 获取解析记录
-		recordId, recordLineId, recordIP, err := dpc.getParseRecord(dpc.SubDomain.A, "A")
-		if err != nil {
+		if m, err := dpc.syncParseRecord(ipv4, "A", dpc.SubDomain.A); err != nil {
 			errs = append(errs, err)
-		} else if recordIP != ipv4 {
-			// 更新解析记录
-			if err = dpc.updateParseRecord(ipv4, recordId, recordLineId, "A", dpc.SubDomain.A); err != nil {
-				errs = append(errs, err)
-			} else {
-				msg = append(msg, dnsPodPrefix+dpc.SubDomain.A+"."+dpc.Domain+" 已更新解析记录 "+ipv4)
-			}
+		} else if m != "" {
+			msg = append(msg, m)
 		}
 	}
 	if ipv6 != "" && enabled.IPv6 && dpc.SubDomain.AAAA != "" {
-		// 获取解析记录
-		recordId, recordLineId, recordIP, err := dpc.getParseRecord(dpc.SubDomain.AAAA, "AAAA")
-		if err != nil {
+		if m, err := dpc.syncParseRecord(ipv6, "AAAA", dpc.SubDomain.AAAA); err != nil {
 			errs = append(errs, err)
-		} else if recordIP != ipv6 {
-			// 更新解析记录
-			if err = dpc.updateParseRecord(ipv6, recordId, recordLineId, "AAAA", dpc.SubDomain.AAAA); err != nil {
-				errs = append(errs, err)
-			} else {
-				msg = append(msg, dnsPodPrefix+dpc.SubDomain.AAAA+"."+dpc.Domain+" 已更新解析记录 "+ipv6)
-			}
+		} else if m != "" {
+			msg = append(msg, m)
 		}
 	}
 	return
 }
 
-func checkRespondStatus(jsonObj *simplejson.Json) (err error) {
-	statusCode := jsonObj.Get("status").Get("code").MustString()
-	if statusCode != "1" {
-		return errors.New(dnsPodPrefix + statusCode + ": " + jsonObj.Get("status").Get("message").MustString())
+// RunSet 同步整组解析记录，使同名记录恰好为 ipv4s 和 ipv6s
+func (dpc *DNSPod) RunSet(enabled common.Enable, ipv4s, ipv6s []string) (msg []string, errs []error) {
+	return runRecordSet(enabled, dpc.SubDomain, ipv4s, ipv6s, dpc.syncRecordSet)
+}
+
+func (dpc *DNSPod) syncRecordSet(recordType, subDomain string, values []string) ([]string, []error) {
+	return syncRecordSet(dnsPodPrefix, subDomain+"."+dpc.Domain, values, recordSetOps{
+		provider:   common.DNSPod,
+		recordType: recordType,
+		list: func() ([]setRecord, error) {
+			return dpc.listParseRecords(subDomain, recordType)
+		},
+		create: func(value string) error {
+			return dpc.createParseRecord(value, recordType, subDomain)
+		},
+		update: func(rec setRecord, value string) error {
+			return dpc.updateParseRecord(value, rec.id, rec.line, recordType, subDomain)
+		},
+		remove: func(rec setRecord) error {
+			return dpc.deleteParseRecord(rec.id)
+		},
+	})
+}
+
+// RunHosts 为局域网主机发布 AAAA 记录，主机的完整域名需要属于 domain
+func (dpc *DNSPod) RunHosts(hosts []common.HostAddr) (msg []string, errs []error) {
+	return runHosts(dnsPodPrefix, hosts, func(fqdn string) (string, error) {
+		return subDomainOf(fqdn, dpc.Domain)
+	}, dpc.syncParseRecord)
+}
+
+// RecordNames 返回 A 和 AAAA 记录的完整域名
+func (dpc *DNSPod) RecordNames() common.Subdomain {
+	return common.Subdomain{A: fqdnOf(dpc.SubDomain.A, dpc.Domain), AAAA: fqdnOf(dpc.SubDomain.AAAA, dpc.Domain)}
+}
+
+func (dpc *DNSPod) syncParseRecord(ipAddr, recordType, subDomain string) (msg string, err error) {
+	ev := updateEvent{provider: common.DNSPod, record: fqdnOf(subDomain, dpc.Domain), recordType: recordType, newIP: ipAddr}
+	defer func() { err = ev.done(msg != "", err) }()
+
+	// 获取解析记录
+	recordId, recordLineId, recordIP, err := dpc.getParseRecord(subDomain, recordType)
+	ev.oldIP = recordIP
+	switch {
+	case err != nil:
+	case recordId == "":
+		// 新建解析记录
+		if err = dpc.createParseRecord(ipAddr, recordType, subDomain); err == nil {
+			msg = dnsPodPrefix + subDomain + "." + dpc.Domain + " 已新建解析记录 " + ipAddr
+		}
+	case recordIP != ipAddr:
+		// 更新解析记录
+		if err = dpc.updateParseRecord(ipAddr, recordId, recordLineId, recordType, subDomain); err == nil {
+			msg = dnsPodPrefix + subDomain + "." + dpc.Domain + " 已更新解析记录 " + ipAddr
+		}
 	}
 	return
 }
 
-func (dpc *DNSPod) getParseRecord(subDomain, recordType string) (recordId, recordLineId, recordIP string, err error) {
-	postContent := dpc.publicRequestInit()
-	postContent = postContent + "&" + dpc.recordRequestInit(subDomain)
+// dnsPodString DNSPod 的数字字段时而是字符串时而是数字，统一按字符串处理
+type dnsPodString string
 
-	respJson, err := postman("https://dnsapi.cn/Record.List", postContent)
-	if err != nil {
-		return
+func (s *dnsPodString) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var v string
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		*s = dnsPodString(v)
+		return nil
 	}
-
-	jsonObj, err := simplejson.NewJson(respJson)
-	if err != nil {
-		return
+	var v json.Number
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
 	}
+	*s = dnsPodString(v)
+	return nil
+}
 
-	if err = checkRespondStatus(jsonObj); err != nil {
-		return
+type dnsPodStatus struct {
+	Code    dnsPodString `json:"code"`
+	Message string       `json:"message"`
+}
+
+type dnsPodResp struct {
+	Status dnsPodStatus `json:"status"`
+}
+
+type dnsPodRecordListResp struct {
+	Status dnsPodStatus `json:"status"`
+	Info   struct {
+		RecordTotal dnsPodString `json:"record_total"`
+	} `json:"info"`
+	Records []struct {
+		Id     dnsPodString `json:"id"`
+		Name   string       `json:"name"`
+		Type   string       `json:"type"`
+		Value  string       `json:"value"`
+		LineId dnsPodString `json:"line_id"`
+	} `json:"records"`
+}
+
+func (s dnsPodStatus) check() (err error) {
+	if s.Code != "1" {
+		return errors.New(dnsPodPrefix + string(s.Code) + ": " + s.Message)
 	}
+	return
+}
 
-	records, err := jsonObj.Get("records").Array()
-	if len(records) == 0 {
-		err = errors.New(dnsPodPrefix + subDomain + "." + dpc.Domain + " 解析记录不存在")
+func (dpc *DNSPod) getParseRecord(subDomain, recordType string) (recordId, recordLineId, recordIP string, err error) {
+	records, err := dpc.listParseRecords(subDomain, recordType)
+	// 解析记录不存在时 recordId 为空
+	if err != nil || len(records) == 0 {
 		return
 	}
+	return records[0].id, records[0].line, records[0].value, nil
+}
+
+func (dpc *DNSPod) listParseRecords(subDomain, recordType string) (records []setRecord, err error) {
+	// 按子域名和类型在服务端过滤，并按页遍历
+	for offset := 0; ; {
+		postContent := dpc.publicRequestInit()
+		postContent.Set("domain", dpc.Domain)
+		postContent.Set("sub_domain", subDomain)
+		postContent.Set("record_type", recordType)
+		postContent.Set("offset", strconv.Itoa(offset))
+		postContent.Set("length", strconv.Itoa(dnsPodPageSize))
 
-	for _, value := range records {
-		element := value.(map[string]any)
-		if element["name"].(string) == subDomain && element["type"].(string) == recordType {
-			recordId = element["id"].(string)
-			recordIP = element["value"].(string)
-			recordLineId = element["line_id"].(string)
-			break
+		var respJson []byte
+		respJson, err = postman(endpointOr(dpc.Endpoint, dnsPodEndpoint)+"/Record.List", postContent.Encode())
+		if err != nil {
+			return
+		}
+
+		var res dnsPodRecordListResp
+		if err = json.Unmarshal(respJson, &res); err != nil {
+			return
+		}
+		if err = res.Status.check(); err != nil {
+			return
+		}
+
+		for _, v := range res.Records {
+			if v.Name == subDomain && v.Type == recordType {
+				records = append(records, setRecord{id: string(v.Id), value: v.Value, line: string(v.LineId)})
+			}
 		}
-	}
 
-	if recordId == "" || recordIP == "" || recordLineId == "" {
-		err = errors.New(dnsPodPrefix + subDomain + "." + dpc.Domain + " 的 " + recordType + " 解析记录不存在")
+		offset += len(res.Records)
+		total, _ := strconv.Atoi(string(res.Info.RecordTotal))
+		if len(res.Records) == 0 || offset >= total {
+			return
+		}
 	}
-	return
+}
+
+func (dpc *DNSPod) createParseRecord(ipAddr, recordType, subDomain string) (err error) {
+	postContent := dpc.publicRequestInit()
+	dpc.recordModifyRequestInit(postContent, ipAddr, "", dnsPodDefaultLine, recordType, subDomain)
+	return dpc.modify("/Record.Create", postContent)
 }
 
 func (dpc *DNSPod) updateParseRecord(ipAddr, recordId, recordLineId, recordType, subDomain string) (err error) {
 	postContent := dpc.publicRequestInit()
-	postContent = postContent + "&" + dpc.recordModifyRequestInit(ipAddr, recordId, recordLineId, recordType, subDomain)
+	dpc.recordModifyRequestInit(postContent, ipAddr, recordId, recordLineId, recordType, subDomain)
+	return dpc.modify("/Record.Modify", postContent)
+}
+
+func (dpc *DNSPod) deleteParseRecord(recordId string) (err error) {
+	postContent := dpc.publicRequestInit()
+	postContent.Set("domain", dpc.Domain)
+	postContent.Set("record_id", recordId)
+	return dpc.modify("/Record.Remove", postContent)
+}
 
-	respJson, err := postman("https://dnsapi.cn/Record.Modify", postContent)
+func (dpc *DNSPod) modify(path string, postContent url.Values) (err error) {
+	respJson, err := postman(endpointOr(dpc.Endpoint, dnsPodEndpoint)+path, postContent.Encode())
 	if err != nil {
 		return
 	}
 
-	jsonObj, err := simplejson.NewJson(respJson)
-	if err != nil {
+	var res dnsPodResp
+	if err = json.Unmarshal(respJson, &res); err != nil {
 		return
 	}
-
-	return checkRespondStatus(jsonObj)
-}
-
-func (dpc *DNSPod) publicRequestInit() (pp string) {
-	pp = "login_token=" + dpc.ID + "," + dpc.Token +
-		"&format=" + "json" +
-		"&lang=" + "cn" +
-		"&error_on_empty=" + "no"
-	return
+	return res.Status.check()
 }
 
-func (dpc *DNSPod) recordRequestInit(subDomain string) (rr string) {
-	rr = "domain=" + dpc.Domain +
-		"&sub_domain=" + subDomain
-	return
+func (dpc *DNSPod) publicRequestInit() url.Values {
+	return url.Values{
+		"login_token":    {dpc.ID + "," + dpc.Token},
+		"format":         {"json"},
+		"lang":           {"cn"},
+		"error_on_empty": {"no"},
+	}
 }
 
-func (dpc *DNSPod) recordModifyRequestInit(ipAddr, recordId, recordLineId, recordType, subDomain string) string {
-	return "domain=" + dpc.Domain +
-		"&record_id=" + recordId +
-		"&sub_domain=" + subDomain +
-		"&record_type=" + recordType +
-		"&record_line_id=" + recordLineId +
-		"&value=" + ipAddr
+func (dpc *DNSPod) recordModifyRequestInit(postContent url.Values, ipAddr, recordId, recordLineId, recordType, subDomain string) {
+	postContent.Set("domain", dpc.Domain)
+	if recordId != "" {
+		postContent.Set("record_id", recordId)
+	}
+	postContent.Set("sub_domain", subDomain)
+	postContent.Set("record_type", recordType)
+	postContent.Set("record_line_id", recordLineId)
+	postContent.Set("value", ipAddr)
 }
 
 func postman(url, src string) (dst []byte, err error) {
@@ -177,7 +292,9 @@ func postman(url, src string) (dst []byte, err error) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("User-Agent", projName+"/"+common.Version+" ()") // special for DNSPod
 
+	start := time.Now()
 	resp, err := common.DefaultHttpClient.Do(req)
+	observeAPI(common.DNSPod, start)
 	if err != nil {
 		return nil, err
 	}
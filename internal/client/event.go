@@ -0,0 +1,108 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// updateEvent 一条解析记录的同步，完成时输出日志并记录指标
+// oldIP 为空表示新建，newIP 为空表示删除，整组同步时为逗号分隔的多个值
+type updateEvent struct {
+	provider   string
+	record     string
+	recordType string
+	oldIP      string
+	newIP      string
+}
+
+// done changed 为 false 且没有错误表示无需修改，返回的错误已经输出过日志
+func (ev updateEvent) done(changed bool, err error) error {
+	attrs := []any{"provider", ev.provider, "record", ev.record, "type", ev.recordType,
+		"old_ip", ev.oldIP, "new_ip", ev.newIP}
+	switch {
+	case err != nil:
+		slog.Error("同步解析记录失败", append(attrs, "error", err)...)
+		err = loggedError{err}
+	case changed:
+		slog.Info("已同步解析记录", attrs...)
+	default:
+		slog.Debug("解析记录无需修改", attrs...)
+	}
+
+	ev.observe(changed, err)
+	return err
+}
+
+// observe 把同步结果交给通知、历史记录、本地 API 和指标，日志由调用方输出
+func (ev updateEvent) observe(changed bool, err error) {
+	result := resultUnchanged
+	switch {
+	case err != nil:
+		result = resultFailed
+	case changed:
+		result = resultUpdated
+	}
+
+	Notifier.Observe(common.NotifyResult{Provider: ev.provider, Record: ev.record, Type: ev.recordType,
+		OldIP: ev.oldIP, NewIP: ev.newIP, Changed: changed, Err: err})
+	entry := common.HistoryEntry{Time: time.Now(), Kind: common.HistoryUpdate, Provider: ev.provider,
+		Record: ev.record, Type: ev.recordType, OldIP: ev.oldIP, NewIP: ev.newIP, Result: result, Error: errorText(err)}
+	History.Append(entry)
+	setRecordStatus(entry)
+	metricUpdates.Inc(ev.provider, ev.record, ev.recordType, result)
+	if result != resultFailed {
+		metricLastSuccess.Set(float64(time.Now().Unix()), ev.provider)
+	}
+}
+
+// observeVerify 记录一条解析记录是否已经生效，未生效时记录的状态显示为 failed
+func observeVerify(provider string, rec ExpectedRecord, err error) {
+	result := resultVerified
+	if err != nil {
+		result = resultFailed
+	}
+	entry := common.HistoryEntry{Time: time.Now(), Kind: common.HistoryVerify, Provider: provider,
+		Record: rec.Name, Type: rec.Type, NewIP: strings.Join(rec.Values, ","), Result: result, Error: errorText(err)}
+	History.Append(entry)
+	setRecordStatus(entry)
+	metricVerify.Inc(provider, rec.Name, rec.Type, result)
+}
+
+// ObserveDetect 记录一次获取 IP 的结果，用于通知、历史记录和本地 API
+func ObserveDetect(ipv4, ipv6 string, err error) {
+	ips := strings.Trim(ipv4+","+ipv6, ",")
+	Notifier.Observe(common.NotifyResult{Provider: common.NotifyDetect, NewIP: ips, Err: err})
+	result := "ok"
+	if err != nil {
+		result = resultFailed
+	}
+	entry := common.HistoryEntry{Time: time.Now(), Kind: common.HistoryDetect, NewIP: ips, Result: result,
+		Error: errorText(err)}
+	History.Append(entry)
+	setDetectStatus(entry)
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// loggedError 已经输出过日志的错误
+type loggedError struct {
+	error
+}
+
+func (e loggedError) Unwrap() error {
+	return e.error
+}
+
+// Logged 错误是否已经输出过日志，调用方不必重复输出
+func Logged(err error) bool {
+	var e loggedError
+	return errors.As(err, &e)
+}
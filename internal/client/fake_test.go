@@ -0,0 +1,536 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeZone 各家服务商假接口共用的内存解析记录
+type fakeZone struct {
+	mu        sync.Mutex
+	records   []*fakeRecord
+	nextId    int
+	creates   int
+	updates   int
+	deletes   int
+	malformed bool
+	// fuzzy 模拟只做模糊匹配的接口，列表忽略名称和类型过滤
+	fuzzy bool
+	// maxPage 限制单页返回的记录数，0 表示按请求的页大小返回
+	maxPage int
+}
+
+type fakeRecord struct {
+	id    string
+	name  string
+	typ   string
+	value string
+}
+
+func (z *fakeZone) add(name, typ, value string) *fakeRecord {
+	z.nextId++
+	r := &fakeRecord{id: strconv.Itoa(z.nextId), name: name, typ: typ, value: value}
+	z.records = append(z.records, r)
+	return r
+}
+
+func (z *fakeZone) list(name, typ string) (res []*fakeRecord) {
+	for _, r := range z.records {
+		if (name == "" || r.name == name) && (typ == "" || r.typ == typ) {
+			res = append(res, r)
+		}
+	}
+	return
+}
+
+func (z *fakeZone) search(name, typ string) []*fakeRecord {
+	if z.fuzzy {
+		return z.list("", "")
+	}
+	return z.list(name, typ)
+}
+
+// page 按偏移和页大小截取记录，同时返回记录总数
+func (z *fakeZone) page(rs []*fakeRecord, offset, size int) ([]*fakeRecord, int) {
+	if z.maxPage > 0 && (size <= 0 || size > z.maxPage) {
+		size = z.maxPage
+	}
+	total := len(rs)
+	if offset > total {
+		offset = total
+	}
+	if size > 0 && offset+size < total {
+		return rs[offset : offset+size], total
+	}
+	return rs[offset:], total
+}
+
+func formInt(v string, def int) int {
+	if n, err := strconv.Atoi(v); err == nil {
+		return n
+	}
+	return def
+}
+
+func (z *fakeZone) remove(id string) bool {
+	for i, r := range z.records {
+		if r.id == id {
+			z.records = append(z.records[:i], z.records[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (z *fakeZone) get(id string) *fakeRecord {
+	for _, r := range z.records {
+		if r.id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// values 返回同名同类型的全部值，华为云记录集中以逗号拼接的值会拆开
+func (z *fakeZone) values(name, typ string) (res []string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for _, r := range z.list(name, typ) {
+		res = append(res, strings.Split(r.value, ",")...)
+	}
+	slices.Sort(res)
+	return
+}
+
+func (z *fakeZone) value(name, typ string) string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if rs := z.list(name, typ); len(rs) > 0 {
+		return rs[0].value
+	}
+	return ""
+}
+
+// serve 统一处理加锁和畸形响应
+func (z *fakeZone) serve(handler func(w http.ResponseWriter, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		z.mu.Lock()
+		defer z.mu.Unlock()
+		if z.malformed {
+			_, _ = w.Write([]byte("<html>502 Bad Gateway"))
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func readJson(r *http.Request, v any) {
+	b, _ := io.ReadAll(r.Body)
+	_ = json.Unmarshal(b, v)
+}
+
+const (
+	fakeId     = "fake-id"
+	fakeSecret = "fake-secret"
+	fakeZoneId = "fake-zone"
+)
+
+func fakeDNSPod(z *fakeZone) http.Handler {
+	return z.serve(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("login_token") != fakeId+","+fakeSecret {
+			writeJson(w, http.StatusOK, map[string]any{"status": map[string]string{"code": "-1", "message": "Login failed"}})
+			return
+		}
+
+		ok := map[string]string{"code": "1", "message": "Action completed successful"}
+		switch r.URL.Path {
+		case "/Record.List":
+			var records []map[string]string
+			rs, total := z.page(z.search(r.PostForm.Get("sub_domain"), r.PostForm.Get("record_type")),
+				formInt(r.PostForm.Get("offset"), 0), formInt(r.PostForm.Get("length"), 0))
+			for _, v := range rs {
+				records = append(records, map[string]string{"id": v.id, "name": v.name, "type": v.typ, "value": v.value, "line_id": "0"})
+			}
+			writeJson(w, http.StatusOK, map[string]any{
+				"status":  ok,
+				"info":    map[string]any{"record_total": strconv.Itoa(total)},
+				"records": records,
+			})
+		case "/Record.Create":
+			z.creates++
+			z.add(r.PostForm.Get("sub_domain"), r.PostForm.Get("record_type"), r.PostForm.Get("value"))
+			writeJson(w, http.StatusOK, map[string]any{"status": ok})
+		case "/Record.Remove":
+			z.deletes++
+			if !z.remove(r.PostForm.Get("record_id")) {
+				writeJson(w, http.StatusOK, map[string]any{"status": map[string]string{"code": "8", "message": "Record id invalid"}})
+				return
+			}
+			writeJson(w, http.StatusOK, map[string]any{"status": ok})
+		case "/Record.Modify":
+			z.updates++
+			rec := z.get(r.PostForm.Get("record_id"))
+			if rec == nil {
+				writeJson(w, http.StatusOK, map[string]any{"status": map[string]string{"code": "8", "message": "Record id invalid"}})
+				return
+			}
+			rec.value = r.PostForm.Get("value")
+			writeJson(w, http.StatusOK, map[string]any{"status": ok})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func fakeCloudflare(z *fakeZone) http.Handler {
+	return z.serve(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+fakeSecret {
+			writeJson(w, http.StatusForbidden, map[string]any{
+				"success": false,
+				"errors":  []map[string]any{{"code": 10000, "message": "Authentication error"}},
+			})
+			return
+		}
+
+		prefix := "/zones/" + fakeZoneId + "/dns_records"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		toJson := func(v *fakeRecord) map[string]any {
+			return map[string]any{"id": v.id, "name": v.name, "type": v.typ, "content": v.value}
+		}
+		var body struct {
+			Type    string `json:"type"`
+			Name    string `json:"name"`
+			Content string `json:"content"`
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == prefix:
+			q := r.URL.Query()
+			results := []map[string]any{}
+			page, perPage := formInt(q.Get("page"), 1), formInt(q.Get("per_page"), 100)
+			if z.maxPage > 0 && z.maxPage < perPage {
+				perPage = z.maxPage
+			}
+			rs, total := z.page(z.search(q.Get("name"), q.Get("type")), (page-1)*perPage, perPage)
+			for _, v := range rs {
+				results = append(results, toJson(v))
+			}
+			writeJson(w, http.StatusOK, map[string]any{
+				"success":     true,
+				"result":      results,
+				"result_info": map[string]any{"page": page, "per_page": perPage, "total_pages": (total + perPage - 1) / perPage},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == prefix:
+			z.creates++
+			readJson(r, &body)
+			writeJson(w, http.StatusOK, map[string]any{"success": true, "result": toJson(z.add(body.Name, body.Type, body.Content))})
+		case r.Method == http.MethodDelete:
+			z.deletes++
+			id := strings.TrimPrefix(r.URL.Path, prefix+"/")
+			if !z.remove(id) {
+				writeJson(w, http.StatusNotFound, map[string]any{
+					"success": false,
+					"errors":  []map[string]any{{"code": 81044, "message": "Record does not exist."}},
+				})
+				return
+			}
+			writeJson(w, http.StatusOK, map[string]any{"success": true, "result": map[string]string{"id": id}})
+		case r.Method == http.MethodPut:
+			z.updates++
+			readJson(r, &body)
+			rec := z.get(strings.TrimPrefix(r.URL.Path, prefix+"/"))
+			if rec == nil {
+				writeJson(w, http.StatusNotFound, map[string]any{
+					"success": false,
+					"errors":  []map[string]any{{"code": 81044, "message": "Record does not exist."}},
+				})
+				return
+			}
+			rec.value = body.Content
+			writeJson(w, http.StatusOK, map[string]any{"success": true, "result": toJson(rec)})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func fakeAliDNS(z *fakeZone) http.Handler {
+	return z.serve(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("AccessKeyId") != fakeId {
+			writeJson(w, http.StatusForbidden, map[string]string{
+				"RequestId": "fake",
+				"Code":      "InvalidAccessKeyId.NotFound",
+				"Message":   "Specified access key is not found.",
+			})
+			return
+		}
+
+		switch r.Form.Get("Action") {
+		case "DescribeDomainRecords":
+			records := []map[string]string{}
+			page, pageSize := formInt(r.Form.Get("PageNumber"), 1), formInt(r.Form.Get("PageSize"), 20)
+			if z.maxPage > 0 && z.maxPage < pageSize {
+				pageSize = z.maxPage
+			}
+			rs, total := z.page(z.search(r.Form.Get("RRKeyWord"), r.Form.Get("TypeKeyWord")), (page-1)*pageSize, pageSize)
+			for _, v := range rs {
+				records = append(records, map[string]string{"RecordId": v.id, "RR": v.name, "Type": v.typ, "Value": v.value})
+			}
+			writeJson(w, http.StatusOK, map[string]any{
+				"RequestId":     "fake",
+				"TotalCount":    total,
+				"PageNumber":    page,
+				"PageSize":      pageSize,
+				"DomainRecords": map[string]any{"Record": records},
+			})
+		case "AddDomainRecord":
+			z.creates++
+			rec := z.add(r.Form.Get("RR"), r.Form.Get("Type"), r.Form.Get("Value"))
+			writeJson(w, http.StatusOK, map[string]string{"RequestId": "fake", "RecordId": rec.id})
+		case "DeleteDomainRecord":
+			z.deletes++
+			if !z.remove(r.Form.Get("RecordId")) {
+				writeJson(w, http.StatusBadRequest, map[string]string{"RequestId": "fake", "Code": "DomainRecordNotBelongToUser", "Message": "not found"})
+				return
+			}
+			writeJson(w, http.StatusOK, map[string]string{"RequestId": "fake", "RecordId": r.Form.Get("RecordId")})
+		case "UpdateDomainRecord":
+			z.updates++
+			rec := z.get(r.Form.Get("RecordId"))
+			if rec == nil {
+				writeJson(w, http.StatusBadRequest, map[string]string{"RequestId": "fake", "Code": "DomainRecordNotBelongToUser", "Message": "not found"})
+				return
+			}
+			rec.value = r.Form.Get("Value")
+			writeJson(w, http.StatusOK, map[string]string{"RequestId": "fake", "RecordId": rec.id})
+		default:
+			writeJson(w, http.StatusBadRequest, map[string]string{"RequestId": "fake", "Code": "InvalidAction", "Message": "unknown action"})
+		}
+	})
+}
+
+func fakeHuaweiCloud(z *fakeZone) http.Handler {
+	return z.serve(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Access="+fakeId+",") {
+			writeJson(w, http.StatusUnauthorized, map[string]string{
+				"error_code": "APIGW.0301",
+				"error_msg":  "Incorrect IAM authentication information",
+			})
+			return
+		}
+
+		toJson := func(v *fakeRecord) map[string]any {
+			// 一个记录集可以有多个值，以逗号拼接存放
+			return map[string]any{"id": v.id, "name": v.name, "type": v.typ, "records": strings.Split(v.value, ",")}
+		}
+		var body struct {
+			Name    string   `json:"name"`
+			Type    string   `json:"type"`
+			Records []string `json:"records"`
+		}
+		prefix := "/v2/zones/" + fakeZoneId + "/recordsets"
+		switch {
+		case r.URL.Path == "/v2/zones":
+			writeJson(w, http.StatusOK, map[string]any{"zones": []map[string]string{{"id": fakeZoneId, "name": "example.com."}}})
+		case r.Method == http.MethodGet && r.URL.Path == prefix:
+			q := r.URL.Query()
+			results := []map[string]any{}
+			for _, v := range z.list(q.Get("name"), q.Get("type")) {
+				results = append(results, toJson(v))
+			}
+			writeJson(w, http.StatusOK, map[string]any{"recordsets": results, "metadata": map[string]int{"total_count": len(results)}})
+		case r.Method == http.MethodPost && r.URL.Path == prefix:
+			z.creates++
+			readJson(r, &body)
+			writeJson(w, http.StatusAccepted, toJson(z.add(body.Name, body.Type, strings.Join(body.Records, ","))))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, prefix+"/"):
+			z.updates++
+			readJson(r, &body)
+			rec := z.get(strings.TrimPrefix(r.URL.Path, prefix+"/"))
+			if rec == nil {
+				writeJson(w, http.StatusNotFound, map[string]string{"code": "DNS.0004", "message": "Record set not found"})
+				return
+			}
+			rec.value = strings.Join(body.Records, ",")
+			writeJson(w, http.StatusAccepted, toJson(rec))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func fakeVolcengine(z *fakeZone) http.Handler {
+	return z.serve(func(w http.ResponseWriter, r *http.Request) {
+		fail := func(status int, code, message string) {
+			writeJson(w, status, map[string]any{
+				"ResponseMetadata": map[string]any{"Error": map[string]string{"Code": code, "Message": message}},
+			})
+		}
+		ok := func(result any) {
+			writeJson(w, http.StatusOK, map[string]any{"ResponseMetadata": map[string]any{}, "Result": result})
+		}
+
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential="+fakeId+"/") {
+			fail(http.StatusUnauthorized, "InvalidAccessKey", "The AccessKey is invalid")
+			return
+		}
+
+		q := r.URL.Query()
+		var body struct {
+			RecordID string `json:"RecordID"`
+			Host     string `json:"Host"`
+			Type     string `json:"Type"`
+			Value    string `json:"Value"`
+		}
+		switch q.Get("Action") {
+		case "ListZones":
+			ok(map[string]any{"Zones": []map[string]any{{"ZID": 1, "ZoneName": "example.com"}}})
+		case "ListRecords":
+			page, pageSize := formInt(q.Get("PageNumber"), 1), formInt(q.Get("PageSize"), 20)
+			if z.maxPage > 0 && z.maxPage < pageSize {
+				pageSize = z.maxPage
+			}
+			rs, total := z.page(z.search(q.Get("Host"), q.Get("Type")), (page-1)*pageSize, pageSize)
+			records := []map[string]any{}
+			for _, v := range rs {
+				records = append(records, map[string]any{"RecordID": v.id, "Host": v.name, "Type": v.typ, "Value": v.value, "Line": "default", "TTL": 600})
+			}
+			ok(map[string]any{"TotalCount": total, "Records": records})
+		case "CreateRecord":
+			z.creates++
+			readJson(r, &body)
+			ok(map[string]any{"RecordID": z.add(body.Host, body.Type, body.Value).id})
+		case "UpdateRecord":
+			z.updates++
+			readJson(r, &body)
+			rec := z.get(body.RecordID)
+			if rec == nil {
+				fail(http.StatusNotFound, "RecordNotFound", "record not found")
+				return
+			}
+			rec.value = body.Value
+			ok(map[string]any{"RecordID": rec.id})
+		default:
+			fail(http.StatusBadRequest, "InvalidActionOrVersion", "unknown action")
+		}
+	})
+}
+
+func fakeBaiduCloud(z *fakeZone) http.Handler {
+	return z.serve(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "bce-auth-v1/"+fakeId+"/") {
+			writeJson(w, http.StatusForbidden, map[string]string{"code": "AccessDenied", "message": "Access denied."})
+			return
+		}
+
+		var body struct {
+			RecordId uint64 `json:"recordId"`
+			Domain   string `json:"domain"`
+			RdType   string `json:"rdType"`
+			Rdata    string `json:"rdata"`
+			PageNum  int    `json:"pageNum"`
+			PageSize int    `json:"pageSize"`
+		}
+		readJson(r, &body)
+		switch r.URL.Path {
+		case "/v1/domain/resolve/list":
+			page, pageSize := max(body.PageNum, 1), max(body.PageSize, 1)
+			if z.maxPage > 0 && z.maxPage < pageSize {
+				pageSize = z.maxPage
+			}
+			rs, total := z.page(z.list("", ""), (page-1)*pageSize, pageSize)
+			results := []map[string]any{}
+			for _, v := range rs {
+				id, _ := strconv.Atoi(v.id)
+				results = append(results, map[string]any{"recordId": id, "domain": v.name, "rdtype": v.typ, "rdata": v.value, "view": "DEFAULT", "ttl": 600})
+			}
+			writeJson(w, http.StatusOK, map[string]any{"totalCount": total, "result": results})
+		case "/v1/domain/resolve/add":
+			z.creates++
+			z.add(body.Domain, body.RdType, body.Rdata)
+			w.WriteHeader(http.StatusOK)
+		case "/v1/domain/resolve/edit":
+			z.updates++
+			rec := z.get(strconv.FormatUint(body.RecordId, 10))
+			if rec == nil {
+				writeJson(w, http.StatusNotFound, map[string]string{"code": "NoSuchRecord", "message": "record not found"})
+				return
+			}
+			rec.value = body.Rdata
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func fakeJDCloud(z *fakeZone) http.Handler {
+	return z.serve(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential="+fakeId+"/") {
+			writeJson(w, http.StatusUnauthorized, map[string]any{
+				"error": map[string]any{"code": 401, "status": "UNAUTHENTICATED", "message": "Invalid access key"},
+			})
+			return
+		}
+
+		var body struct {
+			Req struct {
+				HostRecord string `json:"hostRecord"`
+				HostValue  string `json:"hostValue"`
+				Type       string `json:"type"`
+			} `json:"req"`
+		}
+		toJson := func(v *fakeRecord) map[string]any {
+			id, _ := strconv.Atoi(v.id)
+			return map[string]any{"id": id, "hostRecord": v.name, "hostValue": v.value, "type": v.typ, "ttl": 600, "viewValue": -1}
+		}
+		prefix := "/v2/regions/" + jdCloudRegion + "/domain"
+		recordPrefix := prefix + "/1/ResourceRecord"
+		switch {
+		case r.URL.Path == prefix:
+			writeJson(w, http.StatusOK, map[string]any{"result": map[string]any{"dataList": []map[string]any{{"id": 1, "domainName": "example.com"}}}})
+		case r.Method == http.MethodGet && r.URL.Path == recordPrefix:
+			// search 为模糊匹配
+			results := []map[string]any{}
+			for _, v := range z.list("", "") {
+				if strings.Contains(v.name, url.QueryEscape(r.URL.Query().Get("search"))) {
+					results = append(results, toJson(v))
+				}
+			}
+			writeJson(w, http.StatusOK, map[string]any{"result": map[string]any{"dataList": results}})
+		case r.Method == http.MethodPost && r.URL.Path == recordPrefix:
+			z.creates++
+			readJson(r, &body)
+			writeJson(w, http.StatusOK, map[string]any{"result": toJson(z.add(body.Req.HostRecord, body.Req.Type, body.Req.HostValue))})
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, recordPrefix+"/"):
+			z.updates++
+			readJson(r, &body)
+			rec := z.get(strings.TrimPrefix(r.URL.Path, recordPrefix+"/"))
+			if rec == nil {
+				writeJson(w, http.StatusNotFound, map[string]any{"error": map[string]any{"code": 404, "status": "NOT_FOUND", "message": "record not found"}})
+				return
+			}
+			rec.value = body.Req.HostValue
+			writeJson(w, http.StatusOK, map[string]any{"result": toJson(rec)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,364 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gatewayMethodNATPMP = "natpmp"
+	gatewayMethodPCP    = "pcp"
+	gatewayMethodUPnP   = "upnp"
+
+	gatewayAttemptTimeout = time.Second
+	gatewayAttempts       = 3
+	ssdpAddr              = "239.255.255.250:1900"
+	ssdpTimeout           = 3 * time.Second
+)
+
+var (
+	// gatewayPort NAT-PMP 和 PCP 共用的端口
+	gatewayPort = 5351
+	// ssdpPort 向指定路由器单播发现请求时的端口
+	ssdpPort    = 1900
+	cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+)
+
+// getIPByGateway 向路由器询问 WAN 口 IPv4，method 为空时依次尝试 NAT-PMP、PCP、UPnP
+func getIPByGateway(conf gatewayDetect) (ip string, err error) {
+	methods := []string{gatewayMethodNATPMP, gatewayMethodPCP, gatewayMethodUPnP}
+	if conf.Method != "" {
+		methods = []string{conf.Method}
+	}
+
+	var gateway netip.Addr
+	for _, method := range methods {
+		var addr netip.Addr
+		switch method {
+		case gatewayMethodNATPMP, gatewayMethodPCP:
+			if !gateway.IsValid() {
+				if gateway, err = findGateway(conf.Address); err != nil {
+					continue
+				}
+			}
+			if method == gatewayMethodNATPMP {
+				addr, err = natPMPExternalIP(gateway)
+			} else {
+				addr, err = pcpExternalIP(gateway)
+			}
+		case gatewayMethodUPnP:
+			// 填写了 address 时直接向路由器发送发现请求，否则使用组播
+			var target netip.Addr
+			if conf.Address != "" {
+				if target, err = netip.ParseAddr(conf.Address); err != nil {
+					continue
+				}
+			}
+			addr, err = upnpDiscoverExternalIP(target)
+		default:
+			return "", errors.New("gateway 不支持 " + method + "，可选 natpmp, pcp, upnp")
+		}
+		if err != nil {
+			err = errors.New("gateway " + method + ": " + err.Error())
+			continue
+		}
+		return checkWANAddr(addr)
+	}
+	return "", err
+}
+
+// checkWANAddr WAN 口是运营商级 NAT 或内网地址时，公网无法通过该地址访问
+func checkWANAddr(addr netip.Addr) (string, error) {
+	addr = addr.Unmap()
+	switch {
+	case !addr.Is4():
+		return "", errors.New("路由器返回的 " + addr.String() + " 不是 IPv4 地址")
+	case cgnatPrefix.Contains(addr):
+		return "", errors.New("路由器 WAN 口地址 " + addr.String() + " 位于运营商级 NAT (100.64.0.0/10) 地址段，DDNS 无法从公网访问")
+	case addr.IsPrivate():
+		return "", errors.New("路由器 WAN 口地址 " + addr.String() + " 是内网地址，上级还有 NAT，DDNS 无法从公网访问")
+	case addr.IsUnspecified():
+		return "", errors.New("路由器还没有 WAN 口地址")
+	}
+	return addr.String(), nil
+}
+
+// findGateway 未配置网关时从默认路由中查找
+func findGateway(address string) (gateway netip.Addr, err error) {
+	if address != "" {
+		return netip.ParseAddr(address)
+	}
+	return defaultGateway()
+}
+
+// defaultGateway 读取 /proc/net/route 中的 IPv4 默认路由
+func defaultGateway() (gateway netip.Addr, err error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return gateway, errors.New("无法自动获取网关，请在 gateway 中填写 address")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Iface Destination Gateway ...
+		if len(fields) < 3 || fields[1] != "00000000" || fields[2] == "00000000" {
+			continue
+		}
+		v, e := strconv.ParseUint(fields[2], 16, 32)
+		if e != nil {
+			continue
+		}
+		// 内核把网络字节序的地址按主机字节序的整数输出，mips64 等大端平台与 x86 不同
+		var b [4]byte
+		binary.NativeEndian.PutUint32(b[:], uint32(v))
+		return netip.AddrFrom4(b), nil
+	}
+	return gateway, errors.New("没有找到默认网关，请在 gateway 中填写 address")
+}
+
+// gatewayRequest 向网关发送 UDP 请求，未收到响应时重传
+func gatewayRequest(gateway netip.Addr, req []byte, accept func(resp []byte) bool) (resp []byte, err error) {
+	conn, err := net.Dial("udp4", netip.AddrPortFrom(gateway, uint16(gatewayPort)).String())
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1100)
+	for range gatewayAttempts {
+		if _, err = conn.Write(req); err != nil {
+			return
+		}
+		if err = conn.SetReadDeadline(time.Now().Add(gatewayAttemptTimeout)); err != nil {
+			return
+		}
+		for {
+			var n int
+			if n, err = conn.Read(buf); err != nil {
+				break
+			}
+			if accept(buf[:n]) {
+				return buf[:n], nil
+			}
+		}
+
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return
+		}
+	}
+	return nil, errors.New("网关没有响应")
+}
+
+// natPMPExternalIP 按 RFC 6886 请求外部地址
+func natPMPExternalIP(gateway netip.Addr) (addr netip.Addr, err error) {
+	resp, err := gatewayRequest(gateway, []byte{0, 0}, func(resp []byte) bool {
+		return len(resp) >= 12 && resp[0] == 0 && resp[1] == 128
+	})
+	if err != nil {
+		return
+	}
+	if code := binary.BigEndian.Uint16(resp[2:]); code != 0 {
+		return addr, errors.New("NAT-PMP 结果码 " + strconv.Itoa(int(code)))
+	}
+	return netip.AddrFrom4([4]byte(resp[8:12])), nil
+}
+
+// pcpExternalIP 按 RFC 6887 发送 MAP 请求，从响应中取得分配的外部地址，之后删除该映射
+func pcpExternalIP(gateway netip.Addr) (addr netip.Addr, err error) {
+	conn, err := net.Dial("udp4", netip.AddrPortFrom(gateway, uint16(gatewayPort)).String())
+	if err != nil {
+		return
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).AddrPort()
+	_ = conn.Close()
+
+	var nonce [12]byte
+	_, _ = rand.Read(nonce[:])
+	mapReq := func(lifetime uint32) []byte {
+		req := make([]byte, 60)
+		req[0], req[1] = 2, 1 // 版本 2，MAP
+		binary.BigEndian.PutUint32(req[4:], lifetime)
+		client := local.Addr().As16()
+		copy(req[8:24], client[:])
+		copy(req[24:36], nonce[:])
+		req[36] = 17 // UDP
+		binary.BigEndian.PutUint16(req[40:], local.Port())
+		return req
+	}
+	accept := func(resp []byte) bool {
+		return len(resp) >= 60 && resp[0] == 2 && resp[1] == 0x81 && bytes.Equal(resp[24:36], nonce[:])
+	}
+
+	resp, err := gatewayRequest(gateway, mapReq(60), accept)
+	if err != nil {
+		return
+	}
+	if code := resp[3]; code != 0 {
+		return addr, errors.New("PCP 结果码 " + strconv.Itoa(int(code)))
+	}
+	addr = netip.AddrFrom16([16]byte(resp[44:60])).Unmap()
+
+	// 只是为了拿到外部地址，映射用完即删
+	_, _ = gatewayRequest(gateway, mapReq(0), accept)
+	return
+}
+
+// upnpDiscoverExternalIP 通过 SSDP 发现 IGD 后调用 GetExternalIPAddress，gateway 无效时使用组播发现
+func upnpDiscoverExternalIP(gateway netip.Addr) (addr netip.Addr, err error) {
+	location, err := ssdpDiscover(gateway)
+	if err != nil {
+		return
+	}
+	return upnpExternalIP(location)
+}
+
+func ssdpDiscover(gateway netip.Addr) (location string, err error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	target := ssdpAddr
+	if gateway.IsValid() {
+		target = netip.AddrPortFrom(gateway, uint16(ssdpPort)).String()
+	}
+	dst, err := net.ResolveUDPAddr("udp4", target)
+	if err != nil {
+		return
+	}
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + target + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	if _, err = conn.WriteTo([]byte(req), dst); err != nil {
+		return
+	}
+	if err = conn.SetReadDeadline(time.Now().Add(ssdpTimeout)); err != nil {
+		return
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, from, e := conn.ReadFrom(buf)
+		if e != nil {
+			return "", errors.New("没有发现支持 UPnP 的路由器")
+		}
+		// 单播时只接受该路由器的响应
+		if udpFrom, ok := from.(*net.UDPAddr); gateway.IsValid() && (!ok || udpFrom.AddrPort().Addr().Unmap() != gateway) {
+			continue
+		}
+		resp, e := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if e != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+		if location = resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// findWANService 在设备树中查找 WANIPConnection 或 WANPPPConnection 服务
+func (d upnpDevice) findWANService() (serviceType, controlURL string) {
+	for _, s := range d.Services {
+		if strings.Contains(s.ServiceType, ":WANIPConnection:") || strings.Contains(s.ServiceType, ":WANPPPConnection:") {
+			return s.ServiceType, s.ControlURL
+		}
+	}
+	for _, sub := range d.Devices {
+		if serviceType, controlURL = sub.findWANService(); controlURL != "" {
+			return
+		}
+	}
+	return
+}
+
+// upnpExternalIP 读取设备描述并调用 GetExternalIPAddress
+func upnpExternalIP(location string) (addr netip.Addr, err error) {
+	resp, err := ipHttpGet(location, false)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var desc struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err = xml.NewDecoder(io.LimitReader(resp.Body, ipSourceMaxBody)).Decode(&desc); err != nil {
+		return
+	}
+	serviceType, controlURL := desc.Device.findWANService()
+	if controlURL == "" {
+		return addr, errors.New("路由器没有提供 WANIPConnection 服务")
+	}
+
+	base := location
+	if desc.URLBase != "" {
+		base = desc.URLBase
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return
+	}
+	ctrl, err := baseURL.Parse(controlURL)
+	if err != nil {
+		return
+	}
+
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + serviceType + `"/></s:Body></s:Envelope>`
+	req, err := httpNewRequest(http.MethodPost, ctrl.String(), strings.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+`#GetExternalIPAddress"`)
+
+	soapResp, err := ipHttpClient(false).Do(req)
+	if err != nil {
+		return
+	}
+	defer soapResp.Body.Close()
+	if soapResp.StatusCode != http.StatusOK {
+		return addr, errors.New("UPnP HTTP " + strconv.Itoa(soapResp.StatusCode))
+	}
+
+	var envelope struct {
+		IP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err = xml.NewDecoder(io.LimitReader(soapResp.Body, ipSourceMaxBody)).Decode(&envelope); err != nil {
+		return
+	}
+	if addr, err = netip.ParseAddr(strings.TrimSpace(envelope.IP)); err != nil {
+		return addr, errors.New("UPnP 返回的外部地址格式错误")
+	}
+	return
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// startFakeGateway 在回环地址上同时响应 NAT-PMP 和 PCP 请求，返回 wan 作为外部地址
+func startFakeGateway(t *testing.T, wan string) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	port := gatewayPort
+	gatewayPort = conn.LocalAddr().(*net.UDPAddr).Port
+	t.Cleanup(func() { gatewayPort = port })
+
+	addr := netip.MustParseAddr(wan)
+	go func() {
+		buf := make([]byte, 1100)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			switch {
+			case n == 2 && buf[0] == 0 && buf[1] == 0:
+				resp := make([]byte, 12)
+				resp[1] = 128
+				ip := addr.As4()
+				copy(resp[8:], ip[:])
+				_, _ = conn.WriteTo(resp, from)
+			case n == 60 && buf[0] == 2 && buf[1] == 1:
+				resp := make([]byte, 60)
+				copy(resp, buf[:60])
+				resp[1] = 0x81
+				ip := addr.As16()
+				copy(resp[44:60], ip[:])
+				_, _ = conn.WriteTo(resp, from)
+			}
+		}
+	}()
+}
+
+func TestGetIPByGateway(t *testing.T) {
+	startFakeGateway(t, "203.0.113.7")
+
+	for _, method := range []string{gatewayMethodNATPMP, gatewayMethodPCP} {
+		got, err := getIPByGateway(gatewayDetect{Enable: true, Method: method, Address: "127.0.0.1"})
+		if err != nil {
+			t.Fatal(method, err)
+		}
+		if got != "203.0.113.7" {
+			t.Errorf("%s ip = %q, want 203.0.113.7", method, got)
+		}
+	}
+
+	if _, err := getIPByGateway(gatewayDetect{Enable: true, Method: "igd", Address: "127.0.0.1"}); err == nil {
+		t.Error("未知 method 应报错")
+	}
+}
+
+func TestGetIPByGatewayCGNAT(t *testing.T) {
+	startFakeGateway(t, "100.72.1.2")
+
+	_, err := getIPByGateway(gatewayDetect{Enable: true, Method: gatewayMethodNATPMP, Address: "127.0.0.1"})
+	if err == nil || !strings.Contains(err.Error(), "100.64.0.0/10") {
+		t.Errorf("err = %v, want CGNAT", err)
+	}
+}
+
+func TestUPnPExternalIP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/desc.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<device><deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<deviceList><device><deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<deviceList><device><deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+<serviceList><service>
+<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+<controlURL>/ctl/IPConn</controlURL>
+</service></serviceList>
+</device></deviceList></device></deviceList></device></root>`))
+		case "/ctl/IPConn":
+			if r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPAddress>198.51.100.20</NewExternalIPAddress>
+</u:GetExternalIPAddressResponse></s:Body></s:Envelope>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	got, err := upnpExternalIP(srv.URL + "/desc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != netip.MustParseAddr("198.51.100.20") {
+		t.Errorf("addr = %v, want 198.51.100.20", got)
+	}
+
+	// 填写 address 时向该地址单播发现请求
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	port := ssdpPort
+	ssdpPort = conn.LocalAddr().(*net.UDPAddr).Port
+	t.Cleanup(func() { ssdpPort = port })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(string(buf[:n]), "M-SEARCH") {
+				_, _ = conn.WriteTo([]byte("HTTP/1.1 200 OK\r\nLOCATION: "+srv.URL+"/desc.xml\r\n\r\n"), from)
+			}
+		}
+	}()
+	ip, err := getIPByGateway(gatewayDetect{Enable: true, Method: gatewayMethodUPnP, Address: "127.0.0.1"})
+	if err != nil || ip != "198.51.100.20" {
+		t.Errorf("upnp ip = %q, err = %v", ip, err)
+	}
+}
+
+func TestCheckWANAddr(t *testing.T) {
+	for ip, ok := range map[string]bool{
+		"203.0.113.7":   true,
+		"100.64.0.1":    false,
+		"100.127.255.1": false,
+		"100.128.0.1":   true,
+		"192.168.1.2":   false,
+		"0.0.0.0":       false,
+	} {
+		_, err := checkWANAddr(netip.MustParseAddr(ip))
+		if (err == nil) != ok {
+			t.Errorf("%s: err = %v, want ok %v", ip, err, ok)
+		}
+	}
+}
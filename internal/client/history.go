@@ -0,0 +1,47 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"errors"
+)
+
+// HistoryFilename 历史记录的默认文件名
+const HistoryFilename = "client_history.jsonl"
+
+var (
+	// History 客户端的历史记录，未启用时为 nil
+	History *common.History
+	// historyConf History 使用的配置
+	historyConf common.HistoryConf
+)
+
+// LoadHistoryPath 只读取配置文件中的 history，配置不完整时也能查询历史记录
+func LoadHistoryPath() (path string, err error) {
+	var c client
+	if err = common.LoadAndUnmarshal(ConfDir+"/"+ConfFilename, &c); err != nil {
+		return
+	}
+	return c.History.Path(ConfDir, HistoryFilename), nil
+}
+
+// SetupHistory 按 Client.History 打开历史记录
+func SetupHistory() (err error) {
+	h, err := openHistory(Client)
+	if err != nil {
+		return
+	}
+	History, historyConf = h, Client.History
+	return
+}
+
+// openHistory 配置没有变化时沿用已经打开的历史记录
+func openHistory(c client) (h *common.History, err error) {
+	if History != nil && historyConf == c.History {
+		return History, nil
+	}
+	h, err = common.OpenHistory(c.History, c.History.Path(ConfDir, HistoryFilename))
+	if err != nil {
+		return nil, errors.New("客户端配置文件 " + ConfDir + "/" + ConfFilename + " 的 history " + err.Error())
+	}
+	return
+}
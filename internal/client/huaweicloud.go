@@ -3,30 +3,38 @@ package client
 import (
 	"ddns-watchdog/internal/common"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/huaweicloud/huaweicloud-sdk-go-v3/core/auth/basic"
+	hwRegion "github.com/huaweicloud/huaweicloud-sdk-go-v3/core/region"
 	dns "github.com/huaweicloud/huaweicloud-sdk-go-v3/services/dns/v2"
 	"github.com/huaweicloud/huaweicloud-sdk-go-v3/services/dns/v2/model"
 	"github.com/huaweicloud/huaweicloud-sdk-go-v3/services/dns/v2/region"
 )
 
 const (
-	HuaweiCloudConfFilename = "huaweicloud.json"
-	huaweiCloudPrefix       = "HuaweiCloud: "
-	huaweiCloudRegion       = "cn-east-3"
+	HuaweiCloudConfFilename  = "huaweicloud.json"
+	huaweiCloudPrefix        = "HuaweiCloud: "
+	huaweiCloudDefaultRegion = "cn-east-3"
 )
 
 type HuaweiCloud struct {
 	AccessKeyId     string           `json:"access_key_id"`
 	SecretAccessKey string           `json:"secret_access_key"`
+	Region          string           `json:"region"`
+	Endpoint        string           `json:"endpoint"`
+	ProjectId       string           `json:"project_id"`
 	ZoneName        string           `json:"zone_name"`
 	Domain          common.Subdomain `json:"domain"`
 	ZoneId          string           `json:"-"`
+	dnsClient       *dns.DnsClient
 }
 
 func (hc *HuaweiCloud) InitConf() (msg string, err error) {
 	*hc = HuaweiCloud{
 		AccessKeyId: "在 https://console.huaweicloud.com/iam/ 获取",
+		Region:      huaweiCloudDefaultRegion,
 		ZoneName:    "example.com.",
 		Domain: common.Subdomain{
 			A:    "A记录子域名.example.com.",
@@ -43,10 +51,14 @@ func (hc *HuaweiCloud) LoadConf() (err error) {
 	if err = common.LoadAndUnmarshal(ConfDir+"/"+HuaweiCloudConfFilename, &hc); err != nil {
 		return
 	}
+	return hc.check()
+}
+
+func (hc *HuaweiCloud) check() error {
 	if hc.AccessKeyId == "" || hc.SecretAccessKey == "" || hc.ZoneName == "" || (hc.Domain.A == "" && hc.Domain.AAAA == "") {
 		return errors.New("请打开配置文件 " + ConfDir + "/" + HuaweiCloudConfFilename + " 检查你的 access_key_id, secret_access_key, domain 并重新启动")
 	}
-	return
+	return nil
 }
 
 func (hc *HuaweiCloud) Run(enabled common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
@@ -57,44 +69,136 @@ func (hc *HuaweiCloud) Run(enabled common.Enable, ipv4, ipv6 string) (msg []stri
 		}
 	}
 	if ipv4 != "" && enabled.IPv4 && hc.Domain.A != "" {
-		recordSetId, recordIP, err := hc.getParseRecord(hc.Domain.A, "A")
-		if err != nil {
+		if m, err := hc.syncParseRecord(ipv4, "A", hc.Domain.A); err != nil {
 			errs = append(errs, err)
-		} else if recordIP != ipv4 {
-			if err = hc.updateParseRecord(ipv4, recordSetId, "A", hc.Domain.A); err != nil {
-				errs = append(errs, err)
-			} else {
-				msg = append(msg, huaweiCloudPrefix+hc.Domain.A+" 已更新解析记录 "+ipv4)
-			}
+		} else if m != "" {
+			msg = append(msg, m)
 		}
 	}
 	if ipv6 != "" && enabled.IPv6 && hc.Domain.AAAA != "" {
-		recordSetId, recordIP, err := hc.getParseRecord(hc.Domain.AAAA, "AAAA")
-		if err != nil {
+		if m, err := hc.syncParseRecord(ipv6, "AAAA", hc.Domain.AAAA); err != nil {
 			errs = append(errs, err)
-		} else if recordIP != ipv6 {
-			if err = hc.updateParseRecord(ipv6, recordSetId, "AAAA", hc.Domain.AAAA); err != nil {
-				errs = append(errs, err)
-			} else {
-				msg = append(msg, huaweiCloudPrefix+hc.Domain.AAAA+" 已更新解析记录 "+ipv6)
-			}
+		} else if m != "" {
+			msg = append(msg, m)
 		}
 	}
 	return
 }
 
-func (hc *HuaweiCloud) getZoneId() (err error) {
+// RunHosts 为局域网主机发布 AAAA 记录，主机的完整域名需要属于 zone_name
+func (hc *HuaweiCloud) RunHosts(hosts []common.HostAddr) (msg []string, errs []error) {
+	if hc.ZoneId == "" && len(hosts) != 0 {
+		if err := hc.getZoneId(); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+	return runHosts(huaweiCloudPrefix, hosts, func(fqdn string) (string, error) {
+		// 华为云的记录名是以点结尾的完整域名
+		if _, err := subDomainOf(fqdn, hc.ZoneName); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(fqdn, ".") + ".", nil
+	}, hc.syncParseRecord)
+}
+
+// RecordNames 返回 A 和 AAAA 记录的完整域名
+func (hc *HuaweiCloud) RecordNames() common.Subdomain {
+	return common.Subdomain{A: strings.TrimSuffix(hc.Domain.A, "."), AAAA: strings.TrimSuffix(hc.Domain.AAAA, ".")}
+}
+
+func (hc *HuaweiCloud) syncParseRecord(ipAddr, recordType, domain string) (msg string, err error) {
+	ev := updateEvent{provider: common.HuaweiCloud, record: strings.TrimSuffix(domain, "."), recordType: recordType, newIP: ipAddr}
+	defer func() { err = ev.done(msg != "", err) }()
+
+	recordSetId, records, err := hc.getParseRecord(domain, recordType)
+	ev.oldIP = strings.Join(records, ",")
+	switch {
+	case err != nil:
+	case recordSetId == "":
+		if err = hc.createParseRecord([]string{ipAddr}, recordType, domain); err == nil {
+			msg = huaweiCloudPrefix + domain + " 已新建解析记录 " + ipAddr
+		}
+	case records[len(records)-1] != ipAddr:
+		if err = hc.updateParseRecord([]string{ipAddr}, recordSetId, recordType, domain); err == nil {
+			msg = huaweiCloudPrefix + domain + " 已更新解析记录 " + ipAddr
+		}
+	}
+	return
+}
+
+// RunSet 同步整组解析记录，使同名记录集恰好为 ipv4s 和 ipv6s
+func (hc *HuaweiCloud) RunSet(enabled common.Enable, ipv4s, ipv6s []string) (msg []string, errs []error) {
+	if hc.ZoneId == "" && (enabled.IPv4 || enabled.IPv6) {
+		if err := hc.getZoneId(); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+	return runRecordSet(enabled, hc.Domain, ipv4s, ipv6s, hc.syncRecordSet)
+}
+
+// syncRecordSet 华为云一个记录集本身就包含多个值，直接整体替换
+func (hc *HuaweiCloud) syncRecordSet(recordType, domain string, values []string) (msg []string, errs []error) {
+	values = uniqueValues(values)
+	if len(values) == 0 {
+		return
+	}
+	ev := updateEvent{provider: common.HuaweiCloud, record: strings.TrimSuffix(domain, "."), recordType: recordType,
+		newIP: strings.Join(values, ",")}
+
+	recordSetId, records, err := hc.getParseRecord(domain, recordType)
+	ev.oldIP = strings.Join(records, ",")
+	switch {
+	case err != nil:
+	case recordSetId == "":
+		if err = hc.createParseRecord(values, recordType, domain); err == nil {
+			msg = append(msg, huaweiCloudPrefix+domain+" 已新建解析记录 "+strings.Join(values, ", "))
+		}
+	case !sameValues(records, values):
+		if err = hc.updateParseRecord(values, recordSetId, recordType, domain); err == nil {
+			msg = append(msg, huaweiCloudPrefix+domain+" 已更新解析记录 "+strings.Join(values, ", "))
+		}
+	}
+	if err = ev.done(len(msg) != 0, err); err != nil {
+		errs = append(errs, err)
+	}
+	return
+}
+
+// getClient 每个实例只构造一次 SDK 客户端
+func (hc *HuaweiCloud) getClient() (dnsClient *dns.DnsClient, err error) {
+	if hc.dnsClient != nil {
+		return hc.dnsClient, nil
+	}
+
+	// 未指定 project_id 时 SDK 会通过 IAM 自动获取
 	auth, err := basic.NewCredentialsBuilder().
 		WithAk(hc.AccessKeyId).
 		WithSk(hc.SecretAccessKey).
+		WithProjectId(hc.ProjectId).
 		SafeBuild()
 	if err != nil {
 		return
 	}
 
-	hr, err := region.SafeValueOf(huaweiCloudRegion)
-	if err != nil {
-		return
+	if hc.Region == "" {
+		hc.Region = huaweiCloudDefaultRegion
+	}
+
+	var hr *hwRegion.Region
+	if hc.Endpoint != "" {
+		// 自定义 endpoint 时不必是 SDK 内置的区域
+		endpoint := hc.Endpoint
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		hr = hwRegion.NewRegion(hc.Region, strings.TrimSuffix(endpoint, "/"))
+	} else {
+		hr, err = region.SafeValueOf(hc.Region)
+		if err != nil {
+			return
+		}
 	}
 
 	hhc, err := dns.DnsClientBuilder().
@@ -105,8 +209,20 @@ func (hc *HuaweiCloud) getZoneId() (err error) {
 		return
 	}
 
+	hc.dnsClient = dns.NewDnsClient(hhc)
+	return hc.dnsClient, nil
+}
+
+func (hc *HuaweiCloud) getZoneId() (err error) {
+	dnsClient, err := hc.getClient()
+	if err != nil {
+		return
+	}
+
 	request := &model.ListPublicZonesRequest{}
-	response, err := dns.NewDnsClient(hhc).ListPublicZones(request)
+	start := time.Now()
+	response, err := dnsClient.ListPublicZones(request)
+	observeAPI(common.HuaweiCloud, start)
 	if err != nil {
 		return
 	}
@@ -121,70 +237,60 @@ func (hc *HuaweiCloud) getZoneId() (err error) {
 	return
 }
 
-func (hc *HuaweiCloud) getParseRecord(domain, recordType string) (recordSetId, recordIP string, err error) {
-	auth, err := basic.NewCredentialsBuilder().
-		WithAk(hc.AccessKeyId).
-		WithSk(hc.SecretAccessKey).
-		SafeBuild()
-	if err != nil {
-		return
-	}
-
-	hr, err := region.SafeValueOf(huaweiCloudRegion)
-	if err != nil {
-		return
-	}
-
-	hhc, err := dns.DnsClientBuilder().
-		WithRegion(hr).
-		WithCredential(auth).
-		SafeBuild()
+func (hc *HuaweiCloud) getParseRecord(domain, recordType string) (recordSetId string, records []string, err error) {
+	dnsClient, err := hc.getClient()
 	if err != nil {
 		return
 	}
 
+	searchMode := "equal"
 	request := &model.ListRecordSetsByZoneRequest{}
 	request.ZoneId = hc.ZoneId
+	request.Name = &domain
+	request.Type = &recordType
+	request.SearchMode = &searchMode
 
-	response, err := dns.NewDnsClient(hhc).ListRecordSetsByZone(request)
-	if err != nil {
+	start := time.Now()
+	response, err := dnsClient.ListRecordSetsByZone(request)
+	observeAPI(common.HuaweiCloud, start)
+	if err != nil || response.Recordsets == nil {
 		return
 	}
 
 	for _, v := range *response.Recordsets {
-		if *v.Name == domain && *v.Type == recordType {
+		if v.Name != nil && *v.Name == domain && v.Type != nil && *v.Type == recordType &&
+			v.Id != nil && v.Records != nil && len(*v.Records) > 0 {
 			recordSetId = *v.Id
-			for _, vv := range *v.Records {
-				recordIP = vv
-			}
+			records = *v.Records
 			break
 		}
 	}
 
-	if recordSetId == "" || recordIP == "" {
-		err = errors.New(huaweiCloudPrefix + domain + " 的 " + recordType + " 解析记录不存在")
-	}
 	return
 }
 
-func (hc *HuaweiCloud) updateParseRecord(ipAddr, recordSetId, recordType, domain string) (err error) {
-	auth, err := basic.NewCredentialsBuilder().
-		WithAk(hc.AccessKeyId).
-		WithSk(hc.SecretAccessKey).
-		SafeBuild()
+func (hc *HuaweiCloud) createParseRecord(records []string, recordType, domain string) (err error) {
+	dnsClient, err := hc.getClient()
 	if err != nil {
 		return
 	}
 
-	hr, err := region.SafeValueOf(huaweiCloudRegion)
-	if err != nil {
-		return
+	request := &model.CreateRecordSetRequest{}
+	request.ZoneId = hc.ZoneId
+	request.Body = &model.CreateRecordSetRequestBody{
+		Name:    domain,
+		Type:    recordType,
+		Records: records,
 	}
 
-	hhc, err := dns.DnsClientBuilder().
-		WithRegion(hr).
-		WithCredential(auth).
-		SafeBuild()
+	start := time.Now()
+	_, err = dnsClient.CreateRecordSet(request)
+	observeAPI(common.HuaweiCloud, start)
+	return
+}
+
+func (hc *HuaweiCloud) updateParseRecord(records []string, recordSetId, recordType, domain string) (err error) {
+	dnsClient, err := hc.getClient()
 	if err != nil {
 		return
 	}
@@ -192,13 +298,14 @@ func (hc *HuaweiCloud) updateParseRecord(ipAddr, recordSetId, recordType, domain
 	request := &model.UpdateRecordSetRequest{}
 	request.ZoneId = hc.ZoneId
 	request.RecordsetId = recordSetId
-	listRecordsBody := []string{ipAddr}
 	request.Body = &model.UpdateRecordSetReq{
-		Records: &listRecordsBody,
+		Records: &records,
 		Type:    &recordType,
 		Name:    &domain,
 	}
 
-	_, err = dns.NewDnsClient(hhc).UpdateRecordSet(request)
+	start := time.Now()
+	_, err = dnsClient.UpdateRecordSet(request)
+	observeAPI(common.HuaweiCloud, start)
 	return
 }
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ipSourceFormatWatchdog = "ddns-watchdog"
+	ipSourceFormatText     = "text"
+	ipSourceFormatJson     = "json"
+	ipSourceDefaultTimeout = 10 * time.Second
+	// ipSourceMaxBody 回显服务的响应很小，限制读取长度以防异常响应
+	ipSourceMaxBody = 64 << 10
+)
+
+type ipSourceResult struct {
+	url string
+	ip  string
+	err error
+}
+
+// check quorum 不能超过已配置的来源数，否则每次获取都会失败
+func (conf ipSources) check() error {
+	if conf.Quorum < 0 {
+		return errors.New("quorum 不能小于 0")
+	}
+	if conf.TimeoutSeconds < 0 {
+		return errors.New("timeout_seconds 不能小于 0")
+	}
+	for _, list := range []struct {
+		name    string
+		sources []ipSource
+	}{{"ipv4", conf.IPv4}, {"ipv6", conf.IPv6}} {
+		if len(list.sources) > 0 && conf.Quorum > len(list.sources) {
+			return errors.New("quorum " + strconv.Itoa(conf.Quorum) + " 超过了 " + list.name + " 的来源数 " +
+				strconv.Itoa(len(list.sources)))
+		}
+	}
+	return nil
+}
+
+// queryIPSources 并行查询全部 IP 来源，相同结果的来源数达到 quorum 才采用
+// quorum 未配置时需要过半数来源一致
+func queryIPSources(conf ipSources, sources []ipSource, ipv6 bool) (ip string, err error) {
+	timeout := ipSourceDefaultTimeout
+	if conf.TimeoutSeconds > 0 {
+		timeout = time.Duration(conf.TimeoutSeconds) * time.Second
+	}
+	quorum := conf.Quorum
+	if quorum <= 0 {
+		quorum = len(sources)/2 + 1
+	}
+
+	results := make([]ipSourceResult, len(sources))
+	wg := sync.WaitGroup{}
+	for i, src := range sources {
+		wg.Go(func() {
+			results[i].url = src.URL
+			results[i].ip, results[i].err = fetchIPSource(src, timeout, ipv6)
+		})
+	}
+	wg.Wait()
+
+	// 统计完全部票数后再取票数最多的结果，票数相同的取先出现的结果
+	votes := make(map[string]int)
+	var order []string
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		if votes[r.ip] == 0 {
+			order = append(order, r.ip)
+		}
+		votes[r.ip]++
+	}
+	best, tie := "", false
+	for _, ip := range order {
+		switch {
+		case best == "" || votes[ip] > votes[best]:
+			best, tie = ip, false
+		case votes[ip] == votes[best]:
+			tie = true
+		}
+	}
+
+	// 记录失败和结果不一致的来源
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			slog.Warn("IP 来源获取失败", "source", common.RedactURL(r.url), "error", common.RedactError(r.err))
+		case r.ip != best:
+			slog.Warn("IP 来源与多数结果不一致", "source", common.RedactURL(r.url), "ip", r.ip, "best", best)
+		}
+	}
+
+	if best == "" {
+		return "", errors.New("所有 IP 来源都获取失败")
+	}
+	if tie || votes[best] < quorum {
+		return "", errors.New("IP 来源未达成一致：最多 " + strconv.Itoa(votes[best]) +
+			" 个来源返回相同结果，需要 " + strconv.Itoa(quorum) + " 个")
+	}
+	return best, nil
+}
+
+func fetchIPSource(src ipSource, timeout time.Duration, ipv6 bool) (ip string, err error) {
+	ctx, cancel := context.WithTimeout(requestCtx, timeout)
+	defer cancel()
+
+	req, err := httpNewRequest(http.MethodGet, src.URL, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := ipHttpClient(ipv6).Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("HTTP " + strconv.Itoa(resp.StatusCode))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, ipSourceMaxBody))
+	if err != nil {
+		return
+	}
+
+	switch src.Format {
+	case "", ipSourceFormatWatchdog:
+		var res common.GetIPResp
+		if err = json.Unmarshal(body, &res); err != nil {
+			return
+		}
+		ip = res.IP
+	case ipSourceFormatText:
+		ip = strings.TrimSpace(string(body))
+	case ipSourceFormatJson:
+		if ip, err = jsonField(body, src.Field); err != nil {
+			return
+		}
+	default:
+		return "", errors.New("不支持的 format " + src.Format)
+	}
+
+	return normalizeIP(ip, ipv6)
+}
+
+// jsonField 按 "data.ip" 这样以点分隔的路径取出字符串字段
+func jsonField(body []byte, field string) (value string, err error) {
+	if field == "" {
+		return "", errors.New("format 为 json 时需要配置 field")
+	}
+
+	var v any
+	if err = json.Unmarshal(body, &v); err != nil {
+		return
+	}
+	for key := range strings.SplitSeq(field, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return "", errors.New("响应中没有字段 " + field)
+		}
+		if v, ok = obj[key]; !ok {
+			return "", errors.New("响应中没有字段 " + field)
+		}
+	}
+
+	value, ok := v.(string)
+	if !ok {
+		return "", errors.New("响应中的字段 " + field + " 不是字符串")
+	}
+	return
+}
+
+// normalizeIP 校验地址类型，并统一成相同的写法以便比较
+func normalizeIP(ip string, ipv6 bool) (string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", errors.New("返回的内容不是 IP 地址")
+	}
+	addr = addr.WithZone("")
+	if ipv6 {
+		if !addr.Is6() || addr.Is4In6() {
+			return "", errors.New("返回的 " + ip + " 不是 IPv6 地址")
+		}
+		return common.ExpandIPv6Zero(addr.String()), nil
+	}
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return "", errors.New("返回的 " + ip + " 不是 IPv4 地址")
+	}
+	return addr.String(), nil
+}
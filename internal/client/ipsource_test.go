@@ -0,0 +1,165 @@
+package client
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newIPSourceServer(t *testing.T, body string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// newIPSourceServer6 只监听 IPv6 回环地址，环境不支持 IPv6 时返回空
+func newIPSourceServer6(t *testing.T, body string) string {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		return ""
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestQueryIPSources(t *testing.T) {
+	watchdog := newIPSourceServer(t, `{"ip":"192.0.2.1","latest_version":"v1"}`)
+	text := newIPSourceServer(t, "192.0.2.1\n")
+	nested := newIPSourceServer(t, `{"data":{"ip":"192.0.2.1"}}`)
+	wrong := newIPSourceServer(t, "192.0.2.99")
+	garbage := newIPSourceServer(t, "<html>502 Bad Gateway")
+	v6 := newIPSourceServer(t, "2001:db8::1")
+	v6Only := newIPSourceServer6(t, "2001:db8::1")
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	tests := []struct {
+		name    string
+		conf    ipSources
+		sources []ipSource
+		ipv6    bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "majority",
+			sources: []ipSource{
+				{URL: watchdog},
+				{URL: text, Format: "text"},
+				{URL: nested, Format: "json", Field: "data.ip"},
+				{URL: wrong, Format: "text"},
+			},
+			want: "192.0.2.1",
+		},
+		{
+			name: "failures do not count",
+			sources: []ipSource{
+				{URL: text, Format: "text"},
+				{URL: garbage, Format: "text"},
+				{URL: slow.URL, Format: "text"},
+			},
+			conf: ipSources{Quorum: 1, TimeoutSeconds: 1},
+			want: "192.0.2.1",
+		},
+		{
+			name: "quorum not reached",
+			sources: []ipSource{
+				{URL: text, Format: "text"},
+				{URL: garbage, Format: "text"},
+				{URL: wrong, Format: "text"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "tie",
+			sources: []ipSource{
+				{URL: text, Format: "text"},
+				{URL: wrong, Format: "text"},
+			},
+			conf:    ipSources{Quorum: 1},
+			wantErr: true,
+		},
+		{
+			// 出现过平票后领先的结果仍然可以采用
+			name: "tie broken later",
+			sources: []ipSource{
+				{URL: text, Format: "text"},
+				{URL: wrong, Format: "text"},
+				{URL: watchdog},
+			},
+			conf: ipSources{Quorum: 2},
+			want: "192.0.2.1",
+		},
+		{
+			name:    "wrong family",
+			sources: []ipSource{{URL: v6, Format: "text"}},
+			wantErr: true,
+		},
+		{
+			// IPv6 查询只能通过 IPv6 连接，即使来源地址是 IPv4
+			name:    "ipv6 dials over ipv6",
+			sources: []ipSource{{URL: v6, Format: "text"}},
+			ipv6:    true,
+			wantErr: true,
+		},
+		{
+			name:    "ipv6",
+			sources: []ipSource{{URL: v6Only, Format: "text"}},
+			ipv6:    true,
+			want:    "2001:db8:0:0:0:0:0:1",
+		},
+		{
+			name:    "missing json field",
+			sources: []ipSource{{URL: nested, Format: "json", Field: "data.addr"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.sources) > 0 && tt.sources[0].URL == "" {
+				t.Skip("不支持 IPv6")
+			}
+			got, err := queryIPSources(tt.conf, tt.sources, tt.ipv6)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPSourcesCheck(t *testing.T) {
+	two := []ipSource{{URL: "https://a.example.com"}, {URL: "https://b.example.com"}}
+	for _, tt := range []struct {
+		name string
+		conf ipSources
+		ok   bool
+	}{
+		{"default", ipSources{IPv4: two}, true},
+		{"quorum equals sources", ipSources{IPv4: two, Quorum: 2}, true},
+		{"quorum exceeds sources", ipSources{IPv4: two, IPv6: two[:1], Quorum: 2}, false},
+		{"negative timeout", ipSources{IPv4: two, TimeoutSeconds: -1}, false},
+	} {
+		if err := tt.conf.check(); (err == nil) != tt.ok {
+			t.Errorf("%s: check() = %v", tt.name, err)
+		}
+	}
+}
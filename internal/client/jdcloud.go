@@ -0,0 +1,306 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"ddns-watchdog/internal/common"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	JDCloudConfFilename = "jdcloud.json"
+	jdCloudPrefix       = "JDCloud: "
+	jdCloudEndpoint     = "https://domainservice.jdcloud-api.com"
+	jdCloudRegion       = "cn-north-1"
+	jdCloudDefaultView  = -1
+	jdCloudDefaultTTL   = 600
+)
+
+var jdCloudSigner = v4Signer{
+	algorithm:  "JDCLOUD2-HMAC-SHA256",
+	keyPrefix:  "JDCLOUD2",
+	terminator: "jdcloud2_request",
+	dateHeader: "x-jdcloud-date",
+	region:     jdCloudRegion,
+	service:    "domainservice",
+}
+
+type JDCloud struct {
+	AccessKeyId     string           `json:"access_key_id"`
+	SecretAccessKey string           `json:"secret_access_key"`
+	Endpoint        string           `json:"endpoint"`
+	Domain          string           `json:"domain"`
+	SubDomain       common.Subdomain `json:"sub_domain"`
+	DomainId        int64            `json:"-"`
+}
+
+type jdCloudResp struct {
+	Error *struct {
+		Code    int    `json:"code"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+type jdCloudDomains struct {
+	DataList []struct {
+		Id         int64  `json:"id"`
+		DomainName string `json:"domainName"`
+	} `json:"dataList"`
+}
+
+type jdCloudRecord struct {
+	Id         int64  `json:"id"`
+	HostRecord string `json:"hostRecord"`
+	HostValue  string `json:"hostValue"`
+	Type       string `json:"type"`
+	TTL        int    `json:"ttl"`
+	ViewValue  int    `json:"viewValue"`
+}
+
+type jdCloudRecords struct {
+	DataList []jdCloudRecord `json:"dataList"`
+}
+
+type jdCloudModifyRequest struct {
+	Req struct {
+		DomainName string `json:"domainName"`
+		HostRecord string `json:"hostRecord"`
+		HostValue  string `json:"hostValue"`
+		TTL        int    `json:"ttl"`
+		Type       string `json:"type"`
+		ViewValue  int    `json:"viewValue"`
+	} `json:"req"`
+}
+
+func (jc *JDCloud) InitConf() (msg string, err error) {
+	*jc = JDCloud{
+		AccessKeyId: "在 https://uc.jdcloud.com/account/accesskey 获取",
+		Domain:      "example.com",
+		SubDomain: common.Subdomain{
+			A:    "A记录子域名",
+			AAAA: "AAAA记录子域名",
+		},
+	}
+	jc.SecretAccessKey = jc.AccessKeyId
+
+	return "初始化 " + ConfDir + "/" + JDCloudConfFilename,
+		common.MarshalAndSave(jc, ConfDir+"/"+JDCloudConfFilename)
+}
+
+func (jc *JDCloud) LoadConf() (err error) {
+	if err = common.LoadAndUnmarshal(ConfDir+"/"+JDCloudConfFilename, &jc); err != nil {
+		return
+	}
+	return jc.check()
+}
+
+func (jc *JDCloud) check() error {
+	if jc.AccessKeyId == "" || jc.SecretAccessKey == "" || jc.Domain == "" || (jc.SubDomain.A == "" && jc.SubDomain.AAAA == "") {
+		return errors.New("请打开配置文件 " + ConfDir + "/" + JDCloudConfFilename + " 检查你的 access_key_id, secret_access_key, domain, sub_domain 并重新启动")
+	}
+	return nil
+}
+
+func (jc *JDCloud) Run(enabled common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
+	if jc.DomainId == 0 && (enabled.IPv4 || enabled.IPv6) {
+		if err := jc.getDomainId(); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+	if ipv4 != "" && enabled.IPv4 && jc.SubDomain.A != "" {
+		if m, err := jc.syncParseRecord(ipv4, "A", jc.SubDomain.A); err != nil {
+			errs = append(errs, err)
+		} else if m != "" {
+			msg = append(msg, m)
+		}
+	}
+	if ipv6 != "" && enabled.IPv6 && jc.SubDomain.AAAA != "" {
+		if m, err := jc.syncParseRecord(ipv6, "AAAA", jc.SubDomain.AAAA); err != nil {
+			errs = append(errs, err)
+		} else if m != "" {
+			msg = append(msg, m)
+		}
+	}
+	return
+}
+
+// RunHosts 为局域网主机发布 AAAA 记录，主机的完整域名需要属于 domain
+func (jc *JDCloud) RunHosts(hosts []common.HostAddr) (msg []string, errs []error) {
+	if jc.DomainId == 0 && len(hosts) != 0 {
+		if err := jc.getDomainId(); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+	return runHosts(jdCloudPrefix, hosts, func(fqdn string) (string, error) {
+		return subDomainOf(fqdn, jc.Domain)
+	}, jc.syncParseRecord)
+}
+
+// RecordNames 返回 A 和 AAAA 记录的完整域名
+func (jc *JDCloud) RecordNames() common.Subdomain {
+	return common.Subdomain{A: fqdnOf(jc.SubDomain.A, jc.Domain), AAAA: fqdnOf(jc.SubDomain.AAAA, jc.Domain)}
+}
+
+func (jc *JDCloud) syncParseRecord(ipAddr, recordType, subDomain string) (msg string, err error) {
+	ev := updateEvent{provider: common.JDCloud, record: fqdnOf(subDomain, jc.Domain), recordType: recordType, newIP: ipAddr}
+	defer func() { err = ev.done(msg != "", err) }()
+
+	// 获取解析记录
+	record, err := jc.getParseRecord(subDomain, recordType)
+	ev.oldIP = record.HostValue
+	switch {
+	case err != nil:
+	case record.Id == 0:
+		// 新建解析记录
+		record = jdCloudRecord{
+			HostRecord: subDomain,
+			Type:       recordType,
+			TTL:        jdCloudDefaultTTL,
+			ViewValue:  jdCloudDefaultView,
+		}
+		if err = jc.updateParseRecord(ipAddr, record); err == nil {
+			msg = jdCloudPrefix + subDomain + "." + jc.Domain + " 已新建解析记录 " + ipAddr
+		}
+	case record.HostValue != ipAddr:
+		// 更新解析记录
+		if err = jc.updateParseRecord(ipAddr, record); err == nil {
+			msg = jdCloudPrefix + subDomain + "." + jc.Domain + " 已更新解析记录 " + ipAddr
+		}
+	}
+	return
+}
+
+func (jc *JDCloud) getDomainId() (err error) {
+	query := url.Values{
+		"domainName": {jc.Domain},
+		"pageNumber": {"1"},
+		"pageSize":   {"10"},
+	}
+
+	var result jdCloudDomains
+	if err = jc.request(http.MethodGet, "/domain", query, nil, &result); err != nil {
+		return
+	}
+
+	for _, v := range result.DataList {
+		if v.DomainName == jc.Domain {
+			jc.DomainId = v.Id
+			break
+		}
+	}
+	if jc.DomainId == 0 {
+		err = errors.New(jdCloudPrefix + jc.Domain + " 域名不存在")
+	}
+	return
+}
+
+func (jc *JDCloud) getParseRecord(subDomain, recordType string) (record jdCloudRecord, err error) {
+	query := url.Values{
+		"search":     {subDomain},
+		"pageNumber": {"1"},
+		"pageSize":   {"100"},
+	}
+
+	var result jdCloudRecords
+	path := "/domain/" + strconv.FormatInt(jc.DomainId, 10) + "/ResourceRecord"
+	if err = jc.request(http.MethodGet, path, query, nil, &result); err != nil {
+		return
+	}
+
+	for _, v := range result.DataList {
+		if v.HostRecord == subDomain && v.Type == recordType {
+			record = v
+			break
+		}
+	}
+
+	return
+}
+
+// updateParseRecord record.Id 为 0 时新建解析记录
+func (jc *JDCloud) updateParseRecord(ipAddr string, record jdCloudRecord) (err error) {
+	var reqData jdCloudModifyRequest
+	reqData.Req.DomainName = jc.Domain
+	reqData.Req.HostRecord = record.HostRecord
+	reqData.Req.HostValue = ipAddr
+	reqData.Req.TTL = record.TTL
+	reqData.Req.Type = record.Type
+	reqData.Req.ViewValue = record.ViewValue
+	if reqData.Req.ViewValue == 0 {
+		reqData.Req.ViewValue = jdCloudDefaultView
+	}
+
+	path := "/domain/" + strconv.FormatInt(jc.DomainId, 10) + "/ResourceRecord"
+	if record.Id == 0 {
+		return jc.request(http.MethodPost, path, nil, reqData, nil)
+	}
+	return jc.request(http.MethodPut, path+"/"+strconv.FormatInt(record.Id, 10), nil, reqData, nil)
+}
+
+func (jc *JDCloud) request(method, path string, query url.Values, body, result any) (err error) {
+	var reqJson []byte
+	if body != nil {
+		if reqJson, err = json.Marshal(body); err != nil {
+			return
+		}
+	}
+
+	u := endpointOr(jc.Endpoint, jdCloudEndpoint) + "/v2/regions/" + jdCloudRegion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := httpNewRequest(method, u, bytes.NewReader(reqJson))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-jdcloud-nonce", jdCloudNonce())
+	jdCloudSigner.sign(req, reqJson, jc.AccessKeyId, jc.SecretAccessKey, time.Now())
+
+	start := time.Now()
+	resp, err := common.DefaultHttpClient.Do(req)
+	observeAPI(common.JDCloud, start)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	respJson, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	var res jdCloudResp
+	if err = json.Unmarshal(respJson, &res); err != nil {
+		return
+	}
+	if res.Error != nil {
+		return errors.New(jdCloudPrefix + res.Error.Status + ": " + res.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(jdCloudPrefix + "HTTP " + strconv.Itoa(resp.StatusCode))
+	}
+
+	if result == nil || len(res.Result) == 0 {
+		return
+	}
+	return json.Unmarshal(res.Result, result)
+}
+
+func jdCloudNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	lanHostDefaultPrefixLength = 64
+	lanHostMinPrefixLength     = 48
+)
+
+// check 校验 lan_hosts 的配置，错误信息由调用方补充配置文件位置
+func (conf lanHosts) check() error {
+	if conf.PrefixLength != 0 && (conf.PrefixLength < lanHostMinPrefixLength || conf.PrefixLength > lanHostDefaultPrefixLength) {
+		return errors.New("的 prefix_length 只能在 " + strconv.Itoa(lanHostMinPrefixLength) + " 到 " +
+			strconv.Itoa(lanHostDefaultPrefixLength) + " 之间")
+	}
+	if len(conf.Hosts) == 0 {
+		return errors.New("没有填写 hosts")
+	}
+	for _, h := range conf.Hosts {
+		if h.Name == "" {
+			return errors.New("的 hosts 有主机没有填写 name")
+		}
+		if _, err := h.interfaceId(); err != nil {
+			return errors.New("的 " + h.Name + " " + err.Error())
+		}
+	}
+	return nil
+}
+
+// interfaceId 返回主机在前缀之外的部分
+func (h lanHost) interfaceId() (id [16]byte, err error) {
+	if h.Suffix == "" && h.MAC == "" {
+		return id, errors.New("需要填写 suffix 或 mac")
+	}
+	if h.Suffix != "" {
+		addr, e := netip.ParseAddr(h.Suffix)
+		if e != nil || !addr.Is6() || addr.Is4In6() {
+			return id, errors.New("的 suffix " + h.Suffix + " 不是 \"::1234\" 这样的 IPv6 写法")
+		}
+		id = addr.As16()
+	}
+	if h.MAC != "" {
+		mac, e := net.ParseMAC(h.MAC)
+		if e != nil || len(mac) != 6 {
+			return id, errors.New("的 mac " + h.MAC + " 格式错误")
+		}
+		// EUI-64：中间插入 fffe，翻转 U/L 位
+		eui := [8]byte{mac[0] ^ 0x02, mac[1], mac[2], 0xff, 0xfe, mac[3], mac[4], mac[5]}
+		copy(id[8:], eui[:])
+	}
+	return
+}
+
+// GetLANHosts 确定当前前缀并生成各局域网主机的地址
+// 前缀优先取自 network_card 指定的网卡，找不到时按 fallbackIPv6 的规则选择其他公网地址
+func GetLANHosts(conf lanHosts, ipv6 string) (prefix string, hosts []common.HostAddr, err error) {
+	src := ipv6
+	if conf.NetworkCard != "" {
+		addrs, e := interfaceAddrs()
+		if e != nil {
+			return "", nil, e
+		}
+		ip, ok := fallbackIPv6(addrs, conf.NetworkCard)
+		if !ok {
+			return "", nil, errors.New("lan_hosts 没有找到可用于确定前缀的公网 IPv6")
+		}
+		src = ip
+	}
+	if src == "" {
+		return "", nil, errors.New("lan_hosts 没有获取到 IPv6，无法确定前缀")
+	}
+
+	bits := conf.PrefixLength
+	if bits == 0 {
+		bits = lanHostDefaultPrefixLength
+	}
+	p, err := lanHostPrefix(src, bits)
+	if err != nil {
+		return
+	}
+
+	for _, h := range conf.Hosts {
+		id, e := h.interfaceId()
+		if e != nil {
+			return "", nil, errors.New("lan_hosts 的 " + h.Name + " " + e.Error())
+		}
+		hosts = append(hosts, common.HostAddr{Name: h.Name, IP: lanHostAddr(p, id)})
+	}
+	return p.String(), hosts, nil
+}
+
+func lanHostPrefix(ip string, bits int) (p netip.Prefix, err error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return p, errors.New("lan_hosts 无法从 " + ip + " 确定 IPv6 前缀")
+	}
+	return addr.WithZone("").Prefix(bits)
+}
+
+// lanHostAddr 前缀之内的位取自 p，其余取自 id
+func lanHostAddr(p netip.Prefix, id [16]byte) string {
+	addr := p.Addr().As16()
+	for i := range addr {
+		bit := i * 8
+		switch {
+		case bit >= p.Bits():
+			addr[i] = id[i]
+		case bit+8 > p.Bits():
+			mask := byte(0xff) >> (p.Bits() - bit)
+			addr[i] = addr[i]&^mask | id[i]&mask
+		}
+	}
+	return common.ExpandIPv6Zero(netip.AddrFrom16(addr).String())
+}
+
+// runHosts 逐个同步局域网主机的 AAAA 记录，name 把完整域名转换为服务商使用的记录名
+func runHosts(prefix string, hosts []common.HostAddr, name func(fqdn string) (string, error),
+	sync func(ipAddr, recordType, name string) (string, error)) (msg []string, errs []error) {
+	for _, h := range hosts {
+		n, err := name(h.Name)
+		if err != nil {
+			errs = append(errs, errors.New(prefix+err.Error()))
+			continue
+		}
+		if m, err := sync(h.IP, "AAAA", n); err != nil {
+			errs = append(errs, err)
+		} else if m != "" {
+			msg = append(msg, m)
+		}
+	}
+	return
+}
+
+// subDomainOf 把完整域名转换为相对 domain 的主机记录，domain 本身为 "@"
+func subDomainOf(fqdn, domain string) (string, error) {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	domain = strings.TrimSuffix(domain, ".")
+	if strings.EqualFold(fqdn, domain) {
+		return "@", nil
+	}
+	if len(fqdn) > len(domain)+1 && strings.EqualFold(fqdn[len(fqdn)-len(domain)-1:], "."+domain) {
+		return fqdn[:len(fqdn)-len(domain)-1], nil
+	}
+	return "", errors.New(fqdn + " 不属于 " + domain)
+}
@@ -0,0 +1,77 @@
+package client
+
+import "testing"
+
+func TestGetLANHosts(t *testing.T) {
+	conf := lanHosts{
+		Enable:       true,
+		PrefixLength: 56,
+		Hosts: []lanHost{
+			{Name: "nas.example.com", Suffix: "::1234"},
+			{Name: "cam.example.com", Suffix: "0:0:0:2::", MAC: "00:11:22:33:44:55"},
+			{Name: "tv.example.com", Suffix: "0:0:ffff:ab00::1"},
+		},
+	}
+
+	prefix, hosts, err := GetLANHosts(conf, "2001:db8:1234:5601:aaaa:bbbb:cccc:dddd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix != "2001:db8:1234:5600::/56" {
+		t.Errorf("prefix = %q", prefix)
+	}
+	want := []string{
+		"2001:db8:1234:5600:0:0:0:1234",
+		"2001:db8:1234:5602:211:22ff:fe33:4455",
+		// 前缀之内的位不受 suffix 影响
+		"2001:db8:1234:5600:0:0:0:1",
+	}
+	for i, h := range hosts {
+		if h.IP != want[i] {
+			t.Errorf("%s = %q, want %q", h.Name, h.IP, want[i])
+		}
+	}
+
+	if _, _, err = GetLANHosts(conf, ""); err == nil {
+		t.Error("没有 IPv6 时应报错")
+	}
+	if _, _, err = GetLANHosts(conf, "192.0.2.1"); err == nil {
+		t.Error("IPv4 不能确定前缀")
+	}
+}
+
+func TestLANHostsCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		conf lanHosts
+		ok   bool
+	}{
+		{"ok", lanHosts{Hosts: []lanHost{{Name: "nas.example.com", Suffix: "::1"}}}, true},
+		{"prefix too long", lanHosts{PrefixLength: 80, Hosts: []lanHost{{Name: "nas.example.com", Suffix: "::1"}}}, false},
+		{"no hosts", lanHosts{}, false},
+		{"no suffix", lanHosts{Hosts: []lanHost{{Name: "nas.example.com"}}}, false},
+		{"ipv4 suffix", lanHosts{Hosts: []lanHost{{Name: "nas.example.com", Suffix: "0.0.0.1"}}}, false},
+		{"bad mac", lanHosts{Hosts: []lanHost{{Name: "nas.example.com", MAC: "00:11:22"}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.conf.check(); (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestSubDomainOf(t *testing.T) {
+	for fqdn, want := range map[string]string{
+		"nas.example.com":      "nas",
+		"a.b.example.com.":     "a.b",
+		"example.com":          "@",
+		"NAS.Example.com":      "NAS",
+		"nas.otherexample.com": "",
+		"nas.example.org":      "",
+	} {
+		got, err := subDomainOf(fqdn, "example.com")
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("%s: got %q, %v, want %q", fqdn, got, err, want)
+		}
+	}
+}
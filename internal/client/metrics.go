@@ -0,0 +1,95 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 获取 IP 的方式，与配置项同名
+const (
+	sourceNetworkCard = "network_card"
+	sourceGateway     = "gateway"
+	sourceDNS         = "dns"
+	sourceSTUN        = "stun"
+	sourceIPSources   = "ip_sources"
+	sourceAPI         = "api_url"
+)
+
+// 解析记录的同步结果
+const (
+	resultUpdated   = "updated"
+	resultUnchanged = "unchanged"
+	resultFailed    = "failed"
+	resultVerified  = "verified"
+)
+
+// Metrics 客户端的指标，配置 metrics_addr 后通过 /metrics 输出
+var Metrics = &common.Metrics{}
+
+var (
+	metricDetect = Metrics.Counter("ddns_watchdog_client_detect_total",
+		"获取 IP 的次数", "source", "type")
+	metricDetectFailures = Metrics.Counter("ddns_watchdog_client_detect_failures_total",
+		"获取 IP 失败的次数", "source", "type")
+	metricIPInfo = Metrics.Gauge("ddns_watchdog_client_ip_info",
+		"当前获取到的 IP", "type", "ip")
+	metricUpdates = Metrics.Counter("ddns_watchdog_client_updates_total",
+		"同步解析记录的次数，result 为 updated, unchanged 或 failed", "provider", "record", "type", "result")
+	metricVerify = Metrics.Counter("ddns_watchdog_client_verify_total",
+		"确认解析记录是否生效的次数，result 为 verified 或 failed", "provider", "record", "type", "result")
+	metricAPIDuration = Metrics.Histogram("ddns_watchdog_client_api_request_duration_seconds",
+		"服务商 API 请求耗时", common.LatencyBuckets, "provider")
+	metricLastSuccess = Metrics.Gauge("ddns_watchdog_client_last_success_timestamp_seconds",
+		"最近一次成功同步解析记录的时间", "provider")
+)
+
+// observeDetect 记录一次获取 IP，source 为空表示没有尝试
+func observeDetect(source, ipType, ip string) {
+	if source == "" {
+		return
+	}
+	metricDetect.Inc(source, ipType)
+	setSourceStatus(source, ipType, ip)
+	if ip == "" {
+		metricDetectFailures.Inc(source, ipType)
+	}
+}
+
+// ObserveIP 记录当前获取到的 IP，旧值会被删除；record_set 时为逗号分隔的整组地址
+func ObserveIP(ipv4, ipv6 string) {
+	metricIPInfo.Reset()
+	for ipType, ips := range map[string]string{"ipv4": ipv4, "ipv6": ipv6} {
+		for _, ip := range uniqueValues(strings.Split(ips, ",")) {
+			metricIPInfo.Set(1, ipType, ip)
+		}
+	}
+}
+
+// observeAPI 记录一次服务商 API 请求的耗时，配合 defer 使用
+func observeAPI(provider string, start time.Time) {
+	metricAPIDuration.Observe(time.Since(start).Seconds(), provider)
+}
+
+// ServeMetrics 在 addr 上提供 /metrics，监听失败时立即返回错误
+func ServeMetrics(addr string) (err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.New("metrics_addr " + err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Metrics)
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      5 * time.Second,
+	}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	return
+}
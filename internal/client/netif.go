@@ -0,0 +1,191 @@
+package client
+
+import (
+	"cmp"
+	"ddns-watchdog/internal/common"
+	"errors"
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	addrScopeGlobal  = "global"
+	addrScopePrivate = "private"
+)
+
+// addrKey 在系统地址属性中定位一个地址
+type addrKey struct {
+	index int
+	addr  netip.Addr
+}
+
+// addrAttr 系统提供的地址属性，不支持的平台上均为零值
+type addrAttr struct {
+	temporary  bool
+	deprecated bool
+	// tentative 重复地址检测尚未完成或已失败
+	tentative bool
+	permanent bool
+	// preferred 剩余首选生存期 (秒)，不会过期时为 0xffffffff
+	preferred uint32
+}
+
+// ifaceAddr 网卡上的一个地址
+type ifaceAddr struct {
+	// key 为 "eth0 0" 这样的名称，与 NetworkInterfaces 一致
+	key    string
+	iface  string
+	prefix netip.Prefix
+	addrAttr
+}
+
+func (a ifaceAddr) String() string {
+	if a.prefix.Addr().Is6() {
+		return common.ExpandIPv6Zero(a.prefix.Addr().String())
+	}
+	return a.prefix.Addr().String()
+}
+
+// interfaceAddrs 列出所有网卡地址，并尽可能带上临时、已弃用等属性
+func interfaceAddrs() (addrs []ifaceAddr, err error) {
+	netInterfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	// 读取不到属性时仍可按地址本身选择
+	attrs, _ := addrAttrs()
+
+	for _, face := range netInterfaces {
+		var ipAddr []net.Addr
+		if ipAddr, err = face.Addrs(); err != nil {
+			return nil, err
+		}
+
+		for i, a := range ipAddr {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(ipNet.IP)
+			if !ok {
+				continue
+			}
+			ip = ip.Unmap()
+			ones, _ := ipNet.Mask.Size()
+			addrs = append(addrs, ifaceAddr{
+				key:      face.Name + " " + strconv.Itoa(i),
+				iface:    face.Name,
+				prefix:   netip.PrefixFrom(ip, ones),
+				addrAttr: attrs[addrKey{face.Index, ip}],
+			})
+		}
+	}
+	return addrs, nil
+}
+
+// isPublicAddr 排除内网、ULA、链路本地和 CGNAT 地址
+func isPublicAddr(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnatPrefix.Contains(addr)
+}
+
+// isPrivateAddr 内网、ULA 和 CGNAT 地址
+func isPrivateAddr(addr netip.Addr) bool {
+	return addr.IsPrivate() || cgnatPrefix.Contains(addr)
+}
+
+// check 校验规则，错误信息由调用方补充配置文件位置
+func (r addrRule) check() error {
+	if _, err := regexp.Compile("^(?:" + r.Interface + ")$"); err != nil {
+		return errors.New("的 interface 不是有效的正则表达式")
+	}
+	switch r.Scope {
+	case "", addrScopeGlobal, addrScopePrivate:
+	default:
+		return errors.New("的 scope 只能是 global 或 private")
+	}
+	if r.Prefix != "" {
+		if _, err := netip.ParsePrefix(r.Prefix); err != nil {
+			return errors.New("的 prefix " + r.Prefix + " 格式错误")
+		}
+	}
+	return nil
+}
+
+// selectAddr 按规则筛选地址，结果按 compareAddr 排序后取第一个，保证每次选择相同
+func selectAddr(addrs []ifaceAddr, rule addrRule, ipv6 bool) (ip string, err error) {
+	ifaceRe, err := regexp.Compile("^(?:" + rule.Interface + ")$")
+	if err != nil {
+		return
+	}
+	var prefix netip.Prefix
+	if rule.Prefix != "" {
+		if prefix, err = netip.ParsePrefix(rule.Prefix); err != nil {
+			return
+		}
+	}
+
+	var candidates []ifaceAddr
+	for _, a := range addrs {
+		addr := a.prefix.Addr()
+		switch {
+		case addr.Is6() != ipv6,
+			!ifaceRe.MatchString(a.iface),
+			prefix.IsValid() && !prefix.Contains(addr),
+			a.deprecated, a.tentative,
+			a.temporary && !rule.AllowTemporary,
+			!addr.IsGlobalUnicast():
+			continue
+		case rule.Scope == addrScopePrivate:
+			if !isPrivateAddr(addr) {
+				continue
+			}
+		default:
+			if !isPublicAddr(addr) {
+				continue
+			}
+		}
+		candidates = append(candidates, a)
+	}
+	if len(candidates) == 0 {
+		return "", errors.New("网卡 " + rule.Interface + " 没有符合规则的地址")
+	}
+	return slices.MinFunc(candidates, compareAddr).String(), nil
+}
+
+// compareAddr 固定地址优先于临时地址，手动配置的地址优先，其次首选生存期更长的地址
+// 都相同时按网卡名和地址排序
+func compareAddr(a, b ifaceAddr) int {
+	if a.temporary != b.temporary {
+		if a.temporary {
+			return 1
+		}
+		return -1
+	}
+	if a.permanent != b.permanent {
+		if a.permanent {
+			return -1
+		}
+		return 1
+	}
+	if c := cmp.Compare(b.preferred, a.preferred); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.iface, b.iface); c != 0 {
+		return c
+	}
+	return a.prefix.Addr().Compare(b.prefix.Addr())
+}
+
+// lookupAddr 按 "eth0 0" 这样的名称查找地址
+func lookupAddr(addrs []ifaceAddr, key string) (string, bool) {
+	for _, a := range addrs {
+		if a.key == key {
+			return a.String(), true
+		}
+	}
+	return "", false
+}
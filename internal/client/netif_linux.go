@@ -0,0 +1,82 @@
+package client
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"syscall"
+)
+
+// ifaFlags IFA_FLAGS 携带完整的 32 位地址标志，syscall 中没有定义
+const ifaFlags = 8
+
+// addrAttrs 通过 rtnetlink 读取地址标志和首选生存期
+func addrAttrs() (attrs map[addrKey]addrAttr, err error) {
+	tab, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_UNSPEC)
+	if err != nil {
+		return
+	}
+	msgs, err := syscall.ParseNetlinkMessage(tab)
+	if err != nil {
+		return
+	}
+
+	attrs = make(map[addrKey]addrAttr)
+	for _, m := range msgs {
+		if m.Header.Type == syscall.NLMSG_DONE {
+			break
+		}
+		if m.Header.Type != syscall.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		key, attr, ok := parseAddrMsg(m)
+		if ok {
+			attrs[key] = attr
+		}
+	}
+	return attrs, nil
+}
+
+// parseAddrMsg 解析一条 RTM_NEWADDR 消息
+func parseAddrMsg(m syscall.NetlinkMessage) (key addrKey, attr addrAttr, ok bool) {
+	rtas, err := syscall.ParseNetlinkRouteAttr(&m)
+	if err != nil {
+		return
+	}
+
+	// ifaddrmsg: family, prefixlen, flags, scope, index
+	flags := uint32(m.Data[2])
+	key.index = int(binary.NativeEndian.Uint32(m.Data[4:8]))
+	var address, local netip.Addr
+	for _, a := range rtas {
+		switch a.Attr.Type {
+		case syscall.IFA_ADDRESS:
+			address, _ = netip.AddrFromSlice(a.Value)
+		case syscall.IFA_LOCAL:
+			local, _ = netip.AddrFromSlice(a.Value)
+		case ifaFlags:
+			if len(a.Value) >= 4 {
+				flags = binary.NativeEndian.Uint32(a.Value)
+			}
+		case syscall.IFA_CACHEINFO:
+			// ifa_cacheinfo 的第一个字段是 ifa_prefered
+			if len(a.Value) >= 4 {
+				attr.preferred = binary.NativeEndian.Uint32(a.Value)
+			}
+		}
+	}
+
+	// 点对点链路上 IFA_ADDRESS 是对端地址，本机地址在 IFA_LOCAL
+	key.addr = address
+	if local.IsValid() {
+		key.addr = local
+	}
+	if !key.addr.IsValid() {
+		return
+	}
+
+	attr.temporary = flags&syscall.IFA_F_TEMPORARY != 0
+	attr.deprecated = flags&syscall.IFA_F_DEPRECATED != 0
+	attr.tentative = flags&(syscall.IFA_F_TENTATIVE|syscall.IFA_F_DADFAILED) != 0
+	attr.permanent = flags&syscall.IFA_F_PERMANENT != 0
+	return key, attr, true
+}
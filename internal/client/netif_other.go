@@ -0,0 +1,8 @@
+//go:build !linux
+
+package client
+
+// addrAttrs 其他平台暂不读取地址属性，只按地址本身选择
+func addrAttrs() (map[addrKey]addrAttr, error) {
+	return nil, nil
+}
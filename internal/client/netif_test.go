@@ -0,0 +1,77 @@
+package client
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func newIfaceAddr(key, iface, prefix string, attr addrAttr) ifaceAddr {
+	return ifaceAddr{key: key, iface: iface, prefix: netip.MustParsePrefix(prefix), addrAttr: attr}
+}
+
+var testIfaceAddrs = []ifaceAddr{
+	newIfaceAddr("lo 0", "lo", "127.0.0.1/8", addrAttr{permanent: true}),
+	newIfaceAddr("eth0 0", "eth0", "192.168.1.2/24", addrAttr{permanent: true}),
+	newIfaceAddr("eth0 1", "eth0", "2001:db8:1::aaaa/64", addrAttr{temporary: true, preferred: 86400}),
+	newIfaceAddr("eth0 2", "eth0", "2001:db8:1::bbbb/64", addrAttr{preferred: 3600}),
+	newIfaceAddr("eth0 3", "eth0", "2001:db8:1::cccc/64", addrAttr{preferred: 7200}),
+	newIfaceAddr("eth0 4", "eth0", "2001:db8:0:1::dddd/64", addrAttr{deprecated: true}),
+	newIfaceAddr("eth0 5", "eth0", "fd00::1/64", addrAttr{permanent: true}),
+	newIfaceAddr("eth0 6", "eth0", "fe80::1/64", addrAttr{permanent: true}),
+	newIfaceAddr("ppp0 0", "ppp0", "100.64.3.4/32", addrAttr{permanent: true}),
+	newIfaceAddr("wan1 0", "wan1", "203.0.113.5/24", addrAttr{permanent: true}),
+	newIfaceAddr("wan2 0", "wan2", "198.51.100.5/24", addrAttr{permanent: true}),
+}
+
+func TestSelectAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		rule addrRule
+		ipv6 bool
+		want string
+	}{
+		{"longest preferred lifetime", addrRule{Interface: "eth0"}, true, "2001:db8:1:0:0:0:0:cccc"},
+		{"temporary allowed", addrRule{Interface: "eth0", AllowTemporary: true}, true, "2001:db8:1:0:0:0:0:cccc"},
+		{"prefix", addrRule{Interface: "eth0", Prefix: "2001:db8:0:1::/64"}, true, ""},
+		{"ula", addrRule{Interface: "eth0", Scope: addrScopePrivate}, true, "fd00:0:0:0:0:0:0:1"},
+		{"regex sorted by name", addrRule{Interface: "wan[0-9]+"}, false, "203.0.113.5"},
+		{"regex must match whole name", addrRule{Interface: "wan"}, false, ""},
+		{"cgnat excluded", addrRule{Interface: "ppp0"}, false, ""},
+		{"cgnat as private", addrRule{Interface: "ppp0", Scope: addrScopePrivate}, false, "100.64.3.4"},
+		{"private ipv4", addrRule{Interface: "eth0|lo", Scope: addrScopePrivate}, false, "192.168.1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectAddr(testIfaceAddrs, tt.rule, tt.ipv6)
+			if (err != nil) != (tt.want == "") {
+				t.Fatalf("err = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallbackIPv6(t *testing.T) {
+	tests := []struct {
+		preferred string
+		want      string
+	}{
+		{"eth0 2", "2001:db8:1:0:0:0:0:bbbb"},
+		// 已弃用的地址不能直接使用，回退到同名网卡
+		{"eth0 4", "2001:db8:1:0:0:0:0:cccc"},
+		{"eth0 9", "2001:db8:1:0:0:0:0:cccc"},
+		{"eth9 0", "2001:db8:1:0:0:0:0:cccc"},
+		{"", "2001:db8:1:0:0:0:0:cccc"},
+	}
+	for _, tt := range tests {
+		// 多次选择的结果必须一致
+		for range 3 {
+			got, ok := fallbackIPv6(testIfaceAddrs, tt.preferred)
+			if !ok || got != tt.want {
+				t.Fatalf("%q: ip = %q, %v, want %q", tt.preferred, got, ok, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package client
+
+import "time"
+
+// netWatchDebounce 网络变化往往成批出现，等待平静后再触发检查
+const netWatchDebounce = 2 * time.Second
+
+// WatchNetwork 网卡地址或默认路由变化时发出通知，不支持的平台返回错误
+func WatchNetwork() (<-chan struct{}, error) {
+	events, err := watchNetwork()
+	if err != nil {
+		return nil, err
+	}
+	return debounce(events, netWatchDebounce), nil
+}
+
+// debounce 在 in 停止发送 wait 之后才向返回的通道发送一次，来不及处理的通知会合并
+func debounce(in <-chan struct{}, wait time.Duration) <-chan struct{} {
+	out := make(chan struct{}, 1)
+	go func() {
+		defer close(out)
+		timer := time.NewTimer(wait)
+		timer.Stop()
+		for {
+			select {
+			case _, ok := <-in:
+				if !ok {
+					timer.Stop()
+					return
+				}
+				timer.Reset(wait)
+			case <-timer.C:
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return out
+}
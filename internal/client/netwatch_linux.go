@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"log/slog"
+	"syscall"
+)
+
+// rtnetlink 多播组，syscall 中没有定义
+const (
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6IfAddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// watchNetwork 订阅 rtnetlink 的地址和路由变化
+func watchNetwork() (<-chan struct{}, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	sa := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr | rtmgrpIPv4Route | rtmgrpIPv6Route,
+	}
+	if err = syscall.Bind(fd, sa); err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer syscall.Close(fd)
+
+		buf := make([]byte, 1<<16)
+		for {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			switch {
+			case errors.Is(err, syscall.EINTR):
+				continue
+			case errors.Is(err, syscall.ENOBUFS):
+				// 接收缓冲区溢出丢了消息，当作发生了变化
+				notify(events)
+				continue
+			case err != nil:
+				slog.Warn("停止监听网络变化", "error", err)
+				return
+			}
+
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, m := range msgs {
+				if isNetChange(m) {
+					notify(events)
+					break
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// isNetChange 地址增删和默认路由变化才需要重新检查
+func isNetChange(m syscall.NetlinkMessage) bool {
+	switch m.Header.Type {
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		return true
+	case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+		// rtmsg: family, dst_len, ...
+		return len(m.Data) >= syscall.SizeofRtMsg && m.Data[1] == 0
+	}
+	return false
+}
+
+func notify(events chan<- struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package client
+
+import "errors"
+
+func watchNetwork() (<-chan struct{}, error) {
+	return nil, errors.New("当前系统不支持监听网络变化")
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	in := make(chan struct{})
+	out := debounce(in, 50*time.Millisecond)
+
+	// 连续的变化只触发一次
+	for range 5 {
+		in <- struct{}{}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Fatal("没有收到通知")
+	}
+	select {
+	case <-out:
+		t.Fatal("重复通知")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	close(in)
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("输入关闭后应关闭输出")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("输出没有关闭")
+	}
+}
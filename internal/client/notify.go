@@ -0,0 +1,24 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"os"
+	"reflect"
+)
+
+// Notifier 客户端的通知，未启用时为 nil
+var Notifier *common.Notifier
+
+// notifyConf Notifier 使用的配置
+var notifyConf common.NotifyConf
+
+// SetupNotifier 按 Client.Notify 设置通知，配置没有变化时保留连续失败次数等状态
+func SetupNotifier() {
+	if Notifier != nil && reflect.DeepEqual(notifyConf, Client.Notify) {
+		return
+	}
+	// 多台客户端通知到同一渠道时以主机名区分
+	hostname, _ := os.Hostname()
+	notifyConf = Client.Notify
+	Notifier = common.NewNotifier(Client.Notify, hostname)
+}
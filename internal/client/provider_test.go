@@ -0,0 +1,361 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// providerCase 描述一个服务商在一致性测试中的接入方式
+type providerCase struct {
+	name string
+	// fake 返回该服务商 API 的假实现
+	fake func(z *fakeZone) http.Handler
+	// newClient 以指定 endpoint 和密钥构造客户端，A 和 AAAA 记录都指向 www
+	newClient func(endpoint, secret string) common.GeneralClient
+	// recordName 是 www 在该服务商 API 中的记录名
+	recordName string
+	// hostRecordName 是局域网主机 nas.example.com 在该服务商 API 中的记录名
+	hostRecordName string
+	// paginated 表示客户端会遍历记录列表的分页
+	paginated bool
+	// multiValue 表示同名记录是一个包含多个值的记录集
+	multiValue bool
+}
+
+var providerCases = []providerCase{
+	{
+		name: "DNSPod",
+		fake: fakeDNSPod,
+		newClient: func(endpoint, secret string) common.GeneralClient {
+			return &DNSPod{ID: fakeId, Token: secret, Endpoint: endpoint, Domain: "example.com",
+				SubDomain: common.Subdomain{A: "www", AAAA: "www"}}
+		},
+		recordName:     "www",
+		hostRecordName: "nas",
+		paginated:      true,
+	},
+	{
+		name: "Cloudflare",
+		fake: fakeCloudflare,
+		newClient: func(endpoint, secret string) common.GeneralClient {
+			return &Cloudflare{ZoneID: fakeZoneId, APIToken: secret, Endpoint: endpoint,
+				Domain: common.Subdomain{A: "www.example.com", AAAA: "www.example.com"}}
+		},
+		recordName:     "www.example.com",
+		hostRecordName: "nas.example.com",
+		paginated:      true,
+	},
+	{
+		name: "AliDNS",
+		fake: fakeAliDNS,
+		newClient: func(endpoint, secret string) common.GeneralClient {
+			id := fakeId
+			if secret != fakeSecret {
+				id = "wrong-id"
+			}
+			return &AliDNS{AccessKeyId: id, AccessKeySecret: secret, Endpoint: endpoint, Domain: "example.com",
+				SubDomain: common.Subdomain{A: "www", AAAA: "www"}}
+		},
+		recordName:     "www",
+		hostRecordName: "nas",
+		paginated:      true,
+	},
+	{
+		name: "HuaweiCloud",
+		fake: fakeHuaweiCloud,
+		newClient: func(endpoint, secret string) common.GeneralClient {
+			id := fakeId
+			if secret != fakeSecret {
+				id = "wrong-id"
+			}
+			return &HuaweiCloud{AccessKeyId: id, SecretAccessKey: secret, Endpoint: endpoint, ProjectId: "fake-project",
+				ZoneName: "example.com.", Domain: common.Subdomain{A: "www.example.com.", AAAA: "www.example.com."}}
+		},
+		recordName:     "www.example.com.",
+		hostRecordName: "nas.example.com.",
+		multiValue:     true,
+	},
+	{
+		name: "Volcengine",
+		fake: fakeVolcengine,
+		newClient: func(endpoint, secret string) common.GeneralClient {
+			id := fakeId
+			if secret != fakeSecret {
+				id = "wrong-id"
+			}
+			return &Volcengine{AccessKeyId: id, SecretAccessKey: secret, Endpoint: endpoint, Domain: "example.com",
+				SubDomain: common.Subdomain{A: "www", AAAA: "www"}}
+		},
+		recordName:     "www",
+		hostRecordName: "nas",
+		paginated:      true,
+	},
+	{
+		name: "BaiduCloud",
+		fake: fakeBaiduCloud,
+		newClient: func(endpoint, secret string) common.GeneralClient {
+			id := fakeId
+			if secret != fakeSecret {
+				id = "wrong-id"
+			}
+			return &BaiduCloud{AccessKeyId: id, SecretAccessKey: secret, Endpoint: endpoint, Domain: "example.com",
+				SubDomain: common.Subdomain{A: "www", AAAA: "www"}}
+		},
+		recordName:     "www",
+		hostRecordName: "nas",
+		paginated:      true,
+	},
+	{
+		name: "JDCloud",
+		fake: fakeJDCloud,
+		newClient: func(endpoint, secret string) common.GeneralClient {
+			id := fakeId
+			if secret != fakeSecret {
+				id = "wrong-id"
+			}
+			return &JDCloud{AccessKeyId: id, SecretAccessKey: secret, Endpoint: endpoint, Domain: "example.com",
+				SubDomain: common.Subdomain{A: "www", AAAA: "www"}}
+		},
+		recordName:     "www",
+		hostRecordName: "nas",
+	},
+}
+
+func TestProviderConformance(t *testing.T) {
+	for _, pc := range providerCases {
+		t.Run(pc.name, func(t *testing.T) {
+			runConformance(t, pc)
+		})
+	}
+}
+
+func runConformance(t *testing.T, pc providerCase) {
+	const (
+		oldIPv4 = "192.0.2.1"
+		newIPv4 = "192.0.2.2"
+		newIPv6 = "2001:db8:0:0:0:0:0:1"
+	)
+	ipv4Only := common.Enable{IPv4: true}
+
+	setup := func(t *testing.T) (*fakeZone, string) {
+		z := &fakeZone{}
+		srv := httptest.NewServer(pc.fake(z))
+		t.Cleanup(srv.Close)
+		return z, srv.URL
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		z, endpoint := setup(t)
+		z.add(pc.recordName, "A", oldIPv4)
+
+		msg, errs := pc.newClient(endpoint, fakeSecret).Run(ipv4Only, oldIPv4, "")
+		if len(errs) != 0 || len(msg) != 0 {
+			t.Fatalf("msg = %v, errs = %v, want nothing", msg, errs)
+		}
+		if z.creates != 0 || z.updates != 0 {
+			t.Errorf("creates = %d, updates = %d, want no writes", z.creates, z.updates)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		z, endpoint := setup(t)
+		z.add(pc.recordName, "A", oldIPv4)
+		z.add(pc.recordName, "AAAA", "2001:db8:0:0:0:0:0:ffff")
+
+		msg, errs := pc.newClient(endpoint, fakeSecret).Run(common.Enable{IPv4: true, IPv6: true}, newIPv4, newIPv6)
+		if len(errs) != 0 {
+			t.Fatalf("errs = %v", errs)
+		}
+		if len(msg) != 2 {
+			t.Errorf("msg = %v, want 2 messages", msg)
+		}
+		if got := z.value(pc.recordName, "A"); got != newIPv4 {
+			t.Errorf("A = %q, want %q", got, newIPv4)
+		}
+		if got := z.value(pc.recordName, "AAAA"); got != newIPv6 {
+			t.Errorf("AAAA = %q, want %q", got, newIPv6)
+		}
+		if z.creates != 0 || z.updates != 2 {
+			t.Errorf("creates = %d, updates = %d, want 0 and 2", z.creates, z.updates)
+		}
+	})
+
+	t.Run("lookup by type", func(t *testing.T) {
+		z, endpoint := setup(t)
+		// 同名的其他类型记录不能被误认为 A 记录
+		z.add(pc.recordName, "TXT", "v=spf1 -all")
+		z.add(pc.recordName, "A", newIPv4)
+
+		msg, errs := pc.newClient(endpoint, fakeSecret).Run(ipv4Only, newIPv4, "")
+		if len(errs) != 0 || len(msg) != 0 {
+			t.Fatalf("msg = %v, errs = %v, want nothing", msg, errs)
+		}
+		if got := z.value(pc.recordName, "TXT"); got != "v=spf1 -all" {
+			t.Errorf("TXT = %q, must not be touched", got)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		z, endpoint := setup(t)
+
+		msg, errs := pc.newClient(endpoint, fakeSecret).Run(ipv4Only, newIPv4, "")
+		if len(errs) != 0 {
+			t.Fatalf("errs = %v", errs)
+		}
+		if len(msg) != 1 {
+			t.Errorf("msg = %v, want 1 message", msg)
+		}
+		if got := z.value(pc.recordName, "A"); got != newIPv4 {
+			t.Errorf("A = %q, want %q", got, newIPv4)
+		}
+		if z.creates != 1 || z.updates != 0 {
+			t.Errorf("creates = %d, updates = %d, want 1 and 0", z.creates, z.updates)
+		}
+	})
+
+	t.Run("paginated", func(t *testing.T) {
+		if !pc.paginated {
+			t.Skip("客户端不遍历分页")
+		}
+		z, endpoint := setup(t)
+		// 服务端不过滤且每页只返回 10 条时，目标记录落在第 4 页
+		z.fuzzy, z.maxPage = true, 10
+		for i := range 35 {
+			z.add("host"+strconv.Itoa(i), "A", oldIPv4)
+		}
+		z.add(pc.recordName, "A", oldIPv4)
+
+		msg, errs := pc.newClient(endpoint, fakeSecret).Run(ipv4Only, newIPv4, "")
+		if len(errs) != 0 {
+			t.Fatalf("errs = %v", errs)
+		}
+		if len(msg) != 1 {
+			t.Errorf("msg = %v, want 1 message", msg)
+		}
+		if z.creates != 0 || z.updates != 1 {
+			t.Errorf("creates = %d, updates = %d, want 0 and 1", z.creates, z.updates)
+		}
+		if got := z.value(pc.recordName, "A"); got != newIPv4 {
+			t.Errorf("A = %q, want %q", got, newIPv4)
+		}
+	})
+
+	// addSet 按服务商的记录模型写入同名的多个值
+	addSet := func(z *fakeZone, typ string, values ...string) {
+		if pc.multiValue {
+			z.add(pc.recordName, typ, strings.Join(values, ","))
+			return
+		}
+		for _, v := range values {
+			z.add(pc.recordName, typ, v)
+		}
+	}
+	runSet := func(t *testing.T, endpoint string, ipv4s []string) ([]string, []error) {
+		c, ok := pc.newClient(endpoint, fakeSecret).(common.RecordSetClient)
+		if !ok {
+			t.Skip("不支持 record_set")
+		}
+		return c.RunSet(ipv4Only, ipv4s, nil)
+	}
+
+	t.Run("record set", func(t *testing.T) {
+		z, endpoint := setup(t)
+		addSet(z, "A", oldIPv4, "192.0.2.9", oldIPv4)
+		want := []string{oldIPv4, newIPv4, "192.0.2.3"}
+
+		_, errs := runSet(t, endpoint, want)
+		if len(errs) != 0 {
+			t.Fatalf("errs = %v", errs)
+		}
+		slices.Sort(want)
+		if got := z.values(pc.recordName, "A"); !slices.Equal(got, want) {
+			t.Errorf("A = %v, want %v", got, want)
+		}
+
+		// 已经一致时不再写入
+		creates, updates, deletes := z.creates, z.updates, z.deletes
+		msg, errs := runSet(t, endpoint, want)
+		if len(errs) != 0 || len(msg) != 0 {
+			t.Fatalf("msg = %v, errs = %v, want nothing", msg, errs)
+		}
+		if z.creates != creates || z.updates != updates || z.deletes != deletes {
+			t.Errorf("second run wrote records")
+		}
+	})
+
+	t.Run("record set removes extras", func(t *testing.T) {
+		z, endpoint := setup(t)
+		addSet(z, "A", oldIPv4, newIPv4, "192.0.2.3")
+		z.add(pc.recordName, "AAAA", newIPv6)
+
+		_, errs := runSet(t, endpoint, []string{newIPv4})
+		if len(errs) != 0 {
+			t.Fatalf("errs = %v", errs)
+		}
+		if got := z.values(pc.recordName, "A"); !slices.Equal(got, []string{newIPv4}) {
+			t.Errorf("A = %v, want only %s", got, newIPv4)
+		}
+		if got := z.value(pc.recordName, "AAAA"); got != newIPv6 {
+			t.Errorf("AAAA = %q, must not be touched", got)
+		}
+	})
+
+	t.Run("record set without addresses", func(t *testing.T) {
+		z, endpoint := setup(t)
+		addSet(z, "A", oldIPv4)
+
+		// 没有获取到地址时不能删光解析记录
+		msg, errs := runSet(t, endpoint, nil)
+		if len(errs) != 0 || len(msg) != 0 {
+			t.Fatalf("msg = %v, errs = %v, want nothing", msg, errs)
+		}
+		if got := z.value(pc.recordName, "A"); got != oldIPv4 {
+			t.Errorf("A = %q, must stay %q", got, oldIPv4)
+		}
+	})
+
+	t.Run("lan hosts", func(t *testing.T) {
+		z, endpoint := setup(t)
+		z.add(pc.hostRecordName, "AAAA", "2001:db8:0:0:0:0:0:ffff")
+
+		c, ok := pc.newClient(endpoint, fakeSecret).(common.LANHostClient)
+		if !ok {
+			t.Fatal("不支持 lan_hosts")
+		}
+		msg, errs := c.RunHosts([]common.HostAddr{{Name: "nas.example.com", IP: newIPv6}})
+		if len(errs) != 0 || len(msg) != 1 {
+			t.Fatalf("msg = %v, errs = %v, want 1 message", msg, errs)
+		}
+		if got := z.value(pc.hostRecordName, "AAAA"); got != newIPv6 {
+			t.Errorf("AAAA = %q, want %q", got, newIPv6)
+		}
+	})
+
+	t.Run("auth failure", func(t *testing.T) {
+		z, endpoint := setup(t)
+		z.add(pc.recordName, "A", oldIPv4)
+
+		msg, errs := pc.newClient(endpoint, "wrong-secret").Run(ipv4Only, newIPv4, "")
+		if len(errs) == 0 {
+			t.Fatalf("msg = %v, want an error", msg)
+		}
+		if got := z.value(pc.recordName, "A"); got != oldIPv4 {
+			t.Errorf("A = %q, must stay %q", got, oldIPv4)
+		}
+	})
+
+	t.Run("malformed response", func(t *testing.T) {
+		z, endpoint := setup(t)
+		z.malformed = true
+
+		msg, errs := pc.newClient(endpoint, fakeSecret).Run(ipv4Only, newIPv4, "")
+		if len(errs) == 0 {
+			t.Fatalf("msg = %v, want an error", msg)
+		}
+	})
+}
@@ -2,14 +2,17 @@ package client
 
 import (
 	"bytes"
+	"cmp"
 	"ddns-watchdog/internal/common"
 	"encoding/json"
 	"errors"
 	"io"
 	"log"
-	"net"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -23,17 +26,26 @@ var (
 	AD      = AliDNS{}
 	Cf      = Cloudflare{}
 	HC      = HuaweiCloud{}
+	VC      = Volcengine{}
+	BC      = BaiduCloud{}
+	JC      = JDCloud{}
 )
 
 // ServiceCallback 服务回调函数类型
 type ServiceCallback func(enabledServices common.Enable, ipv4, ipv6 string) (msg []string, errs []error)
 
+// RecordSetCallback 整组同步解析记录的服务回调函数类型
+type RecordSetCallback func(enabledServices common.Enable, ipv4s, ipv6s []string) (msg []string, errs []error)
+
+// LANHostCallback 为局域网主机发布 AAAA 记录的服务回调函数类型
+type LANHostCallback func(hosts []common.HostAddr) (msg []string, errs []error)
+
 func Install() (err error) {
 	if common.IsWindows() {
 		return errors.New("windows 暂不支持安装到系统")
 	}
-	if Client.CheckCycleMinutes == 0 {
-		err = errors.New("设置一下 " + ConfDir + "/" + ConfFilename + " 的 check_cycle_minutes 吧")
+	if !Client.Periodic() {
+		err = errors.New("设置一下 " + ConfDir + "/" + ConfFilename + " 的 check_cycle_minutes 或 schedule 的 check 吧")
 		return
 	}
 
@@ -85,87 +97,65 @@ func Uninstall() (err error) {
 	return
 }
 
+// NetworkInterfaces 以 "eth0 0" 这样的名称列出所有网卡地址
+// 序号按系统枚举顺序，地址增减或重启后可能变化，需要稳定选择时使用 ipv4_rule / ipv6_rule
 func NetworkInterfaces() (map[string]string, error) {
-	interfaces := make(map[string]string)
-
-	netInterfaces, err := net.Interfaces()
+	addrs, err := interfaceAddrs()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, face := range netInterfaces {
-		var ipAddr []net.Addr
-		ipAddr, err = face.Addrs()
-		if err != nil {
-			return nil, err
-		}
-
-		for i, addrAndMask := range ipAddr {
-			// 分离 IP 和子网掩码
-			ip := addrAndMask.String()
-			if idx := strings.LastIndexByte(ip, '/'); idx != -1 {
-				ip = ip[:idx]
-			}
-			if strings.Contains(ip, ":") {
-				ip = common.ExpandIPv6Zero(ip)
-			}
-			interfaces[face.Name+" "+strconv.Itoa(i)] = ip
-		}
+	interfaces := make(map[string]string, len(addrs))
+	for _, a := range addrs {
+		interfaces[a.key] = a.String()
 	}
 	return interfaces, nil
 }
 
-func fallbackIPv6(interfaces map[string]string, preferred string) (string, bool) {
-	isPublicUnicast := func(ip string) bool {
-		if !strings.Contains(ip, ":") {
-			return false
-		}
-		ipObj := net.ParseIP(ip)
-		if ipObj == nil {
-			return false
-		}
-		return ipObj.IsGlobalUnicast() && !ipObj.IsPrivate()
-	}
+func isPublicUnicast(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && addr.Is6() && !addr.Is4In6() && isPublicAddr(addr)
+}
 
+// fallbackIPv6 指定的地址不可用时，先在同名网卡中、再在所有网卡中按 selectAddr 的规则选择公网地址
+func fallbackIPv6(addrs []ifaceAddr, preferred string) (string, bool) {
 	if preferred != "" {
 		// 直接匹配
-		if ip, ok := interfaces[preferred]; ok && isPublicUnicast(ip) {
-			return ip, true
+		for _, a := range addrs {
+			if a.key == preferred && !a.deprecated && !a.tentative && isPublicUnicast(a.String()) {
+				return a.String(), true
+			}
 		}
 
-		// 尝试去掉末尾数字为下一步遍历做准备
+		// 去掉末尾序号后在同名网卡中选择
 		if idx := strings.LastIndexByte(preferred, ' '); idx != -1 {
 			if _, err := strconv.Atoi(preferred[idx+1:]); err == nil {
 				preferred = preferred[:idx]
 			}
 		}
-
-		// 尝试遍历匹配 "eth0 0", "eth0 1", ...
-		for i := 0; ; i++ {
-			ip, ok := interfaces[preferred+" "+strconv.Itoa(i)]
-			if !ok {
-				break
-			}
-			if isPublicUnicast(ip) {
-				return ip, true
-			}
-		}
-	}
-
-	// 随便找一个
-	for _, ip := range interfaces {
-		if isPublicUnicast(ip) {
+		if ip, err := selectAddr(addrs, addrRule{Interface: regexp.QuoteMeta(preferred)}, true); err == nil {
 			return ip, true
 		}
 	}
 
+	// 在所有网卡中选择
+	if ip, err := selectAddr(addrs, addrRule{Interface: ".*"}, true); err == nil {
+		return ip, true
+	}
 	return "", false
 }
 
-func GetOwnIP(enabled common.Enable, apiUrl apiUrl, nc networkCard, fallback bool) (ipv4, ipv6 string, err error) {
-	var interfaces map[string]string
+func GetOwnIP(enabled common.Enable, apiUrl apiUrl, sources ipSources, nc networkCard, gd gatewayDetect, dd dnsDetect, sd stunDetect, fallback bool) (ipv4, ipv6 string, err error) {
+	var addrs []ifaceAddr
+	// 记录本次使用的获取方式，出错提前返回时未尝试的类型不计
+	var source4, source6 string
+	defer func() {
+		observeDetect(source4, "ipv4", ipv4)
+		observeDetect(source6, "ipv6", ipv6)
+	}()
 	// 若需网卡信息，则获取网卡信息并提供给用户
-	if nc.Enable && nc.IPv4 == "" && nc.IPv6 == "" {
+	if nc.Enable && nc.IPv4 == "" && nc.IPv6 == "" && nc.IPv4Rule.Interface == "" && nc.IPv6Rule.Interface == "" {
+		var interfaces map[string]string
 		interfaces, err = NetworkInterfaces()
 		if err != nil {
 			return
@@ -181,8 +171,8 @@ func GetOwnIP(enabled common.Enable, apiUrl apiUrl, nc networkCard, fallback boo
 	}
 
 	// 若需网卡信息，则获取网卡信息
-	if nc.Enable && (nc.IPv4 != "" || nc.IPv6 != "") {
-		interfaces, err = NetworkInterfaces()
+	if nc.Enable {
+		addrs, err = interfaceAddrs()
 		if err != nil {
 			return
 		}
@@ -191,21 +181,54 @@ func GetOwnIP(enabled common.Enable, apiUrl apiUrl, nc networkCard, fallback boo
 	// 启用 IPv4
 	if enabled.IPv4 {
 		// 启用网卡 IPv4
-		if nc.Enable && nc.IPv4 != "" {
-			if v, ok := interfaces[nc.IPv4]; ok {
+		if nc.Enable && (nc.IPv4Rule.Interface != "" || nc.IPv4 != "") {
+			source4 = sourceNetworkCard
+		}
+		if nc.Enable && nc.IPv4Rule.Interface != "" {
+			// 按规则选择网卡 IPv4
+			if ipv4, err = selectAddr(addrs, nc.IPv4Rule, false); err != nil {
+				return
+			}
+		} else if nc.Enable && nc.IPv4 != "" {
+			if v, ok := lookupAddr(addrs, nc.IPv4); ok {
 				ipv4 = v
 			} else {
 				err = errors.New("IPv4 选择了不存在的网卡")
 				return
 			}
+		} else if gd.Enable {
+			// 向路由器询问 WAN 口 IPv4
+			source4 = sourceGateway
+			if ipv4, err = getIPByGateway(gd); err != nil {
+				return
+			}
+		} else if dd.Enable && dd.IPv4 != "" {
+			// 使用 DNS 获取 IPv4
+			source4 = sourceDNS
+			if ipv4, err = getIPByDNS(dd.IPv4, false); err != nil {
+				return
+			}
+		} else if sd.Enable.IPv4 {
+			// 使用 STUN 获取 IPv4
+			source4 = sourceSTUN
+			if ipv4, err = getIPBySTUN(sd.Servers, false); err != nil {
+				return
+			}
+		} else if len(sources.IPv4) != 0 {
+			// 使用多个 IP 来源获取 IPv4
+			source4 = sourceIPSources
+			if ipv4, err = queryIPSources(sources, sources.IPv4, false); err != nil {
+				return
+			}
 		} else {
 			// 使用 API 获取 IPv4
+			source4 = sourceAPI
 			if apiUrl.IPv4 == "" {
 				apiUrl.IPv4 = common.DefaultAPIUrl
 			}
 
 			var resp *http.Response
-			resp, err = httpGet(apiUrl.IPv4)
+			resp, err = ipHttpGet(apiUrl.IPv4, false)
 			if err != nil {
 				return
 			}
@@ -233,15 +256,23 @@ func GetOwnIP(enabled common.Enable, apiUrl apiUrl, nc networkCard, fallback boo
 	// 启用 IPv6
 	if enabled.IPv6 {
 		// 启用网卡 IPv6
-		if nc.Enable && nc.IPv6 != "" {
+		if nc.Enable && (nc.IPv6Rule.Interface != "" || nc.IPv6 != "") {
+			source6 = sourceNetworkCard
+		}
+		if nc.Enable && nc.IPv6Rule.Interface != "" {
+			// 按规则选择网卡 IPv6
+			if ipv6, err = selectAddr(addrs, nc.IPv6Rule, true); err != nil {
+				return
+			}
+		} else if nc.Enable && nc.IPv6 != "" {
 			var (
 				v  string
 				ok bool
 			)
 			if fallback {
-				v, ok = fallbackIPv6(interfaces, nc.IPv6)
+				v, ok = fallbackIPv6(addrs, nc.IPv6)
 			} else {
-				v, ok = interfaces[nc.IPv6]
+				v, ok = lookupAddr(addrs, nc.IPv6)
 			}
 			if ok {
 				ipv6 = v
@@ -249,14 +280,33 @@ func GetOwnIP(enabled common.Enable, apiUrl apiUrl, nc networkCard, fallback boo
 				err = errors.New("IPv6 选择了不存在的网卡")
 				return
 			}
+		} else if dd.Enable && dd.IPv6 != "" {
+			// 使用 DNS 获取 IPv6
+			source6 = sourceDNS
+			if ipv6, err = getIPByDNS(dd.IPv6, true); err != nil {
+				return
+			}
+		} else if sd.Enable.IPv6 {
+			// 使用 STUN 获取 IPv6
+			source6 = sourceSTUN
+			if ipv6, err = getIPBySTUN(sd.Servers, true); err != nil {
+				return
+			}
+		} else if len(sources.IPv6) != 0 {
+			// 使用多个 IP 来源获取 IPv6
+			source6 = sourceIPSources
+			if ipv6, err = queryIPSources(sources, sources.IPv6, true); err != nil {
+				return
+			}
 		} else {
 			// 使用 API 获取 IPv6
+			source6 = sourceAPI
 			if apiUrl.IPv6 == "" {
 				apiUrl.IPv6 = common.DefaultIPv6APIUrl
 			}
 
 			var resp *http.Response
-			resp, err = httpGet(apiUrl.IPv6)
+			resp, err = ipHttpGet(apiUrl.IPv6, true)
 			if err != nil {
 				return
 			}
@@ -285,6 +335,65 @@ func GetOwnIP(enabled common.Enable, apiUrl apiUrl, nc networkCard, fallback boo
 	return
 }
 
+// GetRecordSet 获取 record_set 要发布的整组地址
+// 未列出网卡时只包含已获取到的 ipv4 和 ipv6
+func GetRecordSet(enabled common.Enable, rs recordSet, ipv4, ipv6 string) (ipv4s, ipv6s []string, err error) {
+	var addrs []ifaceAddr
+	if len(rs.IPv4) != 0 || len(rs.IPv6) != 0 {
+		addrs, err = interfaceAddrs()
+		if err != nil {
+			return
+		}
+	}
+
+	if enabled.IPv4 {
+		if len(rs.IPv4) == 0 {
+			ipv4s = uniqueValues([]string{ipv4})
+		} else if ipv4s, err = recordSetAddrs(addrs, rs.IPv4, false); err != nil {
+			return
+		}
+	}
+	if enabled.IPv6 {
+		if len(rs.IPv6) == 0 {
+			ipv6s = uniqueValues([]string{ipv6})
+		} else if ipv6s, err = recordSetAddrs(addrs, rs.IPv6, true); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// recordSetAddrs names 可以是 "eth0 0" 这样的单个地址，也可以是 "eth0" 表示该网卡的全部地址
+func recordSetAddrs(addrs []ifaceAddr, names []string, ipv6 bool) (res []string, err error) {
+	for _, name := range names {
+		if ip, ok := lookupAddr(addrs, name); ok {
+			if strings.Contains(ip, ":") != ipv6 {
+				return nil, errors.New("record_set 选择的 " + name + " 不是对应类型的地址")
+			}
+			res = append(res, ip)
+			continue
+		}
+
+		found := false
+		for _, a := range addrs {
+			if a.iface != name {
+				continue
+			}
+			found = true
+			addr := a.prefix.Addr()
+			// 整张网卡时 IPv6 只取可用的公网地址，IPv4 跳过回环地址
+			if ipv6 && isPublicUnicast(a.String()) && !a.deprecated && !a.tentative ||
+				!ipv6 && addr.Is4() && !addr.IsLoopback() {
+				res = append(res, a.String())
+			}
+		}
+		if !found {
+			return nil, errors.New("record_set 选择了不存在的网卡 " + name)
+		}
+	}
+	return uniqueValues(res), nil
+}
+
 func AccessCenter(ipv4, ipv6 string) {
 	// 构造请求 body
 	reqBody := common.CenterReq{
@@ -296,16 +405,29 @@ func AccessCenter(ipv4, ipv6 string) {
 		},
 	}
 
+	// 请求中的 token 不输出，用中心服务地址区分
+	logger := slog.With("provider", PlanCenter, "center", common.RedactURL(Client.Center.APIUrl))
 	reqJson, err := json.Marshal(reqBody)
 	if err != nil {
-		log.Println(err)
+		logger.Error("访问中心服务失败", "error", err)
 		return
 	}
 
+	// 中心服务返回了消息即视为有更新，状态码不是 200 时视为失败
+	var (
+		changed   bool
+		statusErr error
+	)
+	defer func() {
+		ev := updateEvent{provider: PlanCenter, record: common.RedactURL(Client.Center.APIUrl),
+			newIP: strings.Trim(ipv4+","+ipv6, ",")}
+		ev.observe(changed, cmp.Or(common.RedactError(err), statusErr))
+	}()
+
 	// 发送请求
 	req, err := httpNewRequest(http.MethodPost, Client.Center.APIUrl, bytes.NewReader(reqJson))
 	if err != nil {
-		log.Println(err)
+		logger.Error("访问中心服务失败", "error", common.RedactError(err))
 		return
 	}
 
@@ -313,19 +435,20 @@ func AccessCenter(ipv4, ipv6 string) {
 
 	resp, err := common.DefaultHttpClient.Do(req)
 	if err != nil {
-		log.Println(err)
+		logger.Error("访问中心服务失败", "error", common.RedactError(err))
 		return
 	}
 	defer resp.Body.Close()
 
 	// 处理结果
 	if resp.StatusCode != http.StatusOK {
-		log.Println("The status code returned by the center is", resp.StatusCode)
+		logger.Error("中心服务返回错误状态码", "status", resp.StatusCode)
+		statusErr = errors.New("中心服务返回状态码 " + strconv.Itoa(resp.StatusCode))
 	}
 
 	respBodyJson, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Println(err)
+		logger.Error("读取中心服务响应失败", "error", err)
 		return
 	}
 	if len(respBodyJson) == 0 {
@@ -334,12 +457,13 @@ func AccessCenter(ipv4, ipv6 string) {
 
 	var respBody common.GeneralResp
 	if err = json.Unmarshal(respBodyJson, &respBody); err != nil {
-		log.Println(err)
+		logger.Error("中心服务响应格式错误", "error", err)
 		return
 	}
 	for _, v := range strings.Split(respBody.Message, "\n") {
 		if v != "" {
-			log.Println(v)
+			changed = true
+			logger.Info(v, "ipv4", ipv4, "ipv6", ipv6)
 		}
 	}
 }
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"slices"
+	"strings"
+)
+
+// setRecord 同名解析记录中的一条
+type setRecord struct {
+	id    string
+	value string
+	// line DNSPod 更新记录时需要带上原线路
+	line string
+}
+
+// recordSetOps 整组同步时服务商需要提供的操作
+// provider 和 recordType 只用于记录同步结果
+type recordSetOps struct {
+	provider   string
+	recordType string
+	list       func() ([]setRecord, error)
+	create     func(value string) error
+	update     func(rec setRecord, value string) error
+	remove     func(rec setRecord) error
+}
+
+// syncRecordSet 使同名同类型的解析记录恰好为 values
+// 多余的记录优先改成缺少的值，仍然多余的删除，仍然缺少的新建
+func syncRecordSet(prefix, name string, values []string, ops recordSetOps) (msg []string, errs []error) {
+	values = uniqueValues(values)
+	// 没有获取到任何地址时不动解析记录，以免误删
+	if len(values) == 0 {
+		return
+	}
+	// 每次新建、更新和删除分别记录
+	event := func(oldIP, newIP string) updateEvent {
+		return updateEvent{provider: ops.provider, record: name, recordType: ops.recordType, oldIP: oldIP, newIP: newIP}
+	}
+
+	records, err := ops.list()
+	if err != nil {
+		errs = append(errs, event("", strings.Join(values, ",")).done(false, err))
+		return
+	}
+
+	missing := slices.Clone(values)
+	var extras []setRecord
+	for _, rec := range records {
+		if i := slices.Index(missing, rec.value); i != -1 {
+			missing = slices.Delete(missing, i, i+1)
+		} else {
+			extras = append(extras, rec)
+		}
+	}
+
+	for _, value := range missing {
+		if len(extras) > 0 {
+			rec := extras[0]
+			extras = extras[1:]
+			if err = event(rec.value, value).done(true, ops.update(rec, value)); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			msg = append(msg, prefix+name+" 已更新解析记录 "+rec.value+" -> "+value)
+			continue
+		}
+		if err = event("", value).done(true, ops.create(value)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		msg = append(msg, prefix+name+" 已新建解析记录 "+value)
+	}
+
+	for _, rec := range extras {
+		if err = event(rec.value, "").done(true, ops.remove(rec)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		msg = append(msg, prefix+name+" 已删除解析记录 "+rec.value)
+	}
+
+	if len(msg) == 0 && len(errs) == 0 {
+		_ = event(strings.Join(values, ","), strings.Join(values, ",")).done(false, nil)
+	}
+	return
+}
+
+// runRecordSet 按启用的 IP 类型分别同步 A 和 AAAA 记录集
+func runRecordSet(enabled common.Enable, sub common.Subdomain, ipv4s, ipv6s []string,
+	sync func(recordType, name string, values []string) ([]string, []error)) (msg []string, errs []error) {
+	if enabled.IPv4 && sub.A != "" {
+		m, e := sync("A", sub.A, ipv4s)
+		msg, errs = append(msg, m...), append(errs, e...)
+	}
+	if enabled.IPv6 && sub.AAAA != "" {
+		m, e := sync("AAAA", sub.AAAA, ipv6s)
+		msg, errs = append(msg, m...), append(errs, e...)
+	}
+	return
+}
+
+// uniqueValues 去掉空值和重复值，保持原有顺序
+func uniqueValues(values []string) (res []string) {
+	for _, v := range values {
+		if v != "" && !slices.Contains(res, v) {
+			res = append(res, v)
+		}
+	}
+	return
+}
+
+// sameValues 不计顺序比较两组解析记录值
+func sameValues(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// ConfFiles 客户端会读取的全部配置文件
+func ConfFiles() []string {
+	files := []string{
+		ConfFilename,
+		DNSPodConfFilename,
+		AliDNSConfFilename,
+		CloudflareConfFilename,
+		HuaweiCloudConfFilename,
+		VolcengineConfFilename,
+		BaiduCloudConfFilename,
+		JDCloudConfFilename,
+	}
+	for i, f := range files {
+		files[i] = ConfDir + "/" + f
+	}
+	return files
+}
+
+// Reload 重新读取全部配置，全部通过校验后才替换正在使用的配置
+// 替换后上次的 IP 记录被清空，下一次检查会按新配置同步解析记录
+// 本地 API、网页、指标和监听在启动时已经生效，修改后需要重启
+func Reload() (err error) {
+	var c client
+	if err = c.LoadConf(); err != nil {
+		return
+	}
+	if Client.Periodic() && !c.Periodic() {
+		return errors.New("运行中不能关闭 check_cycle_minutes 和 schedule 的 check，请直接停止程序")
+	}
+
+	var (
+		dp DNSPod
+		ad AliDNS
+		cf Cloudflare
+		hc HuaweiCloud
+		vc Volcengine
+		bc BaiduCloud
+		jc JDCloud
+	)
+	if !c.Center.Enable {
+		for _, p := range []struct {
+			enable bool
+			load   func() error
+		}{
+			{c.Services.DNSPod, dp.LoadConf},
+			{c.Services.AliDNS, ad.LoadConf},
+			{c.Services.Cloudflare, cf.LoadConf},
+			{c.Services.HuaweiCloud, hc.LoadConf},
+			{c.Services.Volcengine, vc.LoadConf},
+			{c.Services.BaiduCloud, bc.LoadConf},
+			{c.Services.JDCloud, jc.LoadConf},
+		} {
+			if !p.enable {
+				continue
+			}
+			if err = p.load(); err != nil {
+				return
+			}
+		}
+	}
+
+	h, err := openHistory(c)
+	if err != nil {
+		return
+	}
+
+	running := Client
+	if c.API != running.API || c.Web != running.Web || c.MetricsAddr != running.MetricsAddr ||
+		c.WatchNetwork != running.WatchNetwork || c.WatchConf != running.WatchConf {
+		slog.Warn("api, web, metrics_addr, watch_network, watch_conf 的修改需要重启才能生效")
+	}
+	// 保留启动时的设置，使其与实际监听的一致
+	c.API, c.Web, c.MetricsAddr, c.WatchNetwork, c.WatchConf =
+		running.API, running.Web, running.MetricsAddr, running.WatchNetwork, running.WatchConf
+
+	Client, DP, AD, Cf, HC, VC, BC, JC = c, dp, ad, cf, hc, vc, bc, jc
+	History, historyConf = h, c.History
+	SetupNotifier()
+	PublishConf()
+	return
+}
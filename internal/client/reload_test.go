@@ -0,0 +1,59 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	dir, oldDir, oldClient, oldDP := t.TempDir(), ConfDir, Client, DP
+	ConfDir = dir
+	t.Cleanup(func() { ConfDir, Client, DP = oldDir, oldClient, oldDP })
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ConfFilename, `{"enable":{"ipv4":true},"services":{"dnspod":true},"check_cycle_minutes":5}`)
+	write(DNSPodConfFilename, `{"id":"1","token":"t","domain":"example.com","sub_domain":{"a":"www"}}`)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	Client.LatestIPv4 = "192.0.2.1"
+
+	// 服务商配置不完整时保留原配置
+	write(ConfFilename, `{"enable":{"ipv4":true},"services":{"dnspod":true},"check_cycle_minutes":1}`)
+	write(DNSPodConfFilename, `{"id":"1","token":"t","domain":"example.com"}`)
+	if err := Reload(); err == nil {
+		t.Fatal("sub_domain 为空时应报错")
+	}
+	if Client.CheckCycleMinutes != 5 || DP.SubDomain.A != "www" || Client.LatestIPv4 != "192.0.2.1" {
+		t.Errorf("校验失败后配置被替换了")
+	}
+
+	// 运行中不能关闭周期检查
+	write(ConfFilename, `{"enable":{"ipv4":true},"services":{"dnspod":true},"check_cycle_minutes":0}`)
+	write(DNSPodConfFilename, `{"id":"1","token":"t","domain":"example.com","sub_domain":{"a":"home"}}`)
+	if err := Reload(); err == nil {
+		t.Fatal("check_cycle_minutes 为 0 时应报错")
+	}
+
+	write(ConfFilename, `{"enable":{"ipv4":true},"services":{"dnspod":true},"check_cycle_minutes":1,`+
+		`"api":{"addr":"127.0.0.1:9876"}}`)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if Client.CheckCycleMinutes != 1 || DP.SubDomain.A != "home" {
+		t.Errorf("新配置没有生效")
+	}
+	// 本地 API 的监听需要重启才能修改
+	if Client.API.Addr != "" {
+		t.Errorf("API.Addr = %q, want empty", Client.API.Addr)
+	}
+	// 重新加载后要按新配置同步一次
+	if Client.LatestIPv4 != "" {
+		t.Errorf("LatestIPv4 = %q, want empty", Client.LatestIPv4)
+	}
+}
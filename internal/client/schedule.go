@@ -0,0 +1,337 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// PlanCenter center 模式下代替服务名
+	PlanCenter = "center"
+
+	planCheck     = "@check"
+	planReconcile = "@reconcile"
+
+	// cronSearchYears 超过这个范围仍找不到触发时间的表达式视为永远不会触发
+	cronSearchYears = 5
+)
+
+// cronPredefined 预定义的表达式
+var cronPredefined = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	cronWeekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// scheduler 返回 t 之后的下一次触发时间
+type scheduler interface {
+	next(t time.Time) time.Time
+}
+
+// everySchedule 从上一次触发起按固定间隔触发
+type everySchedule time.Duration
+
+func (s everySchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule 按本地时间匹配的五段式表达式，每一位表示该值是否匹配
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny, dowAny 日和星期中有一个为 * 时两者都要匹配，否则匹配其一即可
+	domAny, dowAny bool
+}
+
+func (s cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatch(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s cronSchedule) dayMatch(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// parseSchedule 支持 "30s" 这样的时长、"@every 5m"、"@daily" 等预定义表达式和 "*/5 * * * *" 这样的五段式表达式
+func parseSchedule(spec string) (s scheduler, err error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		return parseEvery(strings.TrimSpace(d))
+	}
+	if expr, ok := cronPredefined[spec]; ok {
+		spec = expr
+	}
+	if strings.HasPrefix(spec, "@") {
+		return nil, errors.New(spec + " 不是支持的预定义表达式")
+	}
+	if len(strings.Fields(spec)) == 1 {
+		return parseEvery(spec)
+	}
+	return parseCron(spec)
+}
+
+func parseEvery(d string) (s scheduler, err error) {
+	interval, err := time.ParseDuration(d)
+	if err != nil {
+		return nil, errors.New(d + " 不是有效的时长")
+	}
+	if interval < time.Second {
+		return nil, errors.New(d + " 间隔不能小于 1 秒")
+	}
+	return everySchedule(interval), nil
+}
+
+func parseCron(spec string) (s scheduler, err error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New(spec + " 应为 分 时 日 月 星期 五段")
+	}
+	var c cronSchedule
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, cronWeekdayNames); err != nil {
+		return
+	}
+	// 星期日可以写作 0 或 7
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	c.domAny = strings.HasPrefix(fields[2], "*")
+	c.dowAny = strings.HasPrefix(fields[4], "*")
+
+	if c.next(time.Now()).IsZero() {
+		return nil, errors.New(spec + " 永远不会触发")
+	}
+	return c, nil
+}
+
+// parseCronField 解析一段表达式，支持 *、a-b、列表和 /n 步长
+func parseCronField(field string, lo, hi int, names map[string]int) (bits uint64, err error) {
+	for part := range strings.SplitSeq(field, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			if from, err = parseCronValue(a, lo, hi, names); err != nil {
+				return
+			}
+			to = from
+			if isRange {
+				if to, err = parseCronValue(b, lo, hi, names); err != nil {
+					return
+				}
+			} else if hasStep {
+				to = hi
+			}
+		}
+		n := 1
+		if hasStep {
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, errors.New(part + " 的步长无效")
+			}
+		}
+		if from > to {
+			return 0, errors.New(part + " 的范围无效")
+		}
+		for v := from; v <= to; v += n {
+			bits |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+func parseCronValue(s string, lo, hi int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < lo || v > hi {
+		return 0, errors.New(s + " 不在 " + strconv.Itoa(lo) + " 到 " + strconv.Itoa(hi) + " 之间")
+	}
+	return v, nil
+}
+
+// check 校验 schedule 的配置，错误信息由调用方补充配置文件位置
+func (conf schedule) check(services service, center bool) error {
+	for name, spec := range map[string]string{"check": conf.Check, "reconcile": conf.Reconcile} {
+		if spec == "" {
+			continue
+		}
+		if _, err := parseSchedule(spec); err != nil {
+			return errors.New(name + " " + err.Error())
+		}
+	}
+	if len(conf.Services) != 0 && center {
+		return errors.New("services 不支持 center 模式")
+	}
+	enabled := services.names()
+	for name, spec := range conf.Services {
+		if !enabled[name] {
+			return errors.New("services 中 " + name + " 不是已启用的服务，可选 dnspod, alidns, cloudflare, huaweicloud, volcengine, baiducloud, jdcloud")
+		}
+		if _, err := parseSchedule(spec); err != nil {
+			return errors.New("services 中 " + name + " " + err.Error())
+		}
+	}
+	return nil
+}
+
+// names 已启用服务的名称，与服务端 -s 参数可指定的名称相同
+func (s service) names() map[string]bool {
+	names := make(map[string]bool)
+	for name, enabled := range map[string]bool{
+		common.DNSPod:      s.DNSPod,
+		common.AliDNS:      s.AliDNS,
+		common.Cloudflare:  s.Cloudflare,
+		common.HuaweiCloud: s.HuaweiCloud,
+		common.Volcengine:  s.Volcengine,
+		common.BaiduCloud:  s.BaiduCloud,
+		common.JDCloud:     s.JDCloud,
+	} {
+		if enabled {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// Periodic 是否周期检查
+func (conf *client) Periodic() bool {
+	return conf.CheckCycleMinutes > 0 || conf.Schedule.Check != ""
+}
+
+// Plan 记录各项计划的下一次触发时间
+// 检查计划到期时同步未单独指定计划的服务，服务自己的计划到期时只同步该服务，reconcile 到期时强制同步全部服务
+type Plan struct {
+	schedules map[string]scheduler
+	next      map[string]time.Time
+	services  []string
+}
+
+// NewPlan 按 conf 生成计划，conf 应已通过 LoadConf 的校验
+func NewPlan(conf client, now time.Time) (p *Plan, err error) {
+	p = &Plan{schedules: make(map[string]scheduler), next: make(map[string]time.Time)}
+	if conf.Center.Enable {
+		p.services = []string{PlanCenter}
+	} else {
+		for name := range conf.Services.names() {
+			p.services = append(p.services, name)
+		}
+	}
+
+	specs := map[string]string{planCheck: conf.Schedule.Check, planReconcile: conf.Schedule.Reconcile}
+	if specs[planCheck] == "" && conf.CheckCycleMinutes > 0 {
+		specs[planCheck] = strconv.Itoa(conf.CheckCycleMinutes) + "m"
+	}
+	for name, spec := range conf.Schedule.Services {
+		specs[name] = spec
+	}
+	for name, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		if p.schedules[name], err = parseSchedule(spec); err != nil {
+			return nil, err
+		}
+		p.next[name] = p.schedules[name].next(now)
+	}
+	return
+}
+
+// Next 最近一次触发的时间
+func (p *Plan) Next() (t time.Time) {
+	for _, n := range p.next {
+		if t.IsZero() || n.Before(t) {
+			t = n
+		}
+	}
+	return
+}
+
+// Fire 返回 now 时到期需要同步的服务，reconcile 到期时 force 为 true
+func (p *Plan) Fire(now time.Time) (due map[string]bool, force bool) {
+	due = make(map[string]bool)
+	for name, n := range p.next {
+		if n.After(now) {
+			continue
+		}
+		p.next[name] = p.schedules[name].next(now)
+		switch name {
+		case planCheck:
+			for s := range p.Default() {
+				due[s] = true
+			}
+		case planReconcile:
+			force = true
+			for s := range p.All() {
+				due[s] = true
+			}
+		default:
+			due[name] = true
+		}
+	}
+	return
+}
+
+// Default 未单独指定计划的服务，网络变化等即时检查时只同步这些服务
+func (p *Plan) Default() map[string]bool {
+	due := make(map[string]bool)
+	for _, s := range p.services {
+		if _, ok := p.schedules[s]; !ok {
+			due[s] = true
+		}
+	}
+	return due
+}
+
+// All 全部服务，启动和重新加载配置后同步一次
+func (p *Plan) All() map[string]bool {
+	due := make(map[string]bool)
+	for _, s := range p.services {
+		due[s] = true
+	}
+	return due
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC) // 星期三
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"30s", base.Add(30 * time.Second)},
+		{"@every 1h30m", base.Add(90 * time.Minute)},
+		{"*/5 * * * *", time.Date(2024, 1, 31, 10, 10, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 4 * * *", time.Date(2024, 2, 1, 4, 0, 0, 0, time.UTC)},
+		{"0 0 30 * *", time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * SUN,sat", time.Date(2024, 2, 3, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)},
+		// 日和星期都指定时匹配其一即可
+		{"0 0 15 * 4", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"15/20 10-11 * * *", time.Date(2024, 1, 31, 10, 15, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := parseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("%q: %v", tt.spec, err)
+			continue
+		}
+		if got := s.next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: next = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", "0", "500ms", "@every", "@often", "* * * *", "60 * * * *",
+		"*/0 * * * *", "5-1 * * * *", "0 0 30 2 *"} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	conf := client{
+		Services:          service{DNSPod: true, Cloudflare: true},
+		CheckCycleMinutes: 1,
+		Schedule: schedule{
+			Reconcile: "@every 1h",
+			Services:  map[string]string{common.Cloudflare: "10m"},
+		},
+	}
+	p, err := NewPlan(conf, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Next(); !got.Equal(now.Add(time.Minute)) {
+		t.Fatalf("next = %v", got)
+	}
+	if due := p.Default(); !due[common.DNSPod] || due[common.Cloudflare] {
+		t.Errorf("default = %v", due)
+	}
+
+	due, force := p.Fire(now.Add(time.Minute))
+	if force || !due[common.DNSPod] || due[common.Cloudflare] {
+		t.Errorf("check: due = %v, force = %v", due, force)
+	}
+	due, force = p.Fire(now.Add(10 * time.Minute))
+	if force || !due[common.DNSPod] || !due[common.Cloudflare] {
+		t.Errorf("service: due = %v, force = %v", due, force)
+	}
+	due, force = p.Fire(now.Add(time.Hour))
+	if !force || !due[common.DNSPod] || !due[common.Cloudflare] {
+		t.Errorf("reconcile: due = %v, force = %v", due, force)
+	}
+	// 到期后从触发时间重新计算
+	if got := p.Next(); !got.Equal(now.Add(time.Hour + time.Minute)) {
+		t.Errorf("next = %v", got)
+	}
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// requestCtx 所有经 httpNewRequest 发出的请求共用，取消后进行中的请求立即失败
+// AliDNS 和 HuaweiCloud 通过 SDK 请求，不受影响，只能等待 SDK 自身超时
+var requestCtx, cancelRequests = context.WithCancel(context.Background())
+
+// CancelRequests 退出时取消所有未完成的请求，之后发出的请求也会立即失败
+func CancelRequests() {
+	cancelRequests()
+}
+
+// wait 等待 d，期间请求被取消时提前返回 false
+func wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-requestCtx.Done():
+		return false
+	}
+}
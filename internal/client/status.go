@@ -0,0 +1,197 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted 代替配置中的密钥
+const redacted = "******"
+
+// redactedQuery common.RedactURL 代替地址中查询参数的内容
+const redactedQuery = "..."
+
+// status 本地 API 输出的运行状态，由检查流程更新
+var status = struct {
+	sync.Mutex
+	paused  bool
+	nextRun time.Time
+	detect  common.HistoryEntry
+	// sources 按 ipv4 / ipv6 保存最近一次获取 IP 使用的方式
+	sources map[string]sourceStatus
+	// records 按 provider|record|type 保存最近一次同步结果
+	records map[string]common.HistoryEntry
+	conf    map[string]any
+	// historyPath 未启用历史记录时为空
+	historyPath string
+}{sources: make(map[string]sourceStatus), records: make(map[string]common.HistoryEntry)}
+
+// sourceStatus 一种 IP 类型最近一次获取 IP 的方式和结果，获取失败时 ip 为空
+type sourceStatus struct {
+	Type   string    `json:"type"`
+	Source string    `json:"source"`
+	IP     string    `json:"ip"`
+	Time   time.Time `json:"time"`
+}
+
+// Paused 是否通过本地 API 暂停了更新
+func Paused() bool {
+	status.Lock()
+	defer status.Unlock()
+	return status.paused
+}
+
+func setPaused(paused bool) {
+	status.Lock()
+	defer status.Unlock()
+	status.paused = paused
+}
+
+// SetNextRun 记录下一次按计划检查的时间
+func SetNextRun(t time.Time) {
+	status.Lock()
+	defer status.Unlock()
+	status.nextRun = t
+}
+
+func setDetectStatus(entry common.HistoryEntry) {
+	status.Lock()
+	defer status.Unlock()
+	status.detect = entry
+}
+
+func setSourceStatus(source, ipType, ip string) {
+	status.Lock()
+	defer status.Unlock()
+	status.sources[ipType] = sourceStatus{Type: ipType, Source: source, IP: ip, Time: time.Now()}
+}
+
+func setRecordStatus(entry common.HistoryEntry) {
+	status.Lock()
+	defer status.Unlock()
+	status.records[entry.Provider+"|"+entry.Record+"|"+entry.Type] = entry
+}
+
+// PublishConf 保存去掉密钥的当前配置，启动和重新加载配置后调用
+// 配置由主流程替换，本地 API 只读取这份副本
+func PublishConf() {
+	conf := map[string]any{"client": Client}
+	if !Client.Center.Enable {
+		for name, p := range map[string]any{
+			common.DNSPod:      DP,
+			common.AliDNS:      AD,
+			common.Cloudflare:  Cf,
+			common.HuaweiCloud: HC,
+			common.Volcengine:  VC,
+			common.BaiduCloud:  BC,
+			common.JDCloud:     JC,
+		} {
+			if Client.Services.names()[name] {
+				conf[name] = p
+			}
+		}
+	}
+	for k, v := range conf {
+		conf[k] = redact(v)
+	}
+
+	var historyPath string
+	if Client.History.Enable {
+		historyPath = Client.History.Path(ConfDir, HistoryFilename)
+	}
+
+	status.Lock()
+	defer status.Unlock()
+	status.conf = conf
+	status.historyPath = historyPath
+	// 重新加载后服务和获取 IP 的方式可能已经变化，旧的结果不再有意义
+	clear(status.sources)
+	clear(status.records)
+}
+
+// redact 转为 JSON 的通用结构，名称中带有 token, secret, password, key, authorization 的字段替换为 ******
+// 带有查询参数的地址也可能包含密钥，去掉查询参数
+func redact(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out any
+	if json.Unmarshal(b, &out) != nil {
+		return nil
+	}
+	return redactValue("", out)
+}
+
+func redactValue(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = redactValue(k, child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = redactValue(key, child)
+		}
+	case string:
+		for _, word := range []string{"token", "secret", "password", "key", "authorization"} {
+			if v != "" && strings.Contains(strings.ToLower(key), word) {
+				return redacted
+			}
+		}
+		if u, err := url.Parse(v); err == nil && u.Host != "" && (u.RawQuery != "" || u.User != nil) {
+			return common.RedactURL(v)
+		}
+	}
+	return v
+}
+
+// apiStatus GET /api/status 的响应
+type apiStatus struct {
+	Version string                `json:"version"`
+	Paused  bool                  `json:"paused"`
+	NextRun *time.Time            `json:"next_run"`
+	Detect  *common.HistoryEntry  `json:"detect"`
+	Sources []sourceStatus        `json:"sources"`
+	Records []common.HistoryEntry `json:"records"`
+}
+
+func currentStatus() (s apiStatus) {
+	status.Lock()
+	defer status.Unlock()
+	s = apiStatus{Version: common.Version, Paused: status.paused, Sources: []sourceStatus{},
+		Records: []common.HistoryEntry{}}
+	if !status.nextRun.IsZero() {
+		t := status.nextRun
+		s.NextRun = &t
+	}
+	if !status.detect.Time.IsZero() {
+		d := status.detect
+		s.Detect = &d
+	}
+	for _, k := range slices.Sorted(maps.Keys(status.sources)) {
+		s.Sources = append(s.Sources, status.sources[k])
+	}
+	for _, k := range slices.Sorted(maps.Keys(status.records)) {
+		s.Records = append(s.Records, status.records[k])
+	}
+	return
+}
+
+func currentConf() map[string]any {
+	status.Lock()
+	defer status.Unlock()
+	return status.conf
+}
+
+func currentHistoryPath() string {
+	status.Lock()
+	defer status.Unlock()
+	return status.historyPath
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"ddns-watchdog/internal/common"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+const (
+	stunAttemptTimeout = time.Second
+	stunAttempts       = 3
+)
+
+// stunDefaultServers stun 未列出服务器时使用
+var stunDefaultServers = []string{
+	"stun.cloudflare.com:3478",
+	"stun.l.google.com:19302",
+}
+
+// getIPBySTUN 依次向 servers 发送 Binding 请求，返回第一个成功的映射地址
+func getIPBySTUN(servers []string, ipv6 bool) (ip string, err error) {
+	if len(servers) == 0 {
+		servers = stunDefaultServers
+	}
+
+	network := "udp4"
+	if ipv6 {
+		network = "udp6"
+	}
+
+	for _, server := range servers {
+		var addr netip.Addr
+		if addr, err = stunBinding(network, server); err != nil {
+			err = errors.New("stun " + server + ": " + err.Error())
+			continue
+		}
+		if ip, err = normalizeIP(addr.String(), ipv6); err == nil {
+			return
+		}
+		err = errors.New("stun " + server + ": " + err.Error())
+	}
+	return "", err
+}
+
+// stunBinding 按 RFC 5389 发送 Binding 请求，未收到响应时重传
+func stunBinding(network, server string) (addr netip.Addr, err error) {
+	conn, err := net.Dial(network, server)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var txId [12]byte
+	_, _ = rand.Read(txId[:])
+	req := make([]byte, common.STUNHeaderLen)
+	binary.BigEndian.PutUint16(req[0:], common.STUNBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], common.STUNMagicCookie)
+	copy(req[8:], txId[:])
+
+	buf := make([]byte, 1500)
+	for range stunAttempts {
+		if _, err = conn.Write(req); err != nil {
+			return
+		}
+		if err = conn.SetReadDeadline(time.Now().Add(stunAttemptTimeout)); err != nil {
+			return
+		}
+
+		for {
+			var n int
+			n, err = conn.Read(buf)
+			if err != nil {
+				break
+			}
+			// 忽略不是这次请求的响应
+			if n < common.STUNHeaderLen || !bytes.Equal(buf[8:20], txId[:]) {
+				continue
+			}
+			return stunParseResponse(buf[:n])
+		}
+
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return
+		}
+	}
+	return
+}
+
+func stunParseResponse(msg []byte) (addr netip.Addr, err error) {
+	if len(msg) < common.STUNHeaderLen || binary.BigEndian.Uint32(msg[4:]) != common.STUNMagicCookie {
+		return addr, errors.New("STUN 响应格式错误")
+	}
+	msgType := binary.BigEndian.Uint16(msg[0:])
+	if int(binary.BigEndian.Uint16(msg[2:]))+common.STUNHeaderLen > len(msg) {
+		return addr, errors.New("STUN 响应格式错误")
+	}
+	msg = msg[:common.STUNHeaderLen+int(binary.BigEndian.Uint16(msg[2:]))]
+
+	var mapped netip.Addr
+	for off := common.STUNHeaderLen; off+4 <= len(msg); {
+		attrType := binary.BigEndian.Uint16(msg[off:])
+		attrLen := int(binary.BigEndian.Uint16(msg[off+2:]))
+		if off+4+attrLen > len(msg) {
+			return addr, errors.New("STUN 响应格式错误")
+		}
+		value := msg[off+4 : off+4+attrLen]
+		// 属性按 4 字节对齐
+		off += 4 + (attrLen+3)&^3
+
+		switch attrType {
+		case common.STUNErrorCode:
+			if msgType == common.STUNBindingError && len(value) >= 4 {
+				code := int(value[2]&0x07)*100 + int(value[3])
+				return addr, errors.New("STUN 错误 " + strconv.Itoa(code) + " " + string(value[4:]))
+			}
+		case common.STUNXorMappedAddress:
+			if msgType == common.STUNBindingSuccess {
+				return stunDecodeAddress(value, msg[4:20])
+			}
+		case common.STUNMappedAddress:
+			// 旧服务器只返回不异或的地址
+			if a, e := stunDecodeAddress(value, nil); e == nil {
+				mapped = a
+			}
+		}
+	}
+
+	if msgType != common.STUNBindingSuccess {
+		return addr, errors.New("STUN 请求失败")
+	}
+	if !mapped.IsValid() {
+		return addr, errors.New("STUN 响应中没有映射地址")
+	}
+	return mapped, nil
+}
+
+// stunDecodeAddress xorKey 为魔数和事务 ID，为空时表示地址没有异或
+func stunDecodeAddress(value, xorKey []byte) (addr netip.Addr, err error) {
+	if len(value) < 4 {
+		return addr, errors.New("STUN 地址格式错误")
+	}
+
+	var ipLen int
+	switch value[1] {
+	case 0x01:
+		ipLen = 4
+	case 0x02:
+		ipLen = 16
+	default:
+		return addr, errors.New("STUN 地址族未知")
+	}
+	if len(value) < 4+ipLen {
+		return addr, errors.New("STUN 地址格式错误")
+	}
+
+	ip := bytes.Clone(value[4 : 4+ipLen])
+	for i := range xorKey {
+		if i < len(ip) {
+			ip[i] ^= xorKey[i]
+		}
+	}
+	addr, _ = netip.AddrFromSlice(ip)
+	return addr, nil
+}
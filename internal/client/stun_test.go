@@ -0,0 +1,83 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// startFakeSTUN 回复请求方的源地址，drop 指定丢弃前几个请求以验证重传
+func startFakeSTUN(t *testing.T, drop int) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < common.STUNHeaderLen || binary.BigEndian.Uint16(buf) != common.STUNBindingRequest {
+				continue
+			}
+			if drop > 0 {
+				drop--
+				continue
+			}
+			// 先回一个事务 ID 不同的响应，应被忽略
+			stray := common.STUNBindingResponse(make([]byte, 12), netip.MustParseAddrPort("192.0.2.99:1"))
+			_, _ = conn.WriteTo(stray, addr)
+			_, _ = conn.WriteTo(common.STUNBindingResponse(buf[8:20], addr.(*net.UDPAddr).AddrPort()), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestGetIPBySTUN(t *testing.T) {
+	server := startFakeSTUN(t, 1)
+
+	got, err := getIPBySTUN([]string{"127.0.0.1:1", server}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "127.0.0.1" {
+		t.Errorf("ip = %q, want 127.0.0.1", got)
+	}
+}
+
+func TestSTUNParseResponse(t *testing.T) {
+	txId := []byte("0123456789ab")
+	want := netip.MustParseAddrPort("[2001:db8::1]:4242")
+
+	got, err := stunParseResponse(common.STUNBindingResponse(txId, want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want.Addr() {
+		t.Errorf("addr = %v, want %v", got, want.Addr())
+	}
+
+	// 错误响应要带出错误码
+	msg := make([]byte, common.STUNHeaderLen)
+	binary.BigEndian.PutUint16(msg[0:], common.STUNBindingError)
+	binary.BigEndian.PutUint32(msg[4:], common.STUNMagicCookie)
+	copy(msg[8:], txId)
+	msg = binary.BigEndian.AppendUint16(msg, common.STUNErrorCode)
+	msg = binary.BigEndian.AppendUint16(msg, 8)
+	msg = append(msg, 0, 0, 4, 20, 'B', 'a', 'd', '!')
+	binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)-common.STUNHeaderLen))
+	if _, err = stunParseResponse(msg); err == nil || err.Error() != "STUN 错误 420 Bad!" {
+		t.Errorf("err = %v, want STUN 错误 420 Bad!", err)
+	}
+
+	// 长度超过实际数据
+	if _, err = stunParseResponse(msg[:len(msg)-2]); err == nil {
+		t.Error("want an error for truncated message")
+	}
+}
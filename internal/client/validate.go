@@ -0,0 +1,153 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Validate 校验 ConfDir 中的客户端配置和已启用服务的配置，比启动时的检查更严格
+// online 时用各服务商配置中的密钥查询一条解析记录
+func Validate(online bool) (r *common.ConfReport) {
+	r = &common.ConfReport{}
+	r.File(ConfFilename)
+	var c client
+	if err := common.LoadAndUnmarshal(ConfDir+"/"+ConfFilename, &c); err != nil {
+		r.Add("", "无法读取 "+err.Error())
+		return
+	}
+	r.AddError("", c.check())
+	c.validate(r)
+	if c.Center.Enable {
+		return
+	}
+
+	for _, f := range webConfFiles {
+		if f.provider == "" || !c.Services.names()[f.provider] {
+			continue
+		}
+		r.File(f.name)
+		conf := f.newConf()
+		if err := common.LoadAndUnmarshal(ConfDir+"/"+f.name, conf); err != nil {
+			r.Add("", "无法读取 "+err.Error())
+			continue
+		}
+		r.AddError("", conf.check())
+		r.Placeholders("", conf)
+		validateProvider(r, conf)
+		// 占位内容或格式有误时请求服务商没有意义
+		if !online || !r.FileOK(f.name) {
+			continue
+		}
+		data, _ := json.Marshal(conf)
+		if _, err := TestCredential(f.provider, data); err != nil {
+			r.Add("", "测试密钥失败 "+common.RedactError(err).Error())
+		}
+	}
+	return
+}
+
+// validate 检查 check 之外的地址格式和占位内容
+func (conf *client) validate(r *common.ConfReport) {
+	r.Placeholders("", conf)
+	r.URL("api_url.ipv4", conf.APIUrl.IPv4)
+	r.URL("api_url.ipv6", conf.APIUrl.IPv6)
+	r.URL("api_url.version", conf.APIUrl.Version)
+	if conf.Center.Enable {
+		if conf.Center.APIUrl == "" {
+			r.Add("center.api_url", "启用 center 时不能为空")
+		}
+		if conf.Center.Token == "" {
+			r.Add("center.token", "启用 center 时不能为空")
+		}
+		r.URL("center.api_url", conf.Center.APIUrl)
+	}
+	for _, sources := range []struct {
+		name string
+		list []ipSource
+	}{{"ipv4", conf.IPSources.IPv4}, {"ipv6", conf.IPSources.IPv6}} {
+		for i, s := range sources.list {
+			field := "ip_sources." + sources.name + "[" + strconv.Itoa(i) + "].url"
+			if s.URL == "" {
+				r.Add(field, "不能为空")
+			}
+			r.URL(field, s.URL)
+		}
+	}
+	r.IP("gateway.address", conf.Gateway.Address)
+	for i, s := range conf.STUN.Servers {
+		r.Server("stun.servers["+strconv.Itoa(i)+"]", s, false)
+	}
+	for i, s := range conf.Verify.Resolvers {
+		r.Server("verify.resolvers["+strconv.Itoa(i)+"]", s, true)
+	}
+	if conf.LANHosts.Enable {
+		for i, h := range conf.LANHosts.Hosts {
+			if h.Name != "" {
+				r.AddError("lan_hosts.hosts["+strconv.Itoa(i)+"].name", common.CheckDomain(h.Name, false))
+			}
+		}
+	}
+	r.HostPort("metrics_addr", conf.MetricsAddr)
+	if !strings.HasPrefix(conf.API.Addr, apiUnixPrefix) {
+		r.HostPort("api.addr", conf.API.Addr)
+	}
+	r.HostPort("web.addr", conf.Web.Addr)
+}
+
+// validateProvider 按各服务商的约定检查域名和解析记录的写法
+// DNSPod、AliDNS 等填写主机记录，Cloudflare 填写完整域名，HuaweiCloud 填写以 "." 结尾的完整域名
+func validateProvider(r *common.ConfReport, conf confChecker) {
+	switch p := conf.(type) {
+	case *DNSPod:
+		r.URL("endpoint", p.Endpoint)
+		validateSubdomain(r, p.Domain, p.SubDomain)
+	case *AliDNS:
+		r.URL("endpoint", common.EndpointURL(p.Endpoint))
+		validateSubdomain(r, p.Domain, p.SubDomain)
+	case *Cloudflare:
+		r.URL("endpoint", p.Endpoint)
+		for _, rec := range recordFields("domain", p.Domain) {
+			r.AddError(rec.field, common.CheckDomain(rec.name, false))
+		}
+	case *HuaweiCloud:
+		r.URL("endpoint", common.EndpointURL(p.Endpoint))
+		r.AddError("zone_name", common.CheckDomain(p.ZoneName, true))
+		for _, rec := range recordFields("domain", p.Domain) {
+			if err := common.CheckDomain(rec.name, true); err != nil {
+				r.AddError(rec.field, err)
+			} else {
+				r.AddError(rec.field, common.CheckInZone(rec.name, p.ZoneName))
+			}
+		}
+	case *Volcengine:
+		r.URL("endpoint", p.Endpoint)
+		validateSubdomain(r, p.Domain, p.SubDomain)
+	case *BaiduCloud:
+		r.URL("endpoint", p.Endpoint)
+		validateSubdomain(r, p.Domain, p.SubDomain)
+	case *JDCloud:
+		r.URL("endpoint", p.Endpoint)
+		validateSubdomain(r, p.Domain, p.SubDomain)
+	}
+}
+
+// validateSubdomain domain 为主域名，sub_domain 为不带主域名的主机记录
+func validateSubdomain(r *common.ConfReport, domain string, sub common.Subdomain) {
+	r.AddError("domain", common.CheckDomain(domain, false))
+	for _, rec := range recordFields("sub_domain", sub) {
+		r.AddError(rec.field, common.CheckSubdomain(rec.name, domain))
+	}
+}
+
+// recordFields 按 a、aaaa 的顺序列出已填写的解析记录和字段名
+func recordFields(prefix string, names common.Subdomain) (records []struct{ field, name string }) {
+	if names.A != "" {
+		records = append(records, struct{ field, name string }{prefix + ".a", names.A})
+	}
+	if names.AAAA != "" {
+		records = append(records, struct{ field, name string }{prefix + ".aaaa", names.AAAA})
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir, oldDir := t.TempDir(), ConfDir
+	ConfDir = dir
+	t.Cleanup(func() { ConfDir = oldDir })
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ConfFilename, `{"enable":{"ipv4":true},"services":{"dnspod":true,"cloudflare":true,"huawei_cloud":true},
+		"stun":{"servers":["stun.cloudflare.com:3478"]},"web":{"addr":"127.0.0.1"}}`)
+	if _, err := (&DNSPod{}).InitConf(); err != nil {
+		t.Fatal(err)
+	}
+	write(CloudflareConfFilename, `{"zone_id":"1","api_token":"2","domain":{"a":"www"}}`)
+	write(HuaweiCloudConfFilename, `{"access_key_id":"1","secret_access_key":"2","zone_name":"example.cn.",
+		"domain":{"a":"www.example.cn.","aaaa":"www.example.net."}}`)
+
+	got := map[string]bool{}
+	for _, is := range Validate(false).Issues {
+		got[is.File+" "+is.Field] = true
+	}
+	for _, want := range []string{
+		ConfFilename + " web.addr",
+		ConfFilename + " ",
+		DNSPodConfFilename + " id",
+		DNSPodConfFilename + " sub_domain.a",
+		CloudflareConfFilename + " domain.a",
+		HuaweiCloudConfFilename + " domain.aaaa",
+	} {
+		if !got[want] {
+			t.Errorf("没有发现 %s，got %v", want, slices.Sorted(maps.Keys(got)))
+		}
+	}
+	if got[HuaweiCloudConfFilename+" domain.a"] || got[ConfFilename+" stun.servers[0]"] {
+		t.Errorf("误报 %v", slices.Sorted(maps.Keys(got)))
+	}
+}
+
+// TestSchema 发布的 JSON Schema 需要与配置文件的字段一致
+func TestSchema(t *testing.T) {
+	for _, f := range webConfFiles {
+		b, err := os.ReadFile(filepath.Join("..", "..", "schema", strings.TrimSuffix(f.name, ".json")+".schema.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var schema map[string]any
+		if err = json.Unmarshal(b, &schema); err != nil {
+			t.Fatal(f.name, err)
+		}
+		props := schema["properties"].(map[string]any)
+		delete(props, "$schema")
+		compareSchema(t, f.name, schema, reflect.TypeOf(f.newConf()))
+	}
+}
+
+func compareSchema(t *testing.T, path string, schema map[string]any, typ reflect.Type) {
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+		if items, ok := schema["items"].(map[string]any); ok {
+			schema = items
+		}
+	}
+	if typ.Kind() != reflect.Struct {
+		return
+	}
+	props, _ := schema["properties"].(map[string]any)
+	fields := map[string]bool{}
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = true
+		sub, ok := props[name].(map[string]any)
+		if !ok {
+			t.Errorf("%s 的 schema 缺少 %s", path, name)
+			continue
+		}
+		compareSchema(t, path+"."+name, sub, typ.Field(i).Type)
+	}
+	for name := range props {
+		if !fields[name] {
+			t.Errorf("%s 的 schema 多出了 %s", path, name)
+		}
+	}
+}
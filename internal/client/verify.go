@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"ddns-watchdog/internal/common"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	verifyDefaultTimeout = 2 * time.Minute
+	verifyInterval       = 5 * time.Second
+	verifyLookupTimeout  = 10 * time.Second
+)
+
+// ExpectedRecord 更新后期望解析到的记录，name 为完整域名
+type ExpectedRecord struct {
+	Name   string
+	Type   string
+	Values []string
+}
+
+// ExpectedRecords 按服务商的记录名和本次发布的地址生成需要确认的记录
+func ExpectedRecords(enabled common.Enable, names common.Subdomain, ipv4s, ipv6s []string, hosts []common.HostAddr) (records []ExpectedRecord) {
+	if ipv4s = uniqueValues(ipv4s); enabled.IPv4 && names.A != "" && len(ipv4s) != 0 {
+		records = append(records, ExpectedRecord{Name: names.A, Type: "A", Values: ipv4s})
+	}
+	if ipv6s = uniqueValues(ipv6s); enabled.IPv6 && names.AAAA != "" && len(ipv6s) != 0 {
+		records = append(records, ExpectedRecord{Name: names.AAAA, Type: "AAAA", Values: ipv6s})
+	}
+	for _, h := range hosts {
+		records = append(records, ExpectedRecord{Name: strings.TrimSuffix(h.Name, "."), Type: "AAAA", Values: []string{h.IP}})
+	}
+	return
+}
+
+// VerifyRecords 反复查询直到所有服务器都返回期望的值或超时
+// 已生效的记录写入 msg，超时仍未生效的记录写入 errs，每条记录的结果同时记入状态、历史记录和指标
+// 开启代理的 Cloudflare 记录解析到 Cloudflare 的节点而不是发布的地址，不做确认
+func VerifyRecords(provider string, conf verify, records []ExpectedRecord) (msg []string, errs []error) {
+	if provider == common.Cloudflare && Cf.Proxied {
+		slog.Debug("开启代理的解析记录无法确认是否生效，已跳过", "provider", provider)
+		return
+	}
+	timeout := verifyDefaultTimeout
+	if conf.TimeoutSeconds > 0 {
+		timeout = time.Duration(conf.TimeoutSeconds) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+
+	pending := make([]verifyState, 0, len(records))
+	for _, rec := range records {
+		st := verifyState{record: rec}
+		if st.servers, st.err = verifyServers(conf, rec.Name); st.err != nil {
+			err := errors.New(rec.Name + " " + rec.Type + " 无法确认是否生效: " + st.err.Error())
+			observeVerify(provider, rec, err)
+			errs = append(errs, err)
+			continue
+		}
+		pending = append(pending, st)
+	}
+
+	for {
+		remaining := pending[:0]
+		for _, st := range pending {
+			if st.check() {
+				slog.Info("解析记录已生效", "record", st.record.Name, "type", st.record.Type,
+					"new_ip", strings.Join(st.record.Values, ","))
+				observeVerify(provider, st.record, nil)
+				msg = append(msg, st.record.Name+" "+st.record.Type+" 已生效 "+strings.Join(st.record.Values, ","))
+				continue
+			}
+			remaining = append(remaining, st)
+		}
+		pending = remaining
+		if len(pending) == 0 || time.Now().Add(verifyInterval).After(deadline) || !wait(verifyInterval) {
+			break
+		}
+	}
+
+	reason := " 在 " + strconv.Itoa(int(timeout.Seconds())) + " 秒内未生效: "
+	if requestCtx.Err() != nil {
+		reason = " 退出前未确认生效: "
+	}
+	for _, st := range pending {
+		err := errors.New(st.record.Name + " " + st.record.Type + reason + st.err.Error())
+		observeVerify(provider, st.record, err)
+		errs = append(errs, err)
+	}
+	return
+}
+
+type verifyServer struct {
+	addr string
+	// rd 公共 DNS 需要请求递归
+	rd bool
+}
+
+type verifyState struct {
+	record  ExpectedRecord
+	servers []verifyServer
+	// err 最近一次不一致的原因
+	err error
+}
+
+// check 所有服务器都返回期望的值时为 true
+func (st *verifyState) check() bool {
+	qtype := dnsTypeA
+	if st.record.Type == "AAAA" {
+		qtype = dnsTypeAAAA
+	}
+	for _, srv := range st.servers {
+		answers, err := dnsQuery("udp", srv.addr, st.record.Name, qtype, dnsClassIN, srv.rd)
+		if err != nil {
+			st.err = errors.New(srv.addr + " " + err.Error())
+			return false
+		}
+		got := make([]string, 0, len(answers))
+		for _, v := range answers {
+			if ip, e := normalizeIP(v, qtype == dnsTypeAAAA); e == nil {
+				got = append(got, ip)
+			}
+		}
+		if !sameValues(uniqueValues(got), st.record.Values) {
+			st.err = errors.New(srv.addr + " 返回 [" + strings.Join(got, ",") + "]")
+			return false
+		}
+	}
+	return true
+}
+
+// verifyServers 汇总需要查询的权威服务器和公共 DNS
+func verifyServers(conf verify, name string) (servers []verifyServer, err error) {
+	if conf.Authoritative {
+		var addrs []string
+		if addrs, err = authoritativeServers(name); err != nil {
+			return
+		}
+		for _, addr := range addrs {
+			servers = append(servers, verifyServer{addr: addr})
+		}
+	}
+	for _, r := range conf.Resolvers {
+		if _, _, e := net.SplitHostPort(r); e != nil {
+			r = net.JoinHostPort(r, "53")
+		}
+		servers = append(servers, verifyServer{addr: r, rd: true})
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("没有可查询的服务器")
+	}
+	return
+}
+
+// authoritativeServers 从 name 开始逐级向上查找 NS 记录，返回权威服务器的地址
+func authoritativeServers(name string) (addrs []string, err error) {
+	ctx, cancel := context.WithTimeout(requestCtx, verifyLookupTimeout)
+	defer cancel()
+
+	zone := strings.TrimSuffix(name, ".")
+	var ns []*net.NS
+	for {
+		if ns, err = net.DefaultResolver.LookupNS(ctx, zone); err == nil && len(ns) != 0 {
+			break
+		}
+		i := strings.IndexByte(zone, '.')
+		if i == -1 {
+			return nil, errors.New("没有找到 " + name + " 的权威服务器")
+		}
+		zone = zone[i+1:]
+	}
+
+	// 本机未必有 IPv6 连接，有 IPv4 地址时只查询 IPv4
+	var addrs6 []string
+	for _, n := range ns {
+		ips, e := net.DefaultResolver.LookupIPAddr(ctx, n.Host)
+		if e != nil {
+			continue
+		}
+		for _, ip := range ips {
+			if ip.IP.To4() != nil {
+				addrs = append(addrs, net.JoinHostPort(ip.IP.String(), "53"))
+			} else {
+				addrs6 = append(addrs6, net.JoinHostPort(ip.IP.String(), "53"))
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		addrs = addrs6
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("无法解析 " + zone + " 的权威服务器地址")
+	}
+	return addrs, nil
+}
+
+// fqdnOf 把相对 domain 的主机记录转换为完整域名，"@" 为 domain 本身
+func fqdnOf(sub, domain string) string {
+	if sub == "" {
+		return ""
+	}
+	if sub == "@" {
+		return domain
+	}
+	return sub + "." + domain
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"ddns-watchdog/internal/common"
+	"testing"
+)
+
+func TestVerifyRecords(t *testing.T) {
+	server := startFakeDNS(t, dnsTypeA, dnsClassIN, []byte{192, 0, 2, 1})
+	conf := verify{Enable: true, Resolvers: []string{server}, TimeoutSeconds: 1}
+
+	records := ExpectedRecords(common.Enable{IPv4: true, IPv6: true},
+		common.Subdomain{A: "www.example.com", AAAA: "www.example.com"}, []string{"192.0.2.1"}, []string{""}, nil)
+	if len(records) != 1 {
+		t.Fatalf("records = %v, want only A", records)
+	}
+	msg, errs := VerifyRecords(common.DNSPod, conf, records)
+	if len(errs) != 0 || len(msg) != 1 {
+		t.Fatalf("msg = %v, errs = %v, want 1 message", msg, errs)
+	}
+	if got := recordStatusOf(t, "www.example.com|A"); got.Kind != common.HistoryVerify || got.Result != resultVerified {
+		t.Errorf("status = %+v, want verified", got)
+	}
+
+	records[0].Values = []string{"192.0.2.2"}
+	msg, errs = VerifyRecords(common.DNSPod, conf, records)
+	if len(errs) != 1 || len(msg) != 0 {
+		t.Fatalf("msg = %v, errs = %v, want 1 error", msg, errs)
+	}
+	if got := recordStatusOf(t, "www.example.com|A"); got.Result != resultFailed || got.Error == "" {
+		t.Errorf("status = %+v, want failed", got)
+	}
+}
+
+func recordStatusOf(t *testing.T, key string) common.HistoryEntry {
+	t.Helper()
+	status.Lock()
+	defer status.Unlock()
+	return status.records[common.DNSPod+"|"+key]
+}
+
+func TestVerifyRecordsProxied(t *testing.T) {
+	oldCf := Cf
+	t.Cleanup(func() { Cf = oldCf })
+	Cf.Proxied = true
+
+	// 没有可查询的服务器，不跳过时会报错
+	records := []ExpectedRecord{{Name: "proxied.example.com", Type: "A", Values: []string{"192.0.2.1"}}}
+	msg, errs := VerifyRecords(common.Cloudflare, verify{Enable: true}, records)
+	if len(msg) != 0 || len(errs) != 0 {
+		t.Errorf("msg = %v, errs = %v, want skipped", msg, errs)
+	}
+	status.Lock()
+	_, ok := status.records[common.Cloudflare+"|proxied.example.com|A"]
+	status.Unlock()
+	if ok {
+		t.Errorf("跳过的记录不应写入状态")
+	}
+}
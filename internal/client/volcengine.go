@@ -0,0 +1,301 @@
+package client
+
+import (
+	"bytes"
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	VolcengineConfFilename = "volcengine.json"
+	volcenginePrefix       = "Volcengine: "
+	volcengineEndpoint     = "https://open.volcengineapi.com"
+	volcengineVersion      = "2018-08-01"
+	volcengineDefaultTTL   = 600
+	volcenginePageSize     = 100
+)
+
+var volcengineSigner = v4Signer{
+	algorithm:  "HMAC-SHA256",
+	terminator: "request",
+	dateHeader: "X-Date",
+	region:     "cn-north-1",
+	service:    "DNS",
+}
+
+type Volcengine struct {
+	AccessKeyId     string           `json:"access_key_id"`
+	SecretAccessKey string           `json:"secret_access_key"`
+	Endpoint        string           `json:"endpoint"`
+	Domain          string           `json:"domain"`
+	SubDomain       common.Subdomain `json:"sub_domain"`
+	ZoneId          int64            `json:"-"`
+}
+
+type volcengineResp struct {
+	ResponseMetadata struct {
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+	} `json:"ResponseMetadata"`
+	Result json.RawMessage `json:"Result"`
+}
+
+type volcengineZones struct {
+	Zones []struct {
+		ZID      int64  `json:"ZID"`
+		ZoneName string `json:"ZoneName"`
+	} `json:"Zones"`
+}
+
+type volcengineRecords struct {
+	TotalCount int `json:"TotalCount"`
+	Records    []struct {
+		RecordID string `json:"RecordID"`
+		Host     string `json:"Host"`
+		Type     string `json:"Type"`
+		Value    string `json:"Value"`
+		Line     string `json:"Line"`
+		TTL      int    `json:"TTL"`
+	} `json:"Records"`
+}
+
+type volcengineUpdateRequest struct {
+	RecordID string `json:"RecordID"`
+	Host     string `json:"Host"`
+	Line     string `json:"Line"`
+	Type     string `json:"Type"`
+	Value    string `json:"Value"`
+	TTL      int    `json:"TTL"`
+}
+
+type volcengineCreateRequest struct {
+	ZID   int64  `json:"ZID"`
+	Host  string `json:"Host"`
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+	TTL   int    `json:"TTL"`
+}
+
+func (vc *Volcengine) InitConf() (msg string, err error) {
+	*vc = Volcengine{
+		AccessKeyId: "在 https://console.volcengine.com/iam/keymanage/ 获取",
+		Domain:      "example.com",
+		SubDomain: common.Subdomain{
+			A:    "A记录子域名",
+			AAAA: "AAAA记录子域名",
+		},
+	}
+	vc.SecretAccessKey = vc.AccessKeyId
+
+	return "初始化 " + ConfDir + "/" + VolcengineConfFilename,
+		common.MarshalAndSave(vc, ConfDir+"/"+VolcengineConfFilename)
+}
+
+func (vc *Volcengine) LoadConf() (err error) {
+	if err = common.LoadAndUnmarshal(ConfDir+"/"+VolcengineConfFilename, &vc); err != nil {
+		return
+	}
+	return vc.check()
+}
+
+func (vc *Volcengine) check() error {
+	if vc.AccessKeyId == "" || vc.SecretAccessKey == "" || vc.Domain == "" || (vc.SubDomain.A == "" && vc.SubDomain.AAAA == "") {
+		return errors.New("请打开配置文件 " + ConfDir + "/" + VolcengineConfFilename + " 检查你的 access_key_id, secret_access_key, domain, sub_domain 并重新启动")
+	}
+	return nil
+}
+
+func (vc *Volcengine) Run(enabled common.Enable, ipv4, ipv6 string) (msg []string, errs []error) {
+	if vc.ZoneId == 0 && (enabled.IPv4 || enabled.IPv6) {
+		if err := vc.getZoneId(); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+	if ipv4 != "" && enabled.IPv4 && vc.SubDomain.A != "" {
+		if m, err := vc.syncParseRecord(ipv4, "A", vc.SubDomain.A); err != nil {
+			errs = append(errs, err)
+		} else if m != "" {
+			msg = append(msg, m)
+		}
+	}
+	if ipv6 != "" && enabled.IPv6 && vc.SubDomain.AAAA != "" {
+		if m, err := vc.syncParseRecord(ipv6, "AAAA", vc.SubDomain.AAAA); err != nil {
+			errs = append(errs, err)
+		} else if m != "" {
+			msg = append(msg, m)
+		}
+	}
+	return
+}
+
+// RunHosts 为局域网主机发布 AAAA 记录，主机的完整域名需要属于 domain
+func (vc *Volcengine) RunHosts(hosts []common.HostAddr) (msg []string, errs []error) {
+	if vc.ZoneId == 0 && len(hosts) != 0 {
+		if err := vc.getZoneId(); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+	return runHosts(volcenginePrefix, hosts, func(fqdn string) (string, error) {
+		return subDomainOf(fqdn, vc.Domain)
+	}, vc.syncParseRecord)
+}
+
+// RecordNames 返回 A 和 AAAA 记录的完整域名
+func (vc *Volcengine) RecordNames() common.Subdomain {
+	return common.Subdomain{A: fqdnOf(vc.SubDomain.A, vc.Domain), AAAA: fqdnOf(vc.SubDomain.AAAA, vc.Domain)}
+}
+
+func (vc *Volcengine) syncParseRecord(ipAddr, recordType, subDomain string) (msg string, err error) {
+	ev := updateEvent{provider: common.Volcengine, record: fqdnOf(subDomain, vc.Domain), recordType: recordType, newIP: ipAddr}
+	defer func() { err = ev.done(msg != "", err) }()
+
+	// 获取解析记录
+	record, err := vc.getParseRecord(subDomain, recordType)
+	ev.oldIP = record.Value
+	switch {
+	case err != nil:
+	case record.RecordID == "":
+		// 新建解析记录
+		if err = vc.createParseRecord(ipAddr, recordType, subDomain); err == nil {
+			msg = volcenginePrefix + subDomain + "." + vc.Domain + " 已新建解析记录 " + ipAddr
+		}
+	case record.Value != ipAddr:
+		// 更新解析记录
+		record.Value = ipAddr
+		if err = vc.updateParseRecord(record); err == nil {
+			msg = volcenginePrefix + subDomain + "." + vc.Domain + " 已更新解析记录 " + ipAddr
+		}
+	}
+	return
+}
+
+func (vc *Volcengine) getZoneId() (err error) {
+	var result volcengineZones
+	if err = vc.request(http.MethodGet, "ListZones", url.Values{"Key": {vc.Domain}}, nil, &result); err != nil {
+		return
+	}
+
+	for _, v := range result.Zones {
+		if v.ZoneName == vc.Domain {
+			vc.ZoneId = v.ZID
+			break
+		}
+	}
+	if vc.ZoneId == 0 {
+		err = errors.New(volcenginePrefix + vc.Domain + " Zone 不存在")
+	}
+	return
+}
+
+func (vc *Volcengine) getParseRecord(subDomain, recordType string) (record volcengineUpdateRequest, err error) {
+	// Host 默认为模糊匹配，改为精确匹配后仍按页遍历
+	for page, seen := 1, 0; ; page++ {
+		query := url.Values{
+			"ZID":        {strconv.FormatInt(vc.ZoneId, 10)},
+			"Host":       {subDomain},
+			"Type":       {recordType},
+			"SearchMode": {"exact"},
+			"PageNumber": {strconv.Itoa(page)},
+			"PageSize":   {strconv.Itoa(volcenginePageSize)},
+		}
+
+		var result volcengineRecords
+		if err = vc.request(http.MethodGet, "ListRecords", query, nil, &result); err != nil {
+			return
+		}
+
+		for _, v := range result.Records {
+			if v.Host == subDomain && v.Type == recordType {
+				return volcengineUpdateRequest{
+					RecordID: v.RecordID,
+					Host:     v.Host,
+					Line:     v.Line,
+					Type:     v.Type,
+					Value:    v.Value,
+					TTL:      v.TTL,
+				}, nil
+			}
+		}
+
+		seen += len(result.Records)
+		if len(result.Records) == 0 || seen >= result.TotalCount {
+			return
+		}
+	}
+}
+
+func (vc *Volcengine) createParseRecord(ipAddr, recordType, subDomain string) (err error) {
+	reqData := volcengineCreateRequest{
+		ZID:   vc.ZoneId,
+		Host:  subDomain,
+		Type:  recordType,
+		Value: ipAddr,
+		TTL:   volcengineDefaultTTL,
+	}
+	return vc.request(http.MethodPost, "CreateRecord", nil, reqData, nil)
+}
+
+func (vc *Volcengine) updateParseRecord(record volcengineUpdateRequest) (err error) {
+	return vc.request(http.MethodPost, "UpdateRecord", nil, record, nil)
+}
+
+func (vc *Volcengine) request(method, action string, query url.Values, body, result any) (err error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("Action", action)
+	query.Set("Version", volcengineVersion)
+
+	var reqJson []byte
+	if body != nil {
+		if reqJson, err = json.Marshal(body); err != nil {
+			return
+		}
+	}
+
+	req, err := httpNewRequest(method, endpointOr(vc.Endpoint, volcengineEndpoint)+"/?"+query.Encode(), bytes.NewReader(reqJson))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	volcengineSigner.sign(req, reqJson, vc.AccessKeyId, vc.SecretAccessKey, time.Now())
+
+	start := time.Now()
+	resp, err := common.DefaultHttpClient.Do(req)
+	observeAPI(common.Volcengine, start)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	respJson, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	var res volcengineResp
+	if err = json.Unmarshal(respJson, &res); err != nil {
+		return
+	}
+	if e := res.ResponseMetadata.Error; e != nil && e.Code != "" {
+		return errors.New(volcenginePrefix + e.Code + ": " + e.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(volcenginePrefix + "HTTP " + strconv.Itoa(resp.StatusCode))
+	}
+
+	if result == nil || len(res.Result) == 0 {
+		return
+	}
+	return json.Unmarshal(res.Result, result)
+}
@@ -0,0 +1,447 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"ddns-watchdog/internal/common"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	webSessionCookie = "ddns_watchdog_session"
+	webSessionTTL    = 12 * time.Hour
+	// webLoginDelay 密码错误时延迟回复，减慢猜测密码
+	webLoginDelay = time.Second
+	// webHistoryDays 和 webHistoryLimit 限制最近更新结果的范围
+	webHistoryDays  = 7
+	webHistoryLimit = 200
+	webMaxBody      = 1 << 20
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// confChecker 可以单独校验的配置
+type confChecker interface {
+	check() error
+}
+
+// webConfSpec 网页可以修改的配置文件，provider 为空表示客户端配置，newConf 返回用于解析和校验的空配置
+type webConfSpec struct {
+	name     string
+	provider string
+	newConf  func() confChecker
+}
+
+// webDestinationKeys 决定密钥发往哪里的字段，如服务商的 endpoint 和 region、中心服务端和通知渠道的地址
+var webDestinationKeys = []string{"endpoint", "region", "api_url", "url", "host", "port"}
+
+var webConfFiles = []webConfSpec{
+	{ConfFilename, "", func() confChecker { return &client{} }},
+	{DNSPodConfFilename, common.DNSPod, func() confChecker { return &DNSPod{} }},
+	{AliDNSConfFilename, common.AliDNS, func() confChecker { return &AliDNS{} }},
+	{CloudflareConfFilename, common.Cloudflare, func() confChecker { return &Cloudflare{} }},
+	{HuaweiCloudConfFilename, common.HuaweiCloud, func() confChecker { return &HuaweiCloud{} }},
+	{VolcengineConfFilename, common.Volcengine, func() confChecker { return &Volcengine{} }},
+	{BaiduCloudConfFilename, common.BaiduCloud, func() confChecker { return &BaiduCloud{} }},
+	{JDCloudConfFilename, common.JDCloud, func() confChecker { return &JDCloud{} }},
+}
+
+// webConfFile GET /web/api/files 的一项，content 中的密钥已替换为 ******
+type webConfFile struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider,omitempty"`
+	Exists   bool   `json:"exists"`
+	Content  any    `json:"content,omitempty"`
+}
+
+// check 校验 web 的配置，错误信息由调用方补充配置文件位置
+func (conf web) check() error {
+	if conf.Addr == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(conf.Addr); err != nil {
+		return errors.New("addr " + err.Error())
+	}
+	if conf.Password == "" {
+		return errors.New("addr 不为空时需要填写 password")
+	}
+	return nil
+}
+
+// webSessions 登录后的会话，只保存在内存中，重启后需要重新登录
+type webSessions struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func (s *webSessions) create(now time.Time) string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, exp := range s.expires {
+		if now.After(exp) {
+			delete(s.expires, k)
+		}
+	}
+	s.expires[id] = now.Add(webSessionTTL)
+	return id
+}
+
+func (s *webSessions) valid(id string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.expires[id]
+	return ok && now.Before(exp)
+}
+
+func (s *webSessions) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expires, id)
+}
+
+// ServeWeb 按 Client.Web 提供网页管理，监听失败时立即返回错误
+func ServeWeb() (err error) {
+	conf := Client.Web
+	ln, err := net.Listen("tcp", conf.Addr)
+	if err != nil {
+		return errors.New("web 的 addr " + err.Error())
+	}
+
+	srv := &http.Server{
+		Handler:           webHandler(conf.Password),
+		ReadHeaderTimeout: 2 * time.Second,
+		// 测试密钥需要请求服务商 API
+		WriteTimeout: time.Minute,
+	}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	return
+}
+
+func webHandler(password string) http.Handler {
+	sessions := &webSessions{expires: make(map[string]time.Time)}
+	static, _ := fs.Sub(webFiles, "web")
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServerFS(static))
+	mux.HandleFunc("POST /web/login", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(io.LimitReader(req.Body, webMaxBody)).Decode(&body); err != nil {
+			writeAPIMessage(w, http.StatusBadRequest, "请求格式错误")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(body.Password), []byte(password)) != 1 {
+			time.Sleep(webLoginDelay)
+			writeAPIMessage(w, http.StatusUnauthorized, "密码错误")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     webSessionCookie,
+			Value:    sessions.create(time.Now()),
+			Path:     "/",
+			MaxAge:   int(webSessionTTL / time.Second),
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		writeAPIMessage(w, http.StatusOK, "已登录")
+	})
+	mux.HandleFunc("POST /web/logout", func(w http.ResponseWriter, req *http.Request) {
+		if c, err := req.Cookie(webSessionCookie); err == nil {
+			sessions.remove(c.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: webSessionCookie, Path: "/", MaxAge: -1})
+		writeAPIMessage(w, http.StatusOK, "已退出登录")
+	})
+
+	api := http.NewServeMux()
+	api.HandleFunc("GET /web/api/status", func(w http.ResponseWriter, req *http.Request) {
+		writeAPIJson(w, http.StatusOK, currentStatus())
+	})
+	api.HandleFunc("GET /web/api/history", func(w http.ResponseWriter, req *http.Request) {
+		entries, err := recentHistory(time.Now())
+		if err != nil {
+			writeAPIMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeAPIJson(w, http.StatusOK, entries)
+	})
+	api.HandleFunc("GET /web/api/files", func(w http.ResponseWriter, req *http.Request) {
+		files := []webConfFile{}
+		for _, f := range webConfFiles {
+			_, err := os.Stat(ConfDir + "/" + f.name)
+			files = append(files, webConfFile{Name: f.name, Provider: f.provider, Exists: err == nil})
+		}
+		writeAPIJson(w, http.StatusOK, files)
+	})
+	api.HandleFunc("GET /web/api/files/{name}", func(w http.ResponseWriter, req *http.Request) {
+		f, ok := findWebConfFile(req.PathValue("name"))
+		if !ok {
+			writeAPIMessage(w, http.StatusNotFound, "不支持的配置文件")
+			return
+		}
+		old, exists, err := readConfFile(f.name)
+		if err != nil {
+			writeAPIMessage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !exists {
+			// 还没有配置文件时以空配置开始编辑
+			old = f.newConf()
+		}
+		writeAPIJson(w, http.StatusOK, webConfFile{Name: f.name, Provider: f.provider, Exists: exists, Content: redact(old)})
+	})
+	api.HandleFunc("PUT /web/api/files/{name}", func(w http.ResponseWriter, req *http.Request) {
+		f, ok := findWebConfFile(req.PathValue("name"))
+		if !ok {
+			writeAPIMessage(w, http.StatusNotFound, "不支持的配置文件")
+			return
+		}
+		conf, err := decodeConfFile(f.name, f.newConf(), req.Body)
+		if err != nil {
+			writeAPIMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = saveConfFile(f.name, conf); err != nil {
+			writeAPIMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeAPIMessage(w, http.StatusOK, "已保存并重新加载配置")
+	})
+	api.HandleFunc("POST /web/api/test/{name}", func(w http.ResponseWriter, req *http.Request) {
+		f, ok := findWebConfFile(req.PathValue("name"))
+		if !ok || f.provider == "" {
+			writeAPIMessage(w, http.StatusNotFound, "只能测试服务商的配置文件")
+			return
+		}
+		conf, err := decodeConfFile(f.name, f.newConf(), req.Body)
+		if err != nil {
+			writeAPIMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		data, _ := json.Marshal(conf)
+		msg, err := TestCredential(f.provider, data)
+		if err != nil {
+			writeAPIMessage(w, http.StatusBadRequest, common.RedactError(err).Error())
+			return
+		}
+		writeAPIMessage(w, http.StatusOK, msg)
+	})
+	mux.Handle("/web/api/", sessions.auth(api))
+	return mux
+}
+
+// auth 要求已登录的会话
+func (s *webSessions) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c, err := req.Cookie(webSessionCookie)
+		if err != nil || !s.valid(c.Value, time.Now()) {
+			writeAPIMessage(w, http.StatusUnauthorized, "请先登录")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func findWebConfFile(name string) (f webConfSpec, ok bool) {
+	i := slices.IndexFunc(webConfFiles, func(f webConfSpec) bool {
+		return f.name == name
+	})
+	if i < 0 {
+		return
+	}
+	return webConfFiles[i], true
+}
+
+// readConfFile 读取配置文件为通用结构，文件不存在时 exists 为 false
+func readConfFile(name string) (conf any, exists bool, err error) {
+	b, err := os.ReadFile(ConfDir + "/" + name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &conf); err != nil {
+		return nil, true, errors.New("配置文件 " + ConfDir + "/" + name + " 格式错误 " + err.Error())
+	}
+	return conf, true, nil
+}
+
+// decodeConfFile 读取网页提交的配置，仍为 ****** 的密钥取配置文件中原来的值，再按 conf 的类型校验
+func decodeConfFile(name string, conf confChecker, body io.Reader) (_ confChecker, err error) {
+	var edited any
+	if err = json.NewDecoder(io.LimitReader(body, webMaxBody)).Decode(&edited); err != nil {
+		return nil, errors.New("配置格式错误 " + err.Error())
+	}
+	old, _, err := readConfFile(name)
+	if err != nil {
+		return
+	}
+	edited = unredact("", edited, old)
+	if containsRedacted(edited) {
+		return nil, errors.New("修改了 endpoint、region 或通知地址时需要重新填写显示为 " + redacted +
+			" 的密钥和地址中显示为 ?" + redactedQuery + " 的参数")
+	}
+	b, err := json.Marshal(edited)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, conf); err != nil {
+		return nil, errors.New("配置格式错误 " + err.Error())
+	}
+	return conf, conf.check()
+}
+
+// unredact 按相同的位置比较，edited 中的值与 old 经过 redact 后相同时恢复为 old
+// 同一层的请求地址有变化时这一层及以下都不恢复 (包括 headers 这样的下级)，以免把原来的密钥发给新的地址
+func unredact(key string, edited, old any) any {
+	switch e := edited.(type) {
+	case map[string]any:
+		o, _ := old.(map[string]any)
+		moved := slices.ContainsFunc(webDestinationKeys, func(k string) bool {
+			return !sameDestination(unredact(k, e[k], o[k]), o[k])
+		})
+		if moved {
+			break
+		}
+		for k, v := range e {
+			e[k] = unredact(k, v, o[k])
+		}
+	case []any:
+		o, _ := old.([]any)
+		for i, v := range e {
+			if i < len(o) {
+				e[i] = unredact(key, v, o[i])
+			}
+		}
+	case string:
+		if o, ok := old.(string); ok && o != e {
+			if redactValue(key, o) == e {
+				return o
+			}
+			if u, ok := unredactURL(e, o); ok {
+				return u
+			}
+		}
+	}
+	return edited
+}
+
+// unredactURL 同一地址只修改了路径等部分时，恢复被隐藏的查询参数和用户信息
+// 协议或主机不同时不恢复，由 containsRedacted 要求重新填写
+func unredactURL(edited, old string) (string, bool) {
+	o, err := url.Parse(old)
+	if err != nil || o.Host == "" || (o.RawQuery == "" && o.User == nil) {
+		return "", false
+	}
+	u, err := url.Parse(edited)
+	if err != nil || !strings.EqualFold(u.Scheme, o.Scheme) || !strings.EqualFold(u.Host, o.Host) {
+		return "", false
+	}
+	if u.RawQuery == redactedQuery {
+		u.RawQuery = o.RawQuery
+	}
+	if u.User == nil {
+		u.User = o.User
+	}
+	return u.String(), true
+}
+
+// sameDestination 地址只比较协议和主机，其他值需要完全相同
+func sameDestination(a, b any) bool {
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		au, aErr := url.Parse(as)
+		bu, bErr := url.Parse(bs)
+		if aErr == nil && bErr == nil && au.Host != "" && bu.Host != "" {
+			return strings.EqualFold(au.Scheme, bu.Scheme) && strings.EqualFold(au.Host, bu.Host)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// containsRedacted 是否还有没有恢复的 ****** 或地址中被隐藏的查询参数
+func containsRedacted(v any) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, child := range v {
+			if containsRedacted(child) {
+				return true
+			}
+		}
+	case []any:
+		return slices.ContainsFunc(v, containsRedacted)
+	case string:
+		if v == redacted {
+			return true
+		}
+		u, err := url.Parse(v)
+		return err == nil && u.Host != "" && u.RawQuery == redactedQuery
+	}
+	return false
+}
+
+// saveConfFile 写入配置后交给主流程重新加载，重新加载失败时恢复原来的文件
+func saveConfFile(name string, conf any) (err error) {
+	path := ConfDir + "/" + name
+	old, readErr := os.ReadFile(path)
+	if readErr != nil && !errors.Is(readErr, os.ErrNotExist) {
+		return readErr
+	}
+	if err = common.MarshalAndSave(conf, path); err != nil {
+		return
+	}
+	if err = requestReload(); err == nil {
+		return
+	}
+
+	if readErr != nil {
+		_ = os.Remove(path)
+	} else {
+		_ = os.WriteFile(path, old, 0o600)
+	}
+	return errors.New(err.Error() + "，已恢复原来的配置文件")
+}
+
+// recentHistory 未启用历史记录时只返回本次运行中各解析记录最近一次的结果，按时间从新到旧
+func recentHistory(now time.Time) (entries []common.HistoryEntry, err error) {
+	path := currentHistoryPath()
+	if path == "" {
+		entries = currentStatus().Records
+	} else if entries, err = common.QueryHistory(path, "", now.AddDate(0, 0, -webHistoryDays)); err != nil {
+		return
+	}
+	slices.SortStableFunc(entries, func(a, b common.HistoryEntry) int {
+		return b.Time.Compare(a.Time)
+	})
+	if len(entries) > webHistoryLimit {
+		entries = entries[:webHistoryLimit]
+	}
+	if entries == nil {
+		entries = []common.HistoryEntry{}
+	}
+	return
+}
@@ -0,0 +1,182 @@
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+// request 请求网页管理接口，未登录时回到登录页
+async function request(method, path, body) {
+	const opts = {method, headers: {}};
+	if (body !== undefined) {
+		opts.headers["Content-Type"] = "application/json";
+		opts.body = JSON.stringify(body);
+	}
+	const resp = await fetch(path, opts);
+	const data = await resp.json().catch(() => ({}));
+	if (resp.status === 401 && path !== "/web/login") {
+		showLogin();
+		throw new Error(data.message || "请先登录");
+	}
+	if (!resp.ok) {
+		throw new Error(data.message || resp.statusText);
+	}
+	return data;
+}
+
+function showLogin() {
+	$("main").hidden = true;
+	$("login").hidden = false;
+}
+
+function showMain() {
+	$("login").hidden = true;
+	$("main").hidden = false;
+	showTab("status");
+}
+
+function setMessage(el, text, error) {
+	el.textContent = text;
+	el.classList.toggle("error", !!error);
+}
+
+function formatTime(t) {
+	return t ? new Date(t).toLocaleString() : "-";
+}
+
+// fillTable 按列生成表格，cells 返回每列的文本，result 列按结果着色
+function fillTable(tbody, rows, cells, empty) {
+	tbody.replaceChildren();
+	if (rows.length === 0) {
+		const td = document.createElement("td");
+		td.colSpan = 10;
+		td.textContent = empty;
+		tbody.insertRow().append(td);
+		return;
+	}
+	for (const row of rows) {
+		const tr = tbody.insertRow();
+		for (const text of cells(row)) {
+			const td = tr.insertCell();
+			td.textContent = text || "-";
+			if (text === row.result) {
+				td.className = row.result;
+			}
+		}
+	}
+}
+
+async function loadStatus() {
+	const s = await request("GET", "/web/api/status");
+	$("version").textContent = s.version;
+	let summary = s.paused ? "更新已暂停" : "正在运行";
+	if (s.next_run) {
+		summary += "，下一次检查 " + formatTime(s.next_run);
+	}
+	$("summary").textContent = summary;
+	fillTable($("sources"), s.sources, (v) => [v.type, v.source, v.ip || "获取失败", formatTime(v.time)],
+		"还没有获取过 IP");
+	$("detect").textContent = s.detect && s.detect.error ? "上次获取 IP 失败: " + s.detect.error : "";
+	fillTable($("records"), s.records,
+		(r) => [r.provider, r.record, r.type, r.new_ip, r.result, formatTime(r.time), r.error], "还没有同步过解析记录");
+}
+
+async function loadHistory() {
+	const entries = await request("GET", "/web/api/history");
+	fillTable($("history"), entries,
+		(e) => [formatTime(e.time), e.kind, e.provider, e.record, e.type, e.old_ip, e.new_ip, e.result, e.error],
+		"没有最近的记录");
+}
+
+async function loadFiles() {
+	const files = await request("GET", "/web/api/files");
+	const select = $("files");
+	const current = select.value;
+	select.replaceChildren();
+	for (const f of files) {
+		const opt = new Option(f.name + (f.exists ? "" : " (未创建)"), f.name);
+		opt.dataset.provider = f.provider || "";
+		select.add(opt);
+	}
+	if (current) {
+		select.value = current;
+	}
+	await loadFile();
+}
+
+async function loadFile() {
+	const f = await request("GET", "/web/api/files/" + encodeURIComponent($("files").value));
+	$("editor").value = JSON.stringify(f.content, null, "\t");
+	$("test").hidden = !f.provider;
+	setMessage($("config-message"), "");
+}
+
+// editedConf 解析编辑框中的 JSON，格式错误时提示并返回 undefined
+function editedConf() {
+	try {
+		return JSON.parse($("editor").value);
+	} catch (e) {
+		setMessage($("config-message"), "JSON 格式错误: " + e.message, true);
+	}
+}
+
+async function submitConf(method, path, pending) {
+	const conf = editedConf();
+	if (conf === undefined) {
+		return;
+	}
+	setMessage($("config-message"), pending);
+	try {
+		const res = await request(method, path + encodeURIComponent($("files").value), conf);
+		setMessage($("config-message"), res.message);
+		return true;
+	} catch (e) {
+		setMessage($("config-message"), e.message, true);
+	}
+}
+
+const tabs = {status: loadStatus, history: loadHistory, config: loadFiles};
+
+function showTab(name) {
+	for (const btn of document.querySelectorAll("nav button[data-tab]")) {
+		btn.classList.toggle("active", btn.dataset.tab === name);
+		$("tab-" + btn.dataset.tab).hidden = btn.dataset.tab !== name;
+	}
+	tabs[name]().catch((e) => console.error(e));
+}
+
+$("login-form").addEventListener("submit", async (ev) => {
+	ev.preventDefault();
+	try {
+		await request("POST", "/web/login", {password: $("password").value});
+		$("password").value = "";
+		setMessage($("login-message"), "");
+		showMain();
+	} catch (e) {
+		setMessage($("login-message"), e.message, true);
+	}
+});
+
+$("logout").addEventListener("click", async () => {
+	await request("POST", "/web/logout").catch(() => {});
+	showLogin();
+});
+
+for (const btn of document.querySelectorAll("nav button[data-tab]")) {
+	btn.addEventListener("click", () => showTab(btn.dataset.tab));
+}
+
+$("files").addEventListener("change", () => loadFile().catch((e) => setMessage($("config-message"), e.message, true)));
+$("save").addEventListener("click", async () => {
+	if (await submitConf("PUT", "/web/api/files/", "正在保存...")) {
+		await loadFiles();
+		setMessage($("config-message"), "已保存并重新加载配置");
+	}
+});
+$("test").addEventListener("click", () => submitConf("POST", "/web/api/test/", "正在测试..."));
+
+// 状态页每 30 秒刷新一次
+setInterval(() => {
+	if (!$("main").hidden && !$("tab-status").hidden) {
+		loadStatus().catch(() => {});
+	}
+}, 30000);
+
+request("GET", "/web/api/status").then(showMain, showLogin);
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWeb(t *testing.T) {
+	dir, oldDir, oldClient, oldDP := t.TempDir(), ConfDir, Client, DP
+	ConfDir = dir
+	t.Cleanup(func() { ConfDir, Client, DP = oldDir, oldClient, oldDP })
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ConfFilename, `{"enable":{"ipv4":true},"services":{"dnspod":true},"check_cycle_minutes":5}`)
+	write(DNSPodConfFilename, `{"id":"1","token":"secret-token","domain":"example.com","sub_domain":{"a":"www"}}`)
+
+	// 代替主流程处理重新加载的请求
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case req := <-APIRequests():
+				req.Reply(Reload())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	srv := httptest.NewServer(webHandler("pass"))
+	defer srv.Close()
+	jar, _ := cookiejar.New(nil)
+	c := &http.Client{Jar: jar}
+	do := func(method, path, body string) (code int, resp string) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+
+	if code, _ := do(http.MethodGet, "/web/api/status", ""); code != http.StatusUnauthorized {
+		t.Errorf("未登录时状态码 = %d", code)
+	}
+	if code, _ := do(http.MethodGet, "/", ""); code != http.StatusOK {
+		t.Errorf("首页状态码 = %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/web/login", `{"password":"pass"}`); code != http.StatusOK {
+		t.Fatalf("登录状态码 = %d", code)
+	}
+
+	code, body := do(http.MethodGet, "/web/api/files/"+DNSPodConfFilename, "")
+	if code != http.StatusOK || strings.Contains(body, "secret-token") || !strings.Contains(body, redacted) {
+		t.Fatalf("file = %d %s", code, body)
+	}
+	var f webConfFile
+	_ = json.Unmarshal([]byte(body), &f)
+	content := f.Content.(map[string]any)
+
+	// 校验失败时不写入
+	content["sub_domain"] = map[string]any{"a": ""}
+	b, _ := json.Marshal(content)
+	if code, body = do(http.MethodPut, "/web/api/files/"+DNSPodConfFilename, string(b)); code != http.StatusBadRequest {
+		t.Errorf("sub_domain 为空时 = %d %s", code, body)
+	}
+
+	// 仍为 ****** 的密钥沿用原来的值
+	content["sub_domain"] = map[string]any{"a": "home"}
+	b, _ = json.Marshal(content)
+	if code, body = do(http.MethodPut, "/web/api/files/"+DNSPodConfFilename, string(b)); code != http.StatusOK {
+		t.Fatalf("保存 = %d %s", code, body)
+	}
+	if DP.Token != "secret-token" || DP.SubDomain.A != "home" {
+		t.Errorf("DP = %+v", DP)
+	}
+
+	// 修改 endpoint 后不恢复原来的密钥，以免发给新的地址
+	var leaked bool
+	evil := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		leaked = true
+	}))
+	defer evil.Close()
+	content["endpoint"] = evil.URL
+	b, _ = json.Marshal(content)
+	for _, path := range []string{"/web/api/test/", "/web/api/files/"} {
+		method := http.MethodPost
+		if path == "/web/api/files/" {
+			method = http.MethodPut
+		}
+		if code, body = do(method, path+DNSPodConfFilename, string(b)); code != http.StatusBadRequest {
+			t.Errorf("%s 修改 endpoint = %d %s", path, code, body)
+		}
+	}
+	if leaked || DP.Endpoint != "" {
+		t.Errorf("密钥发给了新的 endpoint，DP = %+v", DP)
+	}
+
+	// 重新加载失败时恢复原来的文件
+	saved, _ := os.ReadFile(filepath.Join(dir, ConfFilename))
+	if code, body = do(http.MethodPut, "/web/api/files/"+ConfFilename,
+		`{"enable":{"ipv4":true},"services":{"dnspod":true},"check_cycle_minutes":0}`); code != http.StatusBadRequest {
+		t.Errorf("关闭周期检查 = %d %s", code, body)
+	}
+	if now, _ := os.ReadFile(filepath.Join(dir, ConfFilename)); string(now) != string(saved) {
+		t.Errorf("配置文件没有恢复: %s", now)
+	}
+
+	if code, _ = do(http.MethodPost, "/web/api/test/"+ConfFilename, "{}"); code != http.StatusNotFound {
+		t.Errorf("测试客户端配置 = %d", code)
+	}
+}
+
+func TestUnredactMovedWebhook(t *testing.T) {
+	const conf = `{"notify":{"channels":[{"type":"webhook","url":"https://hooks.example.com/ddns",` +
+		`"headers":{"Authorization":"Bearer SECRET"}}]}}`
+	var old, edited any
+	_ = json.Unmarshal([]byte(conf), &old)
+	_ = json.Unmarshal([]byte(conf), &edited)
+	edited = redactValue("", edited)
+	channel := edited.(map[string]any)["notify"].(map[string]any)["channels"].([]any)[0].(map[string]any)
+
+	// 地址不变时恢复下级的密钥
+	if got := unredact("", edited, old); !reflect.DeepEqual(got, old) {
+		t.Fatalf("unredact = %v", got)
+	}
+
+	edited = redactValue("", edited)
+	channel["url"] = "https://evil.example/hook"
+	got := unredact("", edited, old)
+	if b, _ := json.Marshal(got); strings.Contains(string(b), "SECRET") || !containsRedacted(got) {
+		t.Errorf("修改 url 后恢复了 headers 中的密钥: %s", b)
+	}
+}
+
+func TestUnredactURLQuery(t *testing.T) {
+	const old = "https://oapi.dingtalk.com/robot/send?access_token=SECRET"
+	for _, tt := range []struct {
+		edited string
+		want   string
+	}{
+		{"https://oapi.dingtalk.com/robot/send?...", old},
+		// 只修改路径时恢复原来的参数
+		{"https://oapi.dingtalk.com/robot/send2?...", "https://oapi.dingtalk.com/robot/send2?access_token=SECRET"},
+		// 重新填写了参数
+		{"https://oapi.dingtalk.com/robot/send?access_token=NEW", "https://oapi.dingtalk.com/robot/send?access_token=NEW"},
+		// 主机不同时不恢复
+		{"https://evil.example/robot/send?...", "https://evil.example/robot/send?..."},
+	} {
+		edited := map[string]any{"type": "dingtalk", "url": tt.edited}
+		got := unredact("", edited, map[string]any{"type": "dingtalk", "url": old})
+		if u := got.(map[string]any)["url"]; u != tt.want {
+			t.Errorf("unredact(%s) = %v, want %s", tt.edited, u, tt.want)
+		}
+		if want := strings.HasSuffix(tt.want, "?"+redactedQuery); containsRedacted(got) != want {
+			t.Errorf("containsRedacted(%v) = %v, want %v", got, !want, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -27,14 +28,30 @@ var (
 	BuildTime = ""
 )
 
-var DefaultHttpClient = newHttpClient()
+var (
+	DefaultHttpClient = newHttpClient("tcp")
+	// IPv4HttpClient 和 IPv6HttpClient 只通过对应协议建立连接，用于获取本机 IP
+	IPv4HttpClient = newHttpClient("tcp4")
+	IPv6HttpClient = newHttpClient("tcp6")
+)
 
-func newHttpClient() *http.Client {
+func newHttpClient(network string) *http.Client {
 	t := http.DefaultTransport.(*http.Transport).Clone()
 	t.TLSClientConfig = &tls.Config{
 		MinVersion: tls.VersionTLS12,
 	}
 	t.DisableKeepAlives = true
+	if network != "tcp" {
+		// 经过代理时出口协议由代理决定，所以不使用代理
+		t.Proxy = nil
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
 	return &http.Client{
 		Transport: t,
 		Timeout:   30 * time.Second,
@@ -47,6 +64,9 @@ const (
 	AliDNS      = "alidns"
 	Cloudflare  = "cloudflare"
 	HuaweiCloud = "huaweicloud"
+	Volcengine  = "volcengine"
+	BaiduCloud  = "baiducloud"
+	JDCloud     = "jdcloud"
 )
 
 type Enable struct {
@@ -63,6 +83,22 @@ type GeneralClient interface {
 	Run(Enable, string, string) ([]string, []error)
 }
 
+// RecordSetClient 能够同步同名整组解析记录的客户端
+type RecordSetClient interface {
+	RunSet(Enable, []string, []string) ([]string, []error)
+}
+
+// LANHostClient 能够为局域网主机发布 AAAA 记录的客户端
+type LANHostClient interface {
+	RunHosts([]HostAddr) ([]string, []error)
+}
+
+// HostAddr 一台局域网主机的完整域名和地址
+type HostAddr struct {
+	Name string
+	IP   string
+}
+
 type GetIPResp struct {
 	IP      string `json:"ip"`
 	Version string `json:"latest_version"`
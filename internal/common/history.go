@@ -0,0 +1,309 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// 历史记录的类型
+const (
+	HistoryDetect = "detect"
+	HistoryUpdate = "update"
+	HistoryVerify = "verify"
+)
+
+const (
+	defaultHistoryMaxDays    = 90
+	defaultHistoryMaxEntries = 10000
+	// historyPruneInterval 两次按保留期限清理之间的最短间隔，清理需要重写整个文件
+	historyPruneInterval = time.Hour
+)
+
+// HistoryConf file 为空时使用默认文件名，相对路径相对于配置文件目录
+// max_days 和 max_entries 为保留的天数和条数，为 0 时分别为 90 和 10000，小于 0 时不限制
+type HistoryConf struct {
+	Enable     bool   `json:"enable"`
+	File       string `json:"file"`
+	MaxDays    int    `json:"max_days"`
+	MaxEntries int    `json:"max_entries"`
+}
+
+// HistoryEntry 一条历史记录，result 为 updated, unchanged 或 failed，获取 IP 时为 ok 或 failed
+// 确认生效时为 verified 或 failed
+type HistoryEntry struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Source   string    `json:"source,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+	Record   string    `json:"record,omitempty"`
+	Type     string    `json:"type,omitempty"`
+	OldIP    string    `json:"old_ip,omitempty"`
+	NewIP    string    `json:"new_ip,omitempty"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// History 只追加的历史记录，每行一个 JSON 对象
+// 为 nil 时不做任何事，未启用时可以直接使用 nil
+type History struct {
+	path       string
+	maxAge     time.Duration
+	maxEntries int
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// Path 历史记录文件的路径
+func (conf HistoryConf) Path(confDir, defaultFile string) string {
+	file := conf.File
+	if file == "" {
+		file = defaultFile
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(confDir, file)
+}
+
+// OpenHistory 未启用时返回 nil，打开时按保留期限清理一次
+func OpenHistory(conf HistoryConf, path string) (h *History, err error) {
+	if !conf.Enable {
+		return
+	}
+	h = &History{path: path, maxEntries: conf.MaxEntries}
+	switch {
+	case conf.MaxDays == 0:
+		h.maxAge = defaultHistoryMaxDays * 24 * time.Hour
+	case conf.MaxDays > 0:
+		h.maxAge = time.Duration(conf.MaxDays) * 24 * time.Hour
+	}
+	if h.maxEntries == 0 {
+		h.maxEntries = defaultHistoryMaxEntries
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, errors.New("无法打开历史记录 " + err.Error())
+	}
+	_ = f.Close()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err = h.prune(time.Now()); err != nil {
+		return nil, errors.New("无法清理历史记录 " + err.Error())
+	}
+	return
+}
+
+// Append 追加一条记录，写入失败只输出日志
+func (h *History) Append(entry HistoryEntry) {
+	if h == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err = appendLine(h.path, line); err != nil {
+		slog.Warn("写入历史记录失败", "file", h.path, "error", err)
+		return
+	}
+	if time.Since(h.lastPrune) >= historyPruneInterval {
+		if err = h.prune(time.Now()); err != nil {
+			slog.Warn("清理历史记录失败", "file", h.path, "error", err)
+		}
+	}
+}
+
+func appendLine(path string, line []byte) (err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return
+}
+
+// prune 调用方需持有锁，删除超过保留期限的记录，没有需要删除的记录时不重写文件
+func (h *History) prune(now time.Time) (err error) {
+	h.lastPrune = now
+	entries, err := readHistory(h.path)
+	if err != nil {
+		return
+	}
+	keep := entries
+	if h.maxAge > 0 {
+		for len(keep) > 0 && now.Sub(keep[0].Time) > h.maxAge {
+			keep = keep[1:]
+		}
+	}
+	if h.maxEntries > 0 && len(keep) > h.maxEntries {
+		keep = keep[len(keep)-h.maxEntries:]
+	}
+	if len(keep) == len(entries) {
+		return
+	}
+
+	// 写入临时文件后替换，中途出错不会丢失原有记录
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range keep {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// readHistory 按写入顺序读取全部记录，跳过无法解析的行
+func readHistory(path string) (entries []HistoryEntry, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// QueryHistory 读取 since 之后的记录，record 不为空时只返回该记录
+func QueryHistory(path, record string, since time.Time) (entries []HistoryEntry, err error) {
+	all, err := readHistory(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.New("历史记录 " + path + " 不存在，请确认配置文件中已启用 history")
+		}
+		return
+	}
+	for _, e := range all {
+		if e.Time.Before(since) || (record != "" && !strings.EqualFold(strings.TrimSuffix(e.Record, "."), strings.TrimSuffix(record, "."))) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+// ParseSince 支持 "24h" 和 "7d" 这样的时长，以及 "2006-01-02"、"2006-01-02 15:04" 和 RFC 3339 格式的时间
+func ParseSince(s string, now time.Time) (t time.Time, err error) {
+	if s == "" {
+		return
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.DateOnly, "2006-01-02 15:04", time.DateTime} {
+		if t, err = time.ParseInLocation(layout, s, time.Local); err == nil {
+			return
+		}
+	}
+	if t, err = time.Parse(time.RFC3339, s); err == nil {
+		return
+	}
+	return t, errors.New(s + " 不是有效的时长或时间，例如 24h, 7d, 2006-01-02")
+}
+
+// PrintHistory 按列输出记录
+func PrintHistory(w io.Writer, entries []HistoryEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tKIND\tSOURCE\tPROVIDER\tRECORD\tTYPE\tOLD\tNEW\tRESULT\tERROR")
+	for _, e := range entries {
+		fmt.Fprintln(tw, strings.Join([]string{e.Time.Local().Format(time.DateTime), e.Kind, orDash(e.Source),
+			orDash(e.Provider), orDash(e.Record), orDash(e.Type), orDash(e.OldIP), orDash(e.NewIP), e.Result,
+			orDash(e.Error)}, "\t"))
+	}
+	_ = tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// HistoryCommand 处理 history 子命令，load 按配置文件目录加载配置并返回历史记录文件的路径
+func HistoryCommand(args []string, load func(confDir string) (path string, err error)) (err error) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	confDir := fs.StringP("conf", "c", "", "指定配置文件目录 (目录有空格请放在双引号中间)")
+	record := fs.StringP("record", "r", "", "只显示该解析记录，如 www.example.com")
+	since := fs.StringP("since", "s", "", "只显示这之后的记录，如 24h, 7d, 2006-01-02")
+	asJSON := fs.Bool("json", false, "每行输出一个 JSON 对象")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	path, err := load(*confDir)
+	if err != nil {
+		return
+	}
+	from, err := ParseSince(*since, time.Now())
+	if err != nil {
+		return
+	}
+	entries, err := QueryHistory(path, *record, from)
+	if err != nil {
+		return
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			if err = enc.Encode(e); err != nil {
+				return
+			}
+		}
+		return
+	}
+	PrintHistory(os.Stdout, entries)
+	return
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now()
+
+	// 打开时清理超过保留天数的记录
+	old := HistoryEntry{Time: now.AddDate(0, 0, -10), Kind: HistoryUpdate, Record: "old.example.com", Result: "updated"}
+	h, err := OpenHistory(HistoryConf{Enable: true}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Append(old)
+	if h, err = OpenHistory(HistoryConf{Enable: true, MaxDays: 7, MaxEntries: 2}, path); err != nil {
+		t.Fatal(err)
+	}
+	for i, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		h.Append(HistoryEntry{Time: now.Add(time.Duration(i) * time.Minute), Kind: HistoryUpdate,
+			Record: "www.example.com", Type: "A", NewIP: ip, Result: "updated"})
+	}
+	h.Append(HistoryEntry{Kind: HistoryDetect, NewIP: "192.0.2.3", Result: "ok"})
+
+	entries, err := QueryHistory(path, "WWW.example.com.", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].NewIP != "192.0.2.1" {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	// 按条数清理
+	h.lastPrune = time.Time{}
+	h.Append(HistoryEntry{Kind: HistoryDetect, Result: "failed", Error: "timeout"})
+	if entries, _ = QueryHistory(path, "", time.Time{}); len(entries) != 2 || entries[1].Error != "timeout" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if _, err = os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("临时文件没有删除")
+	}
+
+	if entries, _ = QueryHistory(path, "", now.Add(time.Hour)); len(entries) != 0 {
+		t.Errorf("since 之后不应有记录: %+v", entries)
+	}
+	var disabled *History
+	disabled.Append(old)
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	tests := map[string]time.Time{
+		"":                 {},
+		"24h":              now.Add(-24 * time.Hour),
+		"7d":               now.AddDate(0, 0, -7),
+		"2026-10-01":       time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local),
+		"2026-10-01 08:30": time.Date(2026, 10, 1, 8, 30, 0, 0, time.Local),
+	}
+	for s, want := range tests {
+		got, err := ParseSince(s, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseSince(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseSince("yesterday", now); err == nil {
+		t.Error("yesterday 应返回错误")
+	}
+}
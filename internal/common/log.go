@@ -0,0 +1,74 @@
+package common
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+)
+
+// LogConf level 可选 debug, info, warn, error，为空时为 info
+// format 为空时沿用原来的纯文本格式，text 为 key=value 格式，json 为每行一个 JSON 对象，便于日志采集
+type LogConf struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+// Check 校验日志配置，错误信息由调用方补充配置文件位置
+func (conf LogConf) Check() error {
+	var level slog.Level
+	if conf.Level != "" && level.UnmarshalText([]byte(conf.Level)) != nil {
+		return errors.New("不支持 level " + conf.Level + "，可选 debug, info, warn, error")
+	}
+	switch conf.Format {
+	case "", "text", "json":
+	default:
+		return errors.New("不支持 format " + conf.Format + "，可选 text, json")
+	}
+	return nil
+}
+
+// SetupLog 按配置设置默认日志，log 包的输出也会按 info 级别经过同一处理
+// 属性中不应包含 token 和密钥，需要标识身份时使用备注
+func SetupLog(conf LogConf) (err error) {
+	if err = conf.Check(); err != nil {
+		return
+	}
+	var level slog.Level
+	if conf.Level != "" {
+		_ = level.UnmarshalText([]byte(conf.Level))
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch conf.Format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		slog.SetLogLoggerLevel(level)
+	}
+	return
+}
+
+// RedactURL 去掉地址中的用户信息和查询参数，其中可能带有 token
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(无效地址)"
+	}
+	u.User = nil
+	if u.RawQuery != "" {
+		u.RawQuery = "..."
+	}
+	return u.String()
+}
+
+// RedactError 请求错误中带有完整地址，输出前同样去掉敏感部分
+func RedactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return &url.Error{Op: urlErr.Op, URL: RedactURL(urlErr.URL), Err: urlErr.Err}
+	}
+	return err
+}
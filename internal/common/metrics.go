@@ -0,0 +1,222 @@
+package common
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// LatencyBuckets 请求耗时的默认分桶，单位为秒
+var LatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics 一组指标，按 Prometheus 文本格式输出
+type Metrics struct {
+	mu      sync.Mutex
+	metrics []*Metric
+}
+
+// Metric 同名指标，按标签值区分
+type Metric struct {
+	m       *Metrics
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	// counts 直方图各分桶的计数，不累计
+	counts []uint64
+	count  uint64
+}
+
+// Counter 注册只增不减的计数器
+func (m *Metrics) Counter(name, help string, labels ...string) *Metric {
+	return m.register(name, help, metricCounter, nil, labels)
+}
+
+// Gauge 注册可以任意设置的值
+func (m *Metrics) Gauge(name, help string, labels ...string) *Metric {
+	return m.register(name, help, metricGauge, nil, labels)
+}
+
+// Histogram 注册直方图，buckets 为升序的上界
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *Metric {
+	return m.register(name, help, metricHistogram, buckets, labels)
+}
+
+func (m *Metrics) register(name, help, kind string, buckets []float64, labels []string) *Metric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric := &Metric{m: m, name: name, help: help, kind: kind, labels: labels, buckets: buckets,
+		series: make(map[string]*series)}
+	m.metrics = append(m.metrics, metric)
+	return metric
+}
+
+// get 调用方需持有锁，标签值数量不符时返回 nil
+func (metric *Metric) get(values []string) *series {
+	if len(values) != len(metric.labels) {
+		return nil
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := metric.series[key]
+	if !ok {
+		s = &series{values: slices.Clone(values)}
+		if metric.kind == metricHistogram {
+			s.counts = make([]uint64, len(metric.buckets))
+		}
+		metric.series[key] = s
+	}
+	return s
+}
+
+// Inc 计数加一
+func (metric *Metric) Inc(values ...string) {
+	metric.Add(1, values...)
+}
+
+// Add 计数增加 delta
+func (metric *Metric) Add(delta float64, values ...string) {
+	metric.m.mu.Lock()
+	defer metric.m.mu.Unlock()
+	if s := metric.get(values); s != nil {
+		s.value += delta
+	}
+}
+
+// Set 设置当前值
+func (metric *Metric) Set(value float64, values ...string) {
+	metric.m.mu.Lock()
+	defer metric.m.mu.Unlock()
+	if s := metric.get(values); s != nil {
+		s.value = value
+	}
+}
+
+// Observe 直方图记录一个观测值
+func (metric *Metric) Observe(value float64, values ...string) {
+	metric.m.mu.Lock()
+	defer metric.m.mu.Unlock()
+	s := metric.get(values)
+	if s == nil {
+		return
+	}
+	if i, _ := slices.BinarySearch(metric.buckets, value); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.value += value
+}
+
+// Reset 删除所有标签值，用于只保留当前值的信息类指标
+func (metric *Metric) Reset() {
+	metric.m.mu.Lock()
+	defer metric.m.mu.Unlock()
+	clear(metric.series)
+}
+
+// Bytes 按 Prometheus 文本格式输出，同一指标的标签值按字典序排列
+func (m *Metrics) Bytes() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b bytes.Buffer
+	for _, metric := range m.metrics {
+		b.WriteString("# HELP " + metric.name + " " + escapeHelp(metric.help) + "\n")
+		b.WriteString("# TYPE " + metric.name + " " + metric.kind + "\n")
+
+		keys := make([]string, 0, len(metric.series))
+		for k := range metric.series {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			s := metric.series[k]
+			if metric.kind != metricHistogram {
+				writeSample(&b, metric.name, metric.labels, s.values, "", "", s.value)
+				continue
+			}
+			var cumulative uint64
+			for i, le := range metric.buckets {
+				cumulative += s.counts[i]
+				writeSample(&b, metric.name+"_bucket", metric.labels, s.values, "le", formatFloat(le), float64(cumulative))
+			}
+			writeSample(&b, metric.name+"_bucket", metric.labels, s.values, "le", "+Inf", float64(s.count))
+			writeSample(&b, metric.name+"_sum", metric.labels, s.values, "", "", s.value)
+			writeSample(&b, metric.name+"_count", metric.labels, s.values, "", "", float64(s.count))
+		}
+	}
+	return b.Bytes()
+}
+
+// ServeHTTP 作为 /metrics 的处理函数
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(m.Bytes())
+}
+
+// writeSample extraName 不为空时追加一个标签，用于直方图的 le
+func writeSample(b *bytes.Buffer, name string, labels, values []string, extraName, extraValue string, value float64) {
+	b.WriteString(name)
+	if len(labels) != 0 || extraName != "" {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(labels) != 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
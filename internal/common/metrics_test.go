@@ -0,0 +1,41 @@
+package common
+
+import "testing"
+
+func TestMetrics(t *testing.T) {
+	var m Metrics
+	requests := m.Counter("requests_total", "请求次数", "code")
+	info := m.Gauge("ip_info", "当前 IP\\", "ip")
+	latency := m.Histogram("latency_seconds", "耗时", []float64{0.1, 1})
+
+	requests.Inc("200")
+	requests.Add(2, "200")
+	requests.Inc("403")
+	// 标签值数量不符时忽略
+	requests.Inc()
+	info.Set(1, "old")
+	info.Reset()
+	info.Set(1, "a\"b")
+	latency.Observe(0.1)
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	want := `# HELP requests_total 请求次数
+# TYPE requests_total counter
+requests_total{code="200"} 3
+requests_total{code="403"} 1
+# HELP ip_info 当前 IP\\
+# TYPE ip_info gauge
+ip_info{ip="a\"b"} 1
+# HELP latency_seconds 耗时
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.6
+latency_seconds_count 3
+`
+	if got := string(m.Bytes()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,266 @@
+package common
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 通知的事件
+const (
+	NotifyChanged   = "changed"
+	NotifyFailed    = "failed"
+	NotifyRecovered = "recovered"
+	NotifyFirstRun  = "first_run"
+
+	// NotifyDetect 获取 IP 的结果使用的 provider
+	NotifyDetect = "detect"
+)
+
+const (
+	defaultNotifyFailThreshold = 3
+	defaultNotifyDebounce      = 60 * time.Minute
+	notifyTimeout              = 15 * time.Second
+)
+
+// defaultNotifyEvents events 为空时通知的事件
+var defaultNotifyEvents = []string{NotifyChanged, NotifyFailed, NotifyRecovered}
+
+// NotifyConf events 可选 changed, failed, recovered, first_run，为空时通知除 first_run 以外的事件
+// fail_threshold 为连续失败多少次后通知，为 0 时为 3
+// debounce_minutes 为同一解析记录的同一事件的最短通知间隔，为 0 时为 60，小于 0 时不限制
+type NotifyConf struct {
+	Enable          bool            `json:"enable"`
+	Events          []string        `json:"events"`
+	FailThreshold   int             `json:"fail_threshold"`
+	DebounceMinutes int             `json:"debounce_minutes"`
+	Channels        []NotifyChannel `json:"channels"`
+}
+
+// NotifyResult 一条解析记录的同步结果，provider 为 detect 时表示获取 IP
+// source 不为空时代替 Notifier 的来源，服务端用来区分客户端
+type NotifyResult struct {
+	Source   string
+	Provider string
+	Record   string
+	Type     string
+	OldIP    string
+	NewIP    string
+	Changed  bool
+	Err      error
+}
+
+// NotifyEvent 发送的通知，同时作为 webhook 模板的数据
+type NotifyEvent struct {
+	Kind     string    `json:"kind"`
+	Source   string    `json:"source"`
+	Provider string    `json:"provider"`
+	Record   string    `json:"record"`
+	Type     string    `json:"type"`
+	OldIP    string    `json:"old_ip"`
+	NewIP    string    `json:"new_ip"`
+	Error    string    `json:"error"`
+	Failures int       `json:"failures"`
+	Time     time.Time `json:"time"`
+	Title    string    `json:"title"`
+	Text     string    `json:"text"`
+}
+
+// Notifier 根据同步结果判断需要通知的事件，并发往各通知渠道
+// 为 nil 时不做任何事，未启用通知时可以直接使用 nil
+type Notifier struct {
+	conf   NotifyConf
+	source string
+
+	mu       sync.Mutex
+	seen     map[string]bool
+	failures map[string]int
+	lastSent map[string]time.Time
+}
+
+// Check 校验通知配置，错误信息由调用方补充配置文件位置
+func (conf NotifyConf) Check() error {
+	if !conf.Enable {
+		return nil
+	}
+	if err := checkNotifyEvents(conf.Events); err != nil {
+		return err
+	}
+	if len(conf.Channels) == 0 {
+		return errors.New("channels 不能为空")
+	}
+	for i, ch := range conf.Channels {
+		if err := ch.check(); err != nil {
+			return errors.New("channels 第 " + strconv.Itoa(i+1) + " 项 " + err.Error())
+		}
+	}
+	return nil
+}
+
+func checkNotifyEvents(events []string) error {
+	for _, ev := range events {
+		switch ev {
+		case NotifyChanged, NotifyFailed, NotifyRecovered, NotifyFirstRun:
+		default:
+			return errors.New("events 不支持 " + ev + "，可选 changed, failed, recovered, first_run")
+		}
+	}
+	return nil
+}
+
+// NewNotifier source 为通知中的来源，未启用通知时返回 nil
+func NewNotifier(conf NotifyConf, source string) *Notifier {
+	if !conf.Enable {
+		return nil
+	}
+	if conf.FailThreshold <= 0 {
+		conf.FailThreshold = defaultNotifyFailThreshold
+	}
+	return &Notifier{
+		conf:     conf,
+		source:   source,
+		seen:     make(map[string]bool),
+		failures: make(map[string]int),
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+// Observe 记录一次同步结果，需要通知时在后台发送，不阻塞调用方
+func (n *Notifier) Observe(r NotifyResult) {
+	if n == nil {
+		return
+	}
+	for _, ev := range n.events(r, time.Now()) {
+		for _, ch := range n.conf.Channels {
+			if !ch.wants(ev.Kind, n.conf.Events) {
+				continue
+			}
+			go func() {
+				if err := sendNotify(ch, ev); err != nil {
+					slog.Warn("发送通知失败", "channel", ch.Type, "kind", ev.Kind, "record", ev.Record,
+						"error", err)
+				}
+			}()
+		}
+	}
+}
+
+// events 按同步结果更新状态，返回需要通知的事件
+// 连续失败达到 fail_threshold 次时通知失败，此后成功一次通知恢复
+func (n *Notifier) events(r NotifyResult, now time.Time) (events []NotifyEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	source := n.source
+	if r.Source != "" {
+		source = r.Source
+	}
+	key := source + "|" + r.Provider + "|" + r.Record + "|" + r.Type
+	ev := NotifyEvent{
+		Source:   source,
+		Provider: r.Provider,
+		Record:   r.Record,
+		Type:     r.Type,
+		OldIP:    r.OldIP,
+		NewIP:    r.NewIP,
+		Time:     now,
+	}
+
+	if r.Err != nil {
+		n.failures[key]++
+		if n.failures[key] >= n.conf.FailThreshold && n.allow(key+"|"+NotifyFailed, now) {
+			ev.Kind = NotifyFailed
+			ev.Error = r.Err.Error()
+			ev.Failures = n.failures[key]
+			events = append(events, ev.format())
+		}
+		return
+	}
+
+	if n.failures[key] >= n.conf.FailThreshold {
+		ev.Kind = NotifyRecovered
+		ev.Failures = n.failures[key]
+		events = append(events, ev.format())
+		// 恢复后重新失败时应立即通知
+		delete(n.lastSent, key+"|"+NotifyFailed)
+	}
+	delete(n.failures, key)
+
+	first := !n.seen[key]
+	n.seen[key] = true
+	switch {
+	case first && n.wanted(NotifyFirstRun):
+		ev.Kind = NotifyFirstRun
+		events = append(events, ev.format())
+	case r.Changed && n.allow(key+"|"+NotifyChanged+"|"+r.NewIP, now):
+		// 在两个地址之间来回变化时按新地址分别限制
+		ev.Kind = NotifyChanged
+		events = append(events, ev.format())
+	}
+	return
+}
+
+// wanted 是否有渠道需要这种事件
+func (n *Notifier) wanted(kind string) bool {
+	for _, ch := range n.conf.Channels {
+		if ch.wants(kind, n.conf.Events) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow 调用方需持有锁，距离上次同样的通知超过 debounce_minutes 时记录本次并返回 true
+func (n *Notifier) allow(key string, now time.Time) bool {
+	debounce := defaultNotifyDebounce
+	if n.conf.DebounceMinutes != 0 {
+		debounce = time.Duration(n.conf.DebounceMinutes) * time.Minute
+	}
+	if last, ok := n.lastSent[key]; ok && debounce > 0 && now.Sub(last) < debounce {
+		return false
+	}
+	n.lastSent[key] = now
+	return true
+}
+
+// format 生成标题和正文
+func (ev NotifyEvent) format() NotifyEvent {
+	name := strings.TrimSpace(ev.Record + " " + ev.Type)
+	if ev.Provider == NotifyDetect {
+		name = "获取 IP"
+	}
+	var title string
+	switch ev.Kind {
+	case NotifyChanged:
+		title = "IP 已变化"
+		ev.Text = name + " 已由 " + orNone(ev.OldIP) + " 更新为 " + orNone(ev.NewIP)
+	case NotifyFailed:
+		title = "同步失败"
+		ev.Text = name + " 连续 " + strconv.Itoa(ev.Failures) + " 次失败: " + ev.Error
+	case NotifyRecovered:
+		title = "已恢复"
+		ev.Text = name + " 在连续 " + strconv.Itoa(ev.Failures) + " 次失败后恢复，当前为 " + orNone(ev.NewIP)
+	case NotifyFirstRun:
+		title = "开始运行"
+		ev.Text = name + " 当前为 " + orNone(ev.NewIP)
+	}
+	ev.Title = "ddns-watchdog " + title
+	if ev.Source != "" {
+		ev.Title += " (" + ev.Source + ")"
+	}
+	if ev.Provider != "" && ev.Provider != NotifyDetect {
+		ev.Text += "\n服务商: " + ev.Provider
+	}
+	ev.Text += "\n时间: " + ev.Time.Format(time.DateTime)
+	return ev
+}
+
+func orNone(ip string) string {
+	if ip == "" {
+		return "(无)"
+	}
+	return ip
+}
@@ -0,0 +1,336 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 通知渠道
+const (
+	channelWebhook    = "webhook"
+	channelSMTP       = "smtp"
+	channelTelegram   = "telegram"
+	channelNtfy       = "ntfy"
+	channelGotify     = "gotify"
+	channelBark       = "bark"
+	channelServerChan = "serverchan"
+	channelDingTalk   = "dingtalk"
+	channelFeishu     = "feishu"
+	channelWeCom      = "wecom"
+)
+
+const (
+	defaultTelegramUrl   = "https://api.telegram.org"
+	defaultBarkUrl       = "https://api.day.app"
+	defaultServerChanUrl = "https://sctapi.ftqq.com"
+)
+
+// defaultWebhookBody webhook 未填写 body 时发送的内容
+const defaultWebhookBody = `{"kind":{{json .Kind}},"source":{{json .Source}},"provider":{{json .Provider}},` +
+	`"record":{{json .Record}},"type":{{json .Type}},"old_ip":{{json .OldIP}},"new_ip":{{json .NewIP}},` +
+	`"error":{{json .Error}},"title":{{json .Title}},"text":{{json .Text}}}`
+
+// NotifyChannel 通知渠道，按 type 使用不同的字段
+//
+//	webhook: url，body 为 text/template 模板，可用 {{json .Record}} 输出 JSON 字符串，headers 为额外的请求头
+//	smtp: host, port (465 使用 TLS，其他端口在服务器支持时使用 STARTTLS), username, password, from, to
+//	telegram: token 为 bot token，chat_id，url 为空时为 https://api.telegram.org
+//	ntfy: url 为 topic 地址 (如 https://ntfy.sh/mytopic)，token 为访问令牌 (可选)
+//	gotify: url 为服务地址，token 为应用 token
+//	bark: token 为 device key，url 为空时为 https://api.day.app
+//	serverchan: token 为 SendKey
+//	dingtalk, feishu: url 为机器人 webhook 地址，secret 为加签密钥 (可选)
+//	wecom: url 为机器人 webhook 地址
+type NotifyChannel struct {
+	Type     string            `json:"type"`
+	Events   []string          `json:"events"`
+	URL      string            `json:"url"`
+	Body     string            `json:"body"`
+	Headers  map[string]string `json:"headers"`
+	Token    string            `json:"token"`
+	Secret   string            `json:"secret"`
+	ChatID   string            `json:"chat_id"`
+	Host     string            `json:"host"`
+	Port     int               `json:"port"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	From     string            `json:"from"`
+	To       []string          `json:"to"`
+}
+
+var notifyFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func (ch NotifyChannel) check() error {
+	if err := checkNotifyEvents(ch.Events); err != nil {
+		return err
+	}
+	var required map[string]string
+	switch ch.Type {
+	case channelWebhook:
+		if _, err := ch.template(); err != nil {
+			return errors.New("body 不是有效的模板: " + err.Error())
+		}
+		required = map[string]string{"url": ch.URL}
+	case channelSMTP:
+		if ch.Port <= 0 || ch.Port > 65535 || len(ch.To) == 0 {
+			return errors.New("需要填写 port 和 to")
+		}
+		required = map[string]string{"host": ch.Host, "from": ch.From}
+	case channelTelegram:
+		required = map[string]string{"token": ch.Token, "chat_id": ch.ChatID}
+	case channelNtfy, channelDingTalk, channelFeishu, channelWeCom:
+		required = map[string]string{"url": ch.URL}
+	case channelGotify:
+		required = map[string]string{"url": ch.URL, "token": ch.Token}
+	case channelBark, channelServerChan:
+		required = map[string]string{"token": ch.Token}
+	default:
+		return errors.New("不支持 type " + ch.Type + "，可选 webhook, smtp, telegram, ntfy, gotify, bark, serverchan, dingtalk, feishu, wecom")
+	}
+	for name, v := range required {
+		if v == "" {
+			return errors.New("需要填写 " + name)
+		}
+	}
+	if ch.URL != "" {
+		if u, err := url.Parse(ch.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("url 不是有效的 http(s) 地址")
+		}
+	}
+	return nil
+}
+
+// wants 渠道自己的 events 优先于全局的 events
+func (ch NotifyChannel) wants(kind string, events []string) bool {
+	switch {
+	case len(ch.Events) != 0:
+		events = ch.Events
+	case len(events) == 0:
+		events = defaultNotifyEvents
+	}
+	return slices.Contains(events, kind)
+}
+
+func (ch NotifyChannel) template() (*template.Template, error) {
+	body := ch.Body
+	if body == "" {
+		body = defaultWebhookBody
+	}
+	return template.New("body").Funcs(notifyFuncs).Parse(body)
+}
+
+// sendNotify 按渠道类型发送，请求错误中的地址可能带有 token，不返回地址
+func sendNotify(ch NotifyChannel, ev NotifyEvent) (err error) {
+	switch ch.Type {
+	case channelWebhook:
+		t, err := ch.template()
+		if err != nil {
+			return err
+		}
+		var body bytes.Buffer
+		if err = t.Execute(&body, ev); err != nil {
+			return err
+		}
+		return postNotify(ch.URL, "application/json", body.Bytes(), ch.Headers)
+	case channelSMTP:
+		return sendMail(ch, ev)
+	case channelTelegram:
+		return postNotifyJSON(orDefault(ch.URL, defaultTelegramUrl)+"/bot"+ch.Token+"/sendMessage",
+			map[string]any{"chat_id": ch.ChatID, "text": ev.Title + "\n" + ev.Text}, nil)
+	case channelNtfy:
+		headers := map[string]string{"Title": ev.Title, "Tags": ev.Kind}
+		if ch.Token != "" {
+			headers["Authorization"] = "Bearer " + ch.Token
+		}
+		return postNotify(ch.URL, "text/plain; charset=utf-8", []byte(ev.Text), headers)
+	case channelGotify:
+		return postNotifyJSON(strings.TrimSuffix(ch.URL, "/")+"/message",
+			map[string]any{"title": ev.Title, "message": ev.Text, "priority": 5},
+			map[string]string{"X-Gotify-Key": ch.Token})
+	case channelBark:
+		return postNotifyJSON(orDefault(ch.URL, defaultBarkUrl)+"/push",
+			map[string]any{"device_key": ch.Token, "title": ev.Title, "body": ev.Text, "group": "ddns-watchdog"}, nil)
+	case channelServerChan:
+		form := url.Values{"title": {ev.Title}, "desp": {ev.Text}}
+		return postNotify(orDefault(ch.URL, defaultServerChanUrl)+"/"+ch.Token+".send",
+			"application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+	case channelDingTalk:
+		u := ch.URL
+		if ch.Secret != "" {
+			ts := strconv.FormatInt(ev.Time.UnixMilli(), 10)
+			u += "&timestamp=" + ts + "&sign=" + url.QueryEscape(hmacBase64(ch.Secret, ts+"\n"+ch.Secret))
+		}
+		return postNotifyJSON(u, map[string]any{"msgtype": "text",
+			"text": map[string]string{"content": ev.Title + "\n" + ev.Text}}, nil)
+	case channelFeishu:
+		body := map[string]any{"msg_type": "text", "content": map[string]string{"text": ev.Title + "\n" + ev.Text}}
+		if ch.Secret != "" {
+			// 飞书的签名以 timestamp + "\n" + secret 为密钥，对空字符串签名
+			ts := strconv.FormatInt(ev.Time.Unix(), 10)
+			body["timestamp"] = ts
+			body["sign"] = hmacBase64(ts+"\n"+ch.Secret, "")
+		}
+		return postNotifyJSON(ch.URL, body, nil)
+	case channelWeCom:
+		return postNotifyJSON(ch.URL, map[string]any{"msgtype": "text",
+			"text": map[string]string{"content": ev.Title + "\n" + ev.Text}}, nil)
+	}
+	return errors.New("不支持 type " + ch.Type)
+}
+
+func orDefault(u, def string) string {
+	if u == "" {
+		return def
+	}
+	return strings.TrimSuffix(u, "/")
+}
+
+func hmacBase64(key, msg string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(msg))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func postNotifyJSON(u string, body any, headers map[string]string) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return postNotify(u, "application/json", b, headers)
+}
+
+// postNotify 状态码不是 2xx，或者响应中的 errcode, code 不为 0，ok 为 false 时返回错误
+func postNotify(u, contentType string, body []byte, headers map[string]string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("无效的地址")
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := DefaultHttpClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return errors.New("状态码 " + strconv.Itoa(resp.StatusCode) + " " + string(respBody))
+	}
+
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		Code    *int   `json:"code"`
+		OK      *bool  `json:"ok"`
+		ErrMsg  string `json:"errmsg"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(respBody, &result) != nil {
+		return nil
+	}
+	switch {
+	case result.ErrCode != nil && *result.ErrCode != 0:
+		return errors.New("errcode " + strconv.Itoa(*result.ErrCode) + " " + result.ErrMsg)
+	case result.Code != nil && *result.Code != 0:
+		return errors.New("code " + strconv.Itoa(*result.Code) + " " + result.Msg)
+	case result.OK != nil && !*result.OK:
+		return errors.New(string(respBody))
+	}
+	return nil
+}
+
+// sendMail 465 端口使用 TLS 连接，其他端口在服务器支持时使用 STARTTLS
+func sendMail(ch NotifyChannel, ev NotifyEvent) (err error) {
+	addr := net.JoinHostPort(ch.Host, strconv.Itoa(ch.Port))
+	var auth smtp.Auth
+	if ch.Username != "" {
+		auth = smtp.PlainAuth("", ch.Username, ch.Password, ch.Host)
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + ch.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(ch.To, ", ") + "\r\n")
+	msg.WriteString("Subject: =?UTF-8?B?" + base64.StdEncoding.EncodeToString([]byte(ev.Title)) + "?=\r\n")
+	msg.WriteString("Date: " + ev.Time.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	msg.WriteString(base64.StdEncoding.EncodeToString([]byte(ev.Text)) + "\r\n")
+
+	netDialer := &net.Dialer{Timeout: notifyTimeout}
+	tlsConf := &tls.Config{ServerName: ch.Host, MinVersion: tls.VersionTLS12}
+	var conn net.Conn
+	if ch.Port == 465 {
+		conn, err = (&tls.Dialer{NetDialer: netDialer, Config: tlsConf}).Dial("tcp", addr)
+	} else {
+		conn, err = netDialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Now().Add(notifyTimeout))
+	c, err := smtp.NewClient(conn, ch.Host)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && ch.Port != 465 {
+		if err = c.StartTLS(tlsConf); err != nil {
+			return
+		}
+	}
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return
+		}
+	}
+	if err = c.Mail(ch.From); err != nil {
+		return
+	}
+	for _, to := range ch.To {
+		if err = c.Rcpt(to); err != nil {
+			return
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return
+	}
+	if _, err = w.Write(msg.Bytes()); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	return c.Quit()
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifierEvents(t *testing.T) {
+	n := NewNotifier(NotifyConf{
+		Enable:        true,
+		FailThreshold: 2,
+		Channels:      []NotifyChannel{{Type: channelWebhook, URL: "http://127.0.0.1"}},
+	}, "test")
+	now := time.Now()
+	kinds := func(r NotifyResult, after time.Duration) (kinds []string) {
+		for _, ev := range n.events(r, now.Add(after)) {
+			kinds = append(kinds, ev.Kind)
+		}
+		return
+	}
+	ok := NotifyResult{Provider: DNSPod, Record: "www.example.com", Type: "A", NewIP: "192.0.2.1"}
+	fail := ok
+	fail.Err = errors.New("timeout")
+	changed := ok
+	changed.OldIP, changed.NewIP, changed.Changed = "192.0.2.1", "192.0.2.2", true
+
+	steps := []struct {
+		name  string
+		r     NotifyResult
+		after time.Duration
+		want  []string
+	}{
+		// 默认不通知 first_run
+		{"first run", ok, 0, nil},
+		{"changed", changed, 0, []string{NotifyChanged}},
+		{"changed debounced", changed, time.Minute, nil},
+		{"below threshold", fail, time.Minute, nil},
+		{"failed", fail, time.Minute, []string{NotifyFailed}},
+		{"failed debounced", fail, 2 * time.Minute, nil},
+		{"failed after debounce", fail, 2 * time.Hour, []string{NotifyFailed}},
+		{"recovered", ok, 2 * time.Hour, []string{NotifyRecovered}},
+		{"changed after debounce", changed, 3 * time.Hour, []string{NotifyChanged}},
+	}
+	for _, step := range steps {
+		got := kinds(step.r, step.after)
+		if len(got) != len(step.want) || (len(got) != 0 && got[0] != step.want[0]) {
+			t.Errorf("%s: events = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	var nilNotifier *Notifier
+	nilNotifier.Observe(ok)
+	if NewNotifier(NotifyConf{}, "test") != nil {
+		t.Error("未启用时应返回 nil")
+	}
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	bodies := make(chan map[string]string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var body map[string]string
+		_ = json.Unmarshal(b, &body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	ch := NotifyChannel{Type: channelWebhook, URL: srv.URL, Body: `{"text":{{json .Text}},"ip":{{json .NewIP}}}`}
+	if err := ch.check(); err != nil {
+		t.Fatal(err)
+	}
+	ev := NotifyEvent{Kind: NotifyChanged, Record: "a.example.com", Type: "A", NewIP: "192.0.2.1", Time: time.Now()}.format()
+	if err := sendNotify(ch, ev); err != nil {
+		t.Fatal(err)
+	}
+	body := <-bodies
+	if body["ip"] != "192.0.2.1" || body["text"] != ev.Text {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestNotifyConfCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    NotifyConf
+		wantErr bool
+	}{
+		{"disabled", NotifyConf{Channels: []NotifyChannel{{Type: "unknown"}}}, false},
+		{"no channels", NotifyConf{Enable: true}, true},
+		{"unknown event", NotifyConf{Enable: true, Events: []string{"ip"},
+			Channels: []NotifyChannel{{Type: channelBark, Token: "key"}}}, true},
+		{"unknown type", NotifyConf{Enable: true, Channels: []NotifyChannel{{Type: "pager"}}}, true},
+		{"missing chat_id", NotifyConf{Enable: true, Channels: []NotifyChannel{{Type: channelTelegram, Token: "t"}}}, true},
+		{"bad template", NotifyConf{Enable: true,
+			Channels: []NotifyChannel{{Type: channelWebhook, URL: "https://example.com", Body: "{{"}}}, true},
+		{"bad url", NotifyConf{Enable: true, Channels: []NotifyChannel{{Type: channelWeCom, URL: "example.com"}}}, true},
+		{"smtp", NotifyConf{Enable: true, Channels: []NotifyChannel{{Type: channelSMTP, Host: "smtp.example.com",
+			Port: 465, From: "a@example.com", To: []string{"b@example.com"}}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.conf.Check(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
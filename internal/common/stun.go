@@ -0,0 +1,52 @@
+package common
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+// STUN (RFC 5389) 客户端和服务端共用的常量
+const (
+	STUNBindingRequest   uint16 = 0x0001
+	STUNBindingSuccess   uint16 = 0x0101
+	STUNBindingError     uint16 = 0x0111
+	STUNMappedAddress    uint16 = 0x0001
+	STUNErrorCode        uint16 = 0x0009
+	STUNXorMappedAddress uint16 = 0x0020
+	STUNMagicCookie      uint32 = 0x2112a442
+	STUNHeaderLen               = 20
+)
+
+// IsSTUNBindingRequest 判断数据报是否为 Binding 请求
+func IsSTUNBindingRequest(msg []byte) bool {
+	return len(msg) >= STUNHeaderLen &&
+		binary.BigEndian.Uint16(msg[0:]) == STUNBindingRequest &&
+		binary.BigEndian.Uint32(msg[4:]) == STUNMagicCookie
+}
+
+// STUNBindingResponse 构造带 XOR-MAPPED-ADDRESS 的 Binding 成功响应
+func STUNBindingResponse(txId []byte, addr netip.AddrPort) []byte {
+	ip := addr.Addr().Unmap()
+	family := byte(0x01)
+	if ip.Is6() {
+		family = 0x02
+	}
+
+	msg := make([]byte, STUNHeaderLen, STUNHeaderLen+24)
+	binary.BigEndian.PutUint16(msg[0:], STUNBindingSuccess)
+	binary.BigEndian.PutUint32(msg[4:], STUNMagicCookie)
+	copy(msg[8:], txId)
+
+	// 端口和地址与魔数及事务 ID 异或
+	value := []byte{0, family}
+	value = binary.BigEndian.AppendUint16(value, addr.Port()^uint16(STUNMagicCookie>>16))
+	for i, b := range ip.AsSlice() {
+		value = append(value, b^msg[4+i])
+	}
+
+	msg = binary.BigEndian.AppendUint16(msg, STUNXorMappedAddress)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(value)))
+	msg = append(msg, value...)
+	binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)-STUNHeaderLen))
+	return msg
+}
@@ -0,0 +1,318 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	flag "github.com/spf13/pflag"
+)
+
+// placeholderMarks 初始化配置文件时写入的说明文字中的片段
+var placeholderMarks = []string{"获取", "记录子域名", "区域 ID"}
+
+// ConfIssue 校验配置发现的一个问题，field 为 JSON 中的字段路径，如 sub_domain.a
+type ConfIssue struct {
+	File    string `json:"file"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ConfReport 逐个配置文件收集校验发现的问题
+// 先调用 File 指定之后的问题所属的配置文件
+type ConfReport struct {
+	Files  []string    `json:"files"`
+	Issues []ConfIssue `json:"issues"`
+	file   string
+}
+
+// File 开始校验一个配置文件
+func (r *ConfReport) File(name string) {
+	r.file = name
+	r.Files = append(r.Files, name)
+}
+
+// Add 记录一个问题，field 为空表示整个配置文件
+func (r *ConfReport) Add(field, msg string) {
+	r.Issues = append(r.Issues, ConfIssue{File: r.file, Field: field, Message: msg})
+}
+
+// AddError err 不为空时记录一个问题
+func (r *ConfReport) AddError(field string, err error) {
+	if err != nil {
+		r.Add(field, err.Error())
+	}
+}
+
+// OK 是否没有发现问题
+func (r *ConfReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// FileOK 该配置文件是否没有发现问题
+func (r *ConfReport) FileOK(file string) bool {
+	return !slices.ContainsFunc(r.Issues, func(is ConfIssue) bool {
+		return is.File == file
+	})
+}
+
+// Placeholders 检查 v 转为 JSON 后的全部字符串，记录仍是初始化时占位内容的字段，field 为 v 所在的字段
+func (r *ConfReport) Placeholders(field string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	var generic any
+	if json.Unmarshal(b, &generic) != nil {
+		return
+	}
+	r.placeholders(field, generic)
+}
+
+func (r *ConfReport) placeholders(path string, v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			r.placeholders(joinField(path, k), v[k])
+		}
+	case []any:
+		for i, child := range v {
+			r.placeholders(path+"["+strconv.Itoa(i)+"]", child)
+		}
+	case string:
+		if IsPlaceholder(v) {
+			r.Add(path, "仍是初始化时的占位内容 "+strconv.Quote(v))
+		}
+	}
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// URL value 不为空时需要是 http 或 https 地址
+func (r *ConfReport) URL(field, value string) {
+	if value != "" {
+		r.AddError(field, CheckURL(value))
+	}
+}
+
+// IP value 不为空时需要是 IP 地址
+func (r *ConfReport) IP(field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := netip.ParseAddr(value); err != nil {
+		r.Add(field, value+" 不是有效的 IP 地址")
+	}
+}
+
+// HostPort value 不为空时需要是 "127.0.0.1:9000" 或 ":9000" 这样的监听地址
+func (r *ConfReport) HostPort(field, value string) {
+	if value == "" {
+		return
+	}
+	_, port, err := net.SplitHostPort(value)
+	if err == nil {
+		_, err = net.LookupPort("tcp", port)
+	}
+	if err != nil {
+		r.Add(field, value+" 不是有效的地址，例如 127.0.0.1:9000 或 :9000")
+	}
+}
+
+// Server value 不为空时需要是 "stun.example.com:3478" 这样的服务器地址，portOptional 时可以省略端口
+func (r *ConfReport) Server(field, value string, portOptional bool) {
+	if value == "" {
+		return
+	}
+	host, port, err := net.SplitHostPort(value)
+	if err != nil && portOptional {
+		// 没有端口时 IPv6 地址可以不加方括号
+		host, port, err = strings.Trim(value, "[]"), "", nil
+	}
+	if err == nil && port != "" {
+		_, err = net.LookupPort("tcp", port)
+	}
+	if err == nil && host == "" {
+		err = errors.New("没有主机名")
+	}
+	if _, ipErr := netip.ParseAddr(host); err == nil && ipErr != nil {
+		err = checkLabels(host, host)
+	}
+	if err != nil {
+		r.Add(field, value+" 不是有效的服务器地址，例如 192.0.2.1:53 或 stun.example.com:3478")
+	}
+}
+
+// CheckURL 需要是带有主机的 http 或 https 地址
+func CheckURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return errors.New(RedactURL(s) + " 不是有效的地址")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New(RedactURL(s) + " 需要以 http:// 或 https:// 开头")
+	}
+	if u.Host == "" {
+		return errors.New(RedactURL(s) + " 没有主机名")
+	}
+	return nil
+}
+
+// EndpointURL 服务商 SDK 的 endpoint 可以省略 https://，校验前补上
+func EndpointURL(endpoint string) string {
+	if endpoint != "" && !strings.Contains(endpoint, "://") {
+		return "https://" + endpoint
+	}
+	return endpoint
+}
+
+// IsPlaceholder 是否为初始化配置文件时写入的说明文字，或 example.com 这样的示例域名
+func IsPlaceholder(s string) bool {
+	for _, mark := range placeholderMarks {
+		if strings.Contains(s, mark) {
+			return true
+		}
+	}
+	name := strings.ToLower(strings.TrimSuffix(s, "."))
+	for _, example := range []string{"example.com", "example.net", "example.org"} {
+		if name == example || strings.HasSuffix(name, "."+example) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDomain 检查完整域名，如 example.com 或 www.example.com，trailingDot 为 true 时需要以 "." 结尾
+// 第一级可以是通配符 "*"，允许中文等非 ASCII 字符
+func CheckDomain(name string, trailingDot bool) error {
+	if name == "" {
+		return errors.New("不能为空")
+	}
+	trimmed, dotted := strings.CutSuffix(name, ".")
+	switch {
+	case trailingDot && !dotted:
+		return errors.New(name + " 需要以 \".\" 结尾，如 www.example.com.")
+	case !trailingDot && dotted:
+		return errors.New(name + " 不能以 \".\" 结尾")
+	}
+	if !strings.Contains(trimmed, ".") {
+		return errors.New(name + " 不是完整域名，如 www.example.com")
+	}
+	return checkLabels(name, trimmed)
+}
+
+// CheckInZone 检查以 "." 结尾的完整域名 name 是否在 zone 内
+func CheckInZone(name, zone string) error {
+	if strings.EqualFold(name, zone) || strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(zone)) {
+		return nil
+	}
+	return errors.New(name + " 不在 " + zone + " 内")
+}
+
+// CheckSubdomain 检查相对于 domain 的主机记录，如 www、@、*、*.home，不能带有 domain
+func CheckSubdomain(sub, domain string) error {
+	if sub == "@" {
+		return nil
+	}
+	if strings.HasSuffix(sub, ".") {
+		return errors.New(sub + " 是主机记录，不能以 \".\" 结尾")
+	}
+	if domain != "" && (strings.EqualFold(sub, domain) || strings.HasSuffix(strings.ToLower(sub), "."+strings.ToLower(domain))) {
+		return errors.New(sub + " 是主机记录，不需要带上域名 " + domain + "，例如 www")
+	}
+	return checkLabels(sub, sub)
+}
+
+// checkLabels 按 "." 分隔检查每一级的长度和字符，name 用于错误信息
+func checkLabels(name, s string) error {
+	if len(s) > 253 {
+		return errors.New(name + " 超过 253 个字符")
+	}
+	for i, label := range strings.Split(s, ".") {
+		switch {
+		case label == "":
+			return errors.New(name + " 有空的一级")
+		case label == "*" && i == 0:
+			continue
+		case len(label) > 63:
+			return errors.New(name + " 的 " + label + " 超过 63 个字符")
+		case strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-"):
+			return errors.New(name + " 的 " + label + " 不能以 \"-\" 开头或结尾")
+		}
+		for _, c := range label {
+			if c != '-' && c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				return errors.New(name + " 含有不允许的字符 " + strconv.QuoteRune(c))
+			}
+		}
+	}
+	return nil
+}
+
+// PrintConfReport 按配置文件输出校验结果
+func PrintConfReport(w io.Writer, r *ConfReport) {
+	for _, file := range r.Files {
+		var issues []ConfIssue
+		for _, is := range r.Issues {
+			if is.File == file {
+				issues = append(issues, is)
+			}
+		}
+		if len(issues) == 0 {
+			fmt.Fprintln(w, file+": 通过")
+			continue
+		}
+		fmt.Fprintln(w, file+":")
+		for _, is := range issues {
+			if is.Field == "" {
+				fmt.Fprintln(w, "  "+is.Message)
+			} else {
+				fmt.Fprintln(w, "  "+is.Field+": "+is.Message)
+			}
+		}
+	}
+}
+
+// ValidateCommand 处理 validate 子命令，validate 按配置文件目录校验全部配置，online 时测试服务商的密钥
+// 发现问题时返回错误
+func ValidateCommand(args []string, validate func(confDir string, online bool) *ConfReport) (err error) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	confDir := fs.StringP("conf", "c", "", "指定配置文件目录 (目录有空格请放在双引号中间)")
+	online := fs.Bool("online", false, "用配置中的密钥查询解析记录，确认密钥和域名可用 (只读取，不修改)")
+	asJSON := fs.Bool("json", false, "以 JSON 输出校验结果")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	r := validate(*confDir, *online)
+	if *asJSON {
+		if r.Issues == nil {
+			r.Issues = []ConfIssue{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(r); err != nil {
+			return
+		}
+	} else {
+		PrintConfReport(os.Stdout, r)
+	}
+	if !r.OK() {
+		return errors.New("配置校验发现 " + strconv.Itoa(len(r.Issues)) + " 个问题")
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package common
+
+import "testing"
+
+func TestCheckDomain(t *testing.T) {
+	tests := []struct {
+		name        string
+		trailingDot bool
+		ok          bool
+	}{
+		{"www.example.cn", false, true},
+		{"*.home.example.cn", false, true},
+		{"中文.example.cn", false, true},
+		{"www.example.cn.", false, false},
+		{"www.example.cn.", true, true},
+		{"www.example.cn", true, false},
+		{"localhost", false, false},
+		{"www..example.cn", false, false},
+		{"-www.example.cn", false, false},
+		{"www example.cn", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckDomain(tt.name, tt.trailingDot); (err == nil) != tt.ok {
+				t.Errorf("CheckDomain(%q, %v) = %v", tt.name, tt.trailingDot, err)
+			}
+		})
+	}
+}
+
+func TestCheckSubdomain(t *testing.T) {
+	tests := []struct {
+		sub string
+		ok  bool
+	}{
+		{"www", true},
+		{"@", true},
+		{"*", true},
+		{"*.home", true},
+		{"nas.home", true},
+		{"www.example.cn", false},
+		{"example.cn", false},
+		{"www.", false},
+		{"A记录 子域名", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sub, func(t *testing.T) {
+			if err := CheckSubdomain(tt.sub, "example.cn"); (err == nil) != tt.ok {
+				t.Errorf("CheckSubdomain(%q) = %v", tt.sub, err)
+			}
+		})
+	}
+}
+
+func TestConfReport(t *testing.T) {
+	r := &ConfReport{}
+	r.File("dnspod.json")
+	r.Placeholders("", map[string]any{
+		"token":      "在 https://console.dnspod.cn/account/token/token 获取",
+		"domain":     "example.com",
+		"sub_domain": map[string]string{"a": "A记录子域名", "aaaa": ""},
+	})
+	r.File("client.json")
+	r.URL("api_url.ipv4", "yzyweb.cn/ddns-watchdog")
+	r.HostPort("metrics_addr", "127.0.0.1:9777")
+	r.Server("verify.resolvers[0]", "2001:db8::53", true)
+	r.Server("stun.servers[0]", "stun.cloudflare.com", false)
+
+	want := []ConfIssue{
+		{"dnspod.json", "domain", ""},
+		{"dnspod.json", "sub_domain.a", ""},
+		{"dnspod.json", "token", ""},
+		{"client.json", "api_url.ipv4", ""},
+		{"client.json", "stun.servers[0]", ""},
+	}
+	if len(r.Issues) != len(want) {
+		t.Fatalf("Issues = %+v", r.Issues)
+	}
+	for i, is := range r.Issues {
+		if is.File != want[i].File || is.Field != want[i].Field {
+			t.Errorf("Issues[%d] = %+v, want %s %s", i, is, want[i].File, want[i].Field)
+		}
+	}
+	if r.FileOK("client.json") || r.OK() {
+		t.Error("client.json 有问题时 FileOK 和 OK 应为 false")
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"os"
+	"time"
+)
+
+// ConfWatchInterval 检查配置文件是否变化的间隔
+const ConfWatchInterval = 2 * time.Second
+
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, modTime: info.ModTime(), size: info.Size()}
+}
+
+// WatchFiles 定期比较文件的修改时间和大小，任一文件变化 (包括新建和删除) 时发出通知
+// 来不及处理的通知会合并
+func WatchFiles(paths []string, interval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	stamps := make([]fileStamp, len(paths))
+	for i, path := range paths {
+		stamps[i] = statFile(path)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			diff := false
+			for i, path := range paths {
+				if s := statFile(path); s != stamps[i] {
+					stamps[i], diff = s, true
+				}
+			}
+			if !diff {
+				continue
+			}
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changed
+}
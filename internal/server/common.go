@@ -3,8 +3,11 @@ package server
 import (
 	"ddns-watchdog/internal/client"
 	"ddns-watchdog/internal/common"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 )
 
 const (
@@ -14,6 +17,9 @@ const (
 
 var whitelist map[string]whitelistStruct
 
+// providers 按当前的 services.json 缓存构造好的客户端，重新加载时整体替换
+var providers = &providerCache{}
+
 type domainRecord struct {
 	Domain    string           `json:"domain"`
 	Subdomain common.Subdomain `json:"subdomain"`
@@ -26,92 +32,197 @@ type whitelistStruct struct {
 	DomainRecord domainRecord `json:"domain_record"`
 }
 
-func doVirtualClient(body common.CenterReq, instance whitelistStruct) (httpStatus int, respBody common.GeneralResp, err error) {
-	httpStatus = http.StatusOK
-	var (
-		msg  []string
-		errs []error
-	)
+// providerCache 同一份 services.json 下每条白名单记录只构造一次客户端，以便复用 SDK 客户端和连接
+type providerCache struct {
+	mu      sync.Mutex
+	clients map[whitelistStruct]*cachedProvider
+}
+
+// cachedProvider 客户端的方法不能并发调用，同一条记录的请求依次处理
+type cachedProvider struct {
+	sync.Mutex
+	vc common.GeneralClient
+}
+
+// get services 必须是与 cache 同时取出的配置，否则可能缓存旧密钥构造的客户端
+func (cache *providerCache) get(instance whitelistStruct, services service) (p *cachedProvider, httpStatus int) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if p = cache.clients[instance]; p != nil {
+		return p, http.StatusOK
+	}
+	vc, httpStatus := virtualClient(instance, services)
+	if vc == nil {
+		return nil, httpStatus
+	}
+	if cache.clients == nil {
+		cache.clients = make(map[whitelistStruct]*cachedProvider)
+	}
+	p = &cachedProvider{vc: vc}
+	cache.clients[instance] = p
+	return
+}
+
+func doVirtualClient(body common.CenterReq, instance whitelistStruct, services service, cache *providerCache) (httpStatus int, respBody common.GeneralResp, err error) {
+	p, httpStatus := cache.get(instance, services)
+	if p == nil {
+		return
+	}
+	p.Lock()
+	msg, errs := p.vc.Run(body.Enable, body.IP.IPv4, body.IP.IPv6)
+	p.Unlock()
+
+	observeProviderCall(instance.Service, msg, errs)
+	observeResult(instance, body.IP, msg, errs)
 
+	respBody = common.GeneralResp{}
+	for _, v := range msg {
+		respBody.Message += v + "\n"
+	}
+	for _, v := range errs {
+		respBody.Message += v.Error() + "\n"
+	}
+	return
+}
+
+// virtualClient 按白名单中的解析记录和 services.json 中的密钥构造客户端
+// 服务未启用时返回 403，不支持的服务返回 400
+func virtualClient(instance whitelistStruct, services service) (vc common.GeneralClient, httpStatus int) {
 	switch instance.Service {
 	case common.DNSPod:
-		if !Services.DNSPod.Enable {
-			httpStatus = http.StatusForbidden
-			return
+		if !services.DNSPod.Enable {
+			return nil, http.StatusForbidden
 		}
 
 		// 初始化虚拟客户端
-		dp := client.DNSPod{
-			ID:        Services.DNSPod.ID,
-			Token:     Services.DNSPod.Token,
+		return &client.DNSPod{
+			ID:        services.DNSPod.ID,
+			Token:     services.DNSPod.Token,
+			Endpoint:  services.DNSPod.Endpoint,
 			Domain:    instance.DomainRecord.Domain,
 			SubDomain: instance.DomainRecord.Subdomain,
-		}
-
-		msg, errs = dp.Run(body.Enable, body.IP.IPv4, body.IP.IPv6)
+		}, http.StatusOK
 	case common.AliDNS:
-		if !Services.AliDNS.Enable {
-			httpStatus = http.StatusForbidden
-			return
+		if !services.AliDNS.Enable {
+			return nil, http.StatusForbidden
 		}
 
 		// 初始化虚拟客户端
-		ad := client.AliDNS{
-			AccessKeyId:     Services.AliDNS.AccessKeyId,
-			AccessKeySecret: Services.AliDNS.AccessKeySecret,
+		return &client.AliDNS{
+			AccessKeyId:     services.AliDNS.AccessKeyId,
+			AccessKeySecret: services.AliDNS.AccessKeySecret,
+			Region:          services.AliDNS.Region,
+			Endpoint:        services.AliDNS.Endpoint,
 			Domain:          instance.DomainRecord.Domain,
 			SubDomain:       instance.DomainRecord.Subdomain,
-		}
-
-		msg, errs = ad.Run(body.Enable, body.IP.IPv4, body.IP.IPv6)
+		}, http.StatusOK
 	case common.Cloudflare:
-		if !Services.Cloudflare.Enable {
-			httpStatus = http.StatusForbidden
-			return
+		if !services.Cloudflare.Enable {
+			return nil, http.StatusForbidden
 		}
 
 		// 初始化虚拟客户端
-		cf := client.Cloudflare{
-			ZoneID:   Services.Cloudflare.ZoneID,
-			APIToken: Services.Cloudflare.APIToken,
+		return &client.Cloudflare{
+			ZoneID:   services.Cloudflare.ZoneID,
+			APIToken: services.Cloudflare.APIToken,
+			Endpoint: services.Cloudflare.Endpoint,
 			Domain: common.Subdomain{
 				A:    instance.DomainRecord.Subdomain.A + "." + instance.DomainRecord.Domain,
 				AAAA: instance.DomainRecord.Subdomain.AAAA + "." + instance.DomainRecord.Domain,
 			},
-		}
-
-		msg, errs = cf.Run(body.Enable, body.IP.IPv4, body.IP.IPv6)
+		}, http.StatusOK
 	case common.HuaweiCloud:
-		if !Services.HuaweiCloud.Enable {
-			httpStatus = http.StatusForbidden
-			return
+		if !services.HuaweiCloud.Enable {
+			return nil, http.StatusForbidden
 		}
 
 		// 初始化虚拟客户端
-		hc := client.HuaweiCloud{
-			AccessKeyId:     Services.HuaweiCloud.AccessKeyId,
-			SecretAccessKey: Services.HuaweiCloud.SecretAccessKey,
+		return &client.HuaweiCloud{
+			AccessKeyId:     services.HuaweiCloud.AccessKeyId,
+			SecretAccessKey: services.HuaweiCloud.SecretAccessKey,
+			Region:          services.HuaweiCloud.Region,
+			Endpoint:        services.HuaweiCloud.Endpoint,
+			ProjectId:       services.HuaweiCloud.ProjectId,
 			ZoneName:        instance.DomainRecord.Domain,
 			Domain: common.Subdomain{
 				A:    instance.DomainRecord.Subdomain.A,
 				AAAA: instance.DomainRecord.Subdomain.AAAA,
 			},
+		}, http.StatusOK
+	case common.Volcengine:
+		if !services.Volcengine.Enable {
+			return nil, http.StatusForbidden
+		}
+
+		// 初始化虚拟客户端
+		return &client.Volcengine{
+			AccessKeyId:     services.Volcengine.AccessKeyId,
+			SecretAccessKey: services.Volcengine.SecretAccessKey,
+			Endpoint:        services.Volcengine.Endpoint,
+			Domain:          instance.DomainRecord.Domain,
+			SubDomain:       instance.DomainRecord.Subdomain,
+		}, http.StatusOK
+	case common.BaiduCloud:
+		if !services.BaiduCloud.Enable {
+			return nil, http.StatusForbidden
+		}
+
+		// 初始化虚拟客户端
+		return &client.BaiduCloud{
+			AccessKeyId:     services.BaiduCloud.AccessKeyId,
+			SecretAccessKey: services.BaiduCloud.SecretAccessKey,
+			Endpoint:        services.BaiduCloud.Endpoint,
+			Domain:          instance.DomainRecord.Domain,
+			SubDomain:       instance.DomainRecord.Subdomain,
+		}, http.StatusOK
+	case common.JDCloud:
+		if !services.JDCloud.Enable {
+			return nil, http.StatusForbidden
 		}
 
-		msg, errs = hc.Run(body.Enable, body.IP.IPv4, body.IP.IPv6)
+		// 初始化虚拟客户端
+		return &client.JDCloud{
+			AccessKeyId:     services.JDCloud.AccessKeyId,
+			SecretAccessKey: services.JDCloud.SecretAccessKey,
+			Endpoint:        services.JDCloud.Endpoint,
+			Domain:          instance.DomainRecord.Domain,
+			SubDomain:       instance.DomainRecord.Subdomain,
+		}, http.StatusOK
 	default:
-		httpStatus = http.StatusBadRequest
-		return
+		return nil, http.StatusBadRequest
 	}
 
-	respBody = common.GeneralResp{}
-	for _, v := range msg {
-		respBody.Message += v + "\n"
+}
+
+// observeResult 按一次中心服务请求的结果发送通知并写入历史记录
+func observeResult(instance whitelistStruct, ips common.IPs, msg []string, errs []error) {
+	confMu.RLock()
+	n, h := notifier, history
+	confMu.RUnlock()
+
+	err := errors.Join(errs...)
+	newIP := strings.Trim(ips.IPv4+","+ips.IPv6, ",")
+	n.Observe(common.NotifyResult{
+		Source:   instance.Description,
+		Provider: instance.Service,
+		Record:   instance.DomainRecord.Domain,
+		NewIP:    newIP,
+		Changed:  len(msg) != 0,
+		Err:      err,
+	})
+
+	entry := common.HistoryEntry{
+		Kind:     common.HistoryUpdate,
+		Source:   instance.Description,
+		Provider: instance.Service,
+		Record:   instance.DomainRecord.Domain,
+		NewIP:    newIP,
+		Result:   providerResult(msg, errs),
 	}
-	for _, v := range errs {
-		respBody.Message += v.Error() + "\n"
+	if err != nil {
+		entry.Error = err.Error()
 	}
-	return
+	h.Append(entry)
 }
 
 func httpGet(url string) (*http.Response, error) {
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"ddns-watchdog/internal/common"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const echoTimeout = 2 * time.Second
+
+// ListenEcho 按配置启动 UDP 和 TCP 回显，监听失败时关闭已经启动的回显并返回错误
+// 退出时调用 closeEcho 关闭监听，并等待正在处理的请求完成
+func ListenEcho(conf echo) (closeEcho func(), err error) {
+	var (
+		closers []io.Closer
+		wg      sync.WaitGroup
+	)
+	closeEcho = func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+		wg.Wait()
+	}
+
+	if conf.UDPAddr != "" {
+		var conn net.PacketConn
+		if conn, err = net.ListenPacket("udp", conf.UDPAddr); err != nil {
+			return nil, err
+		}
+		closers = append(closers, conn)
+		slog.Info("开始监听 UDP 回显 (STUN)", "addr", conf.UDPAddr)
+		wg.Go(func() { serveUDPEcho(conn) })
+	}
+
+	if conf.TCPAddr != "" {
+		var l net.Listener
+		if l, err = net.Listen("tcp", conf.TCPAddr); err != nil {
+			closeEcho()
+			return nil, err
+		}
+		closers = append(closers, l)
+		slog.Info("开始监听 TCP 回显", "addr", conf.TCPAddr)
+		wg.Go(func() { serveTCPEcho(l) })
+	}
+	return
+}
+
+// serveUDPEcho 只响应 STUN Binding 请求 (RFC 5389)，其他数据报直接丢弃
+// 对任意数据报回复会被伪造源地址的请求用作反射，两个回显服务也会互相回复不停
+func serveUDPEcho(conn net.PacketConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("UDP 回显停止", "error", err)
+			}
+			return
+		}
+
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		peer := udpAddr.AddrPort()
+
+		if !common.IsSTUNBindingRequest(buf[:n]) {
+			continue
+		}
+		resp := common.STUNBindingResponse(buf[8:common.STUNHeaderLen], peer)
+		if _, err = conn.WriteTo(resp, addr); err != nil {
+			slog.Warn("UDP 回显响应失败", "client_ip", peer.Addr().String(), "error", err)
+		}
+	}
+}
+
+// serveTCPEcho 连接建立后返回对端 IP 文本并关闭，监听关闭后等待已建立的连接处理完再返回
+func serveTCPEcho(l net.Listener) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("TCP 回显停止", "error", err)
+			}
+			return
+		}
+
+		wg.Go(func() {
+			defer conn.Close()
+			tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+			if !ok {
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(echoTimeout))
+			_, _ = conn.Write([]byte(echoText(tcpAddr.AddrPort().Addr())))
+		})
+	}
+}
+
+// echoText 与 HTTP 接口返回的 IP 写法一致
+func echoText(addr netip.Addr) string {
+	return common.ExpandIPv6Zero(addr.Unmap().WithZone("").String()) + "\n"
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"ddns-watchdog/internal/common"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPEcho(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+	go serveUDPEcho(pc)
+
+	conn, err := net.Dial("udp4", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	local := conn.LocalAddr().(*net.UDPAddr).AddrPort()
+
+	// STUN Binding 请求
+	req := make([]byte, common.STUNHeaderLen)
+	binary.BigEndian.PutUint16(req[0:], common.STUNBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], common.STUNMagicCookie)
+	copy(req[8:], "0123456789ab")
+	if _, err = conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := common.STUNBindingResponse(req[8:20], local); string(buf[:n]) != string(want) {
+		t.Errorf("STUN response = %x, want %x", buf[:n], want)
+	}
+
+	// 其他数据报不回复
+	if _, err = conn.Write([]byte("ip?")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err = conn.Read(buf); err == nil {
+		t.Errorf("普通数据报得到了回复 %q", buf[:n])
+	}
+}
+
+func TestTCPEcho(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go serveTCPEcho(l)
+
+	conn, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "127.0.0.1\n" {
+		t.Errorf("echo = %q, want 127.0.0.1", got)
+	}
+}
+
+func TestListenEchoClose(t *testing.T) {
+	busy, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	if _, err = ListenEcho(echo{UDPAddr: "127.0.0.1:0", TCPAddr: busy.Addr().String()}); err == nil {
+		t.Fatal("TCP 地址被占用时应报错")
+	}
+
+	closeEcho, err := ListenEcho(echo{UDPAddr: "127.0.0.1:0", TCPAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		closeEcho()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("关闭回显后没有返回")
+	}
+}
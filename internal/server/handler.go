@@ -4,11 +4,13 @@ import (
 	"ddns-watchdog/internal/common"
 	"encoding/json"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
-func RespGetIPReq(w http.ResponseWriter, req *http.Request) {
+func RespGetIPReq(rw http.ResponseWriter, req *http.Request) {
+	w := &statusWriter{ResponseWriter: rw}
+	defer func() { metricGetIP.Inc(w.code()) }()
 	w.Header().Set("Cache-Control", "no-cache")
 
 	// 判断请求方法
@@ -17,14 +19,17 @@ func RespGetIPReq(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	confMu.RLock()
+	srv := Srv
+	confMu.RUnlock()
 	info := common.GetIPResp{
 		IP:      GetClientIP(req),
-		Version: Srv.GetLatestVersion(),
+		Version: srv.GetLatestVersion(),
 	}
 
 	sendJson, err := json.Marshal(info)
 	if err != nil {
-		log.Println(err)
+		slog.Error("响应获取 IP 请求失败", "client_ip", GetClientIP(req), "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -33,13 +38,16 @@ func RespGetIPReq(w http.ResponseWriter, req *http.Request) {
 
 	_, err = w.Write(sendJson)
 	if err != nil {
-		log.Println(err)
+		slog.Error("响应获取 IP 请求失败", "client_ip", GetClientIP(req), "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
-func RespCenterReq(w http.ResponseWriter, req *http.Request) {
+func RespCenterReq(rw http.ResponseWriter, req *http.Request) {
+	w := &statusWriter{ResponseWriter: rw}
+	description := "unknown"
+	defer func() { metricCenter.Inc(description, w.code()) }()
 	w.Header().Set("Cache-Control", "no-cache")
 
 	// 判断请求方法
@@ -49,45 +57,51 @@ func RespCenterReq(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// 读取并解码 POST 请求
+	clientIP := GetClientIP(req)
 	bodyJson, err := io.ReadAll(req.Body)
 	if err != nil {
-		log.Println(err)
+		slog.Error("读取中心服务请求失败", "client_ip", clientIP, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	var body common.CenterReq
 	if err = json.Unmarshal(bodyJson, &body); err != nil {
-		log.Println(err)
+		slog.Warn("中心服务请求格式错误", "client_ip", clientIP, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	// 鉴权
 	if len(body.Token) > 127 {
+		slog.Warn("中心服务请求鉴权失败", "client_ip", clientIP)
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
-	if v, ok := whitelist[body.Token]; ok {
-		if !v.Enable {
-			w.WriteHeader(http.StatusForbidden)
-			return
-		}
-	} else {
+	// 取出当前配置，处理期间重新加载不影响本次请求
+	confMu.RLock()
+	instance, ok := whitelist[body.Token]
+	services, cache := Services, providers
+	confMu.RUnlock()
+	if !ok || !instance.Enable {
+		// 不输出 token，只能按来源 IP 排查
+		slog.Warn("中心服务请求鉴权失败", "client_ip", clientIP)
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
+	description = instance.Description
+	logger := slog.With("description", description, "client_ip", clientIP, "provider", instance.Service)
 
 	// 模拟客户端
-	httpStatus, respBody, err := doVirtualClient(body, whitelist[body.Token])
+	httpStatus, respBody, err := doVirtualClient(body, instance, services, cache)
 	if err != nil {
 		return
 	}
 
 	if httpStatus != http.StatusOK {
 		if httpStatus == http.StatusInternalServerError {
-			log.Println(err)
+			logger.Error("中心服务请求处理失败", "error", err)
 		}
 		w.WriteHeader(httpStatus)
 		return
@@ -95,7 +109,7 @@ func RespCenterReq(w http.ResponseWriter, req *http.Request) {
 
 	respJson, err := json.Marshal(respBody)
 	if err != nil {
-		log.Println(err)
+		logger.Error("响应中心服务请求失败", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -104,11 +118,11 @@ func RespCenterReq(w http.ResponseWriter, req *http.Request) {
 
 	_, err = w.Write(respJson)
 	if err != nil {
-		log.Println(err)
+		logger.Error("响应中心服务请求失败", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	// 访问成功日志
-	log.Printf("%v(%v) access successfully.\n", whitelist[body.Token].Description, GetClientIP(req))
+	logger.Info("中心服务请求成功", "ipv4", body.IP.IPv4, "ipv6", body.IP.IPv6)
 }
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"ddns-watchdog/internal/common"
+	"errors"
+)
+
+// HistoryFilename 历史记录的默认文件名
+const HistoryFilename = "server_history.jsonl"
+
+var (
+	// history 服务端的历史记录，由 confMu 保护，未启用时为 nil
+	history *common.History
+	// historyConf history 使用的配置
+	historyConf common.HistoryConf
+)
+
+// LoadHistoryPath 只读取配置文件中的 history，配置不完整时也能查询历史记录
+func LoadHistoryPath() (path string, err error) {
+	var srv server
+	if err = common.LoadAndUnmarshal(ConfDir+"/"+ConfFilename, &srv); err != nil {
+		return
+	}
+	return srv.History.Path(ConfDir, HistoryFilename), nil
+}
+
+// SetupHistory 按 Srv.History 打开历史记录
+func SetupHistory() (err error) {
+	confMu.Lock()
+	defer confMu.Unlock()
+	h, err := openHistory(Srv)
+	if err != nil {
+		return
+	}
+	history, historyConf = h, Srv.History
+	return
+}
+
+// openHistory 调用方需持有 confMu，配置没有变化时沿用已经打开的历史记录
+func openHistory(srv server) (h *common.History, err error) {
+	if history != nil && historyConf == srv.History {
+		return history, nil
+	}
+	h, err = common.OpenHistory(srv.History, srv.History.Path(ConfDir, HistoryFilename))
+	if err != nil {
+		return nil, errors.New("服务端配置文件 " + ConfDir + "/" + ConfFilename + " 的 history " + err.Error())
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"ddns-watchdog/internal/common"
+	"net/http"
+	"strconv"
+)
+
+// Metrics 服务端的指标，配置 route 的 metrics 后输出
+var Metrics = &common.Metrics{}
+
+var (
+	metricGetIP = Metrics.Counter("ddns_watchdog_server_get_ip_requests_total",
+		"获取 IP 的请求次数", "code")
+	metricCenter = Metrics.Counter("ddns_watchdog_server_center_requests_total",
+		"中心服务的请求次数，token 不在白名单时 description 为 unknown", "description", "code")
+	metricProviderCalls = Metrics.Counter("ddns_watchdog_server_provider_calls_total",
+		"中心服务调用服务商的次数，result 为 updated, unchanged 或 failed", "provider", "result")
+)
+
+// statusWriter 记录写出的状态码，没有调用 WriteHeader 时为 200
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) code() string {
+	if w.status == 0 {
+		return strconv.Itoa(http.StatusOK)
+	}
+	return strconv.Itoa(w.status)
+}
+
+// observeProviderCall 按服务商返回的结果计数
+func observeProviderCall(provider string, msg []string, errs []error) {
+	metricProviderCalls.Inc(provider, providerResult(msg, errs))
+}
+
+// providerResult 服务商返回的结果，为 updated, unchanged 或 failed
+func providerResult(msg []string, errs []error) string {
+	switch {
+	case len(errs) != 0:
+		return "failed"
+	case len(msg) != 0:
+		return "updated"
+	}
+	return "unchanged"
+}
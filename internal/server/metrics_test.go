@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCenterMetrics(t *testing.T) {
+	oldWhitelist := whitelist
+	t.Cleanup(func() { whitelist = oldWhitelist })
+	whitelist = map[string]whitelistStruct{"disabled-token-0000": {Description: "home"}}
+
+	for _, body := range []string{`{"token":"missing-token-00000"}`, `{"token":"disabled-token-0000"}`} {
+		w := httptest.NewRecorder()
+		RespCenterReq(w, httptest.NewRequest(http.MethodPost, "/center", strings.NewReader(body)))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("code = %d", w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	RespGetIPReq(w, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	out := string(Metrics.Bytes())
+	for _, want := range []string{
+		`ddns_watchdog_server_center_requests_total{description="unknown",code="403"} 2`,
+		`ddns_watchdog_server_get_ip_requests_total{code="405"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %s\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"ddns-watchdog/internal/common"
+	"reflect"
+)
+
+var (
+	// notifier 服务端的通知，由 confMu 保护，未启用时为 nil
+	notifier *common.Notifier
+	// notifyConf notifier 使用的配置
+	notifyConf common.NotifyConf
+)
+
+// SetupNotifier 按 Srv.Notify 设置通知，配置没有变化时保留连续失败次数等状态
+// 通知以 token 备注区分来源
+func SetupNotifier() {
+	confMu.Lock()
+	defer confMu.Unlock()
+	setupNotifier()
+}
+
+// setupNotifier 调用方需持有 confMu
+func setupNotifier() {
+	if notifier != nil && reflect.DeepEqual(notifyConf, Srv.Notify) {
+		return
+	}
+	notifyConf = Srv.Notify
+	notifier = common.NewNotifier(Srv.Notify, "")
+}
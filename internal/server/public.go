@@ -65,6 +65,12 @@ func AddToWhitelist(token, message, service, domain, a, aaaa string) (status str
 			service = common.Cloudflare
 		case common.HuaweiCloud:
 			service = common.HuaweiCloud
+		case common.Volcengine:
+			service = common.Volcengine
+		case common.BaiduCloud:
+			service = common.BaiduCloud
+		case common.JDCloud:
+			service = common.JDCloud
 		default:
 			err = errors.New("不支持的服务供应商")
 			return
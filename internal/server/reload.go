@@ -0,0 +1,69 @@
+package server
+
+import (
+	"ddns-watchdog/internal/common"
+	"log/slog"
+	"sync"
+)
+
+// confMu 保护运行中被重新加载的 Srv、Services、whitelist 和 providers
+var confMu sync.RWMutex
+
+// ConfFiles 服务端会读取的全部配置文件
+func ConfFiles() []string {
+	return []string{
+		ConfDir + "/" + ConfFilename,
+		ConfDir + "/" + ServiceConfFilename,
+		ConfDir + "/" + WhitelistFilename,
+	}
+}
+
+// Reload 重新读取 server.json、services.json 和 whitelist.json，全部读取成功后才替换正在使用的配置
+// 监听地址、TLS、路由和回显在启动时已经生效，修改后需要重启
+func Reload() (err error) {
+	var srv server
+	if err = srv.LoadConf(); err != nil {
+		return
+	}
+
+	confMu.RLock()
+	running := Srv
+	confMu.RUnlock()
+
+	var (
+		svc service
+		wl  map[string]whitelistStruct
+	)
+	if running.CenterService {
+		if err = common.LoadAndUnmarshal(ConfDir+"/"+ServiceConfFilename, &svc); err != nil {
+			return
+		}
+		if err = common.LoadAndUnmarshal(ConfDir+"/"+WhitelistFilename, &wl); err != nil {
+			return
+		}
+	}
+
+	if srv.ServerAddr != running.ServerAddr || srv.TLS != running.TLS || srv.Route != running.Route ||
+		srv.Echo != running.Echo || srv.CenterService != running.CenterService {
+		slog.Warn("server_addr, tls, route, echo, center_service 的修改需要重启才能生效")
+	}
+
+	confMu.Lock()
+	defer confMu.Unlock()
+	h, err := openHistory(srv)
+	if err != nil {
+		return
+	}
+	history, historyConf = h, srv.History
+	Srv = srv
+	// 保留启动时的设置，使其与实际监听的一致
+	Srv.ServerAddr, Srv.TLS, Srv.Route, Srv.Echo, Srv.CenterService =
+		running.ServerAddr, running.TLS, running.Route, running.Echo, running.CenterService
+	if running.CenterService {
+		Services, whitelist = svc, wl
+		// 密钥或 endpoint 可能已经修改，丢弃按旧配置构造的客户端
+		providers = &providerCache{}
+	}
+	setupNotifier()
+	return
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"ddns-watchdog/internal/common"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	dir, oldDir, oldSrv, oldServices, oldWhitelist, oldProviders := t.TempDir(), ConfDir, Srv, Services, whitelist, providers
+	ConfDir = dir
+	t.Cleanup(func() {
+		ConfDir, Srv, Services, whitelist, providers = oldDir, oldSrv, oldServices, oldWhitelist, oldProviders
+	})
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Srv = server{ServerAddr: ":10032", CenterService: true}
+	whitelist = map[string]whitelistStruct{"old-token": {Enable: true}}
+
+	write(ConfFilename, `{"server_addr":":8080","center_service":true,"root_server_url":"https://example.com"}`)
+	write(ServiceConfFilename, `{"dnspod":{"enable":true}}`)
+	write(WhitelistFilename, `{"new-token":`)
+	if err := Reload(); err == nil {
+		t.Fatal("白名单格式错误时应报错")
+	}
+	if _, ok := whitelist["old-token"]; !ok || Srv.RootServerUrl != "" {
+		t.Errorf("读取失败后配置被替换了")
+	}
+
+	var svc service
+	svc.DNSPod.Enable = true
+	instance := whitelistStruct{Enable: true, Service: common.DNSPod,
+		DomainRecord: domainRecord{Domain: "example.com", Subdomain: common.Subdomain{A: "www"}}}
+	cached, _ := providers.get(instance, svc)
+	if p, _ := providers.get(instance, svc); cached == nil || p != cached {
+		t.Fatalf("同一份配置下没有复用客户端")
+	}
+
+	write(WhitelistFilename, `{"new-token":{"enable":true}}`)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := whitelist["new-token"]; !ok || !Services.DNSPod.Enable || Srv.RootServerUrl != "https://example.com" {
+		t.Errorf("新配置没有生效")
+	}
+	if p, _ := providers.get(instance, Services); p == nil || p == cached {
+		t.Errorf("重新加载后仍在使用旧的客户端")
+	}
+	// 监听地址需要重启才能修改
+	if Srv.ServerAddr != ":10032" {
+		t.Errorf("ServerAddr = %q, want :10032", Srv.ServerAddr)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"ddns-watchdog/internal/common"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -10,12 +11,24 @@ import (
 const ConfFilename = "server.json"
 
 type server struct {
-	ServerAddr    string `json:"server_addr"`
-	IsRootServer  bool   `json:"is_root_server"`
-	RootServerUrl string `json:"root_server_url"`
-	CenterService bool   `json:"center_service"`
-	Route         route  `json:"route"`
-	TLS           tls    `json:"tls"`
+	ServerAddr    string             `json:"server_addr"`
+	IsRootServer  bool               `json:"is_root_server"`
+	RootServerUrl string             `json:"root_server_url"`
+	CenterService bool               `json:"center_service"`
+	Route         route              `json:"route"`
+	TLS           tls                `json:"tls"`
+	Echo          echo               `json:"echo"`
+	WatchConf     bool               `json:"watch_conf"`
+	Log           common.LogConf     `json:"log"`
+	Notify        common.NotifyConf  `json:"notify"`
+	History       common.HistoryConf `json:"history"`
+}
+
+// echo udp_addr 只响应 STUN Binding 请求，其他数据报直接丢弃，tcp_addr 连接后返回对端 IP，为空时不监听
+type echo struct {
+	Enable  bool   `json:"enable"`
+	UDPAddr string `json:"udp_addr"`
+	TCPAddr string `json:"tcp_addr"`
 }
 
 type tls struct {
@@ -24,9 +37,11 @@ type tls struct {
 	KeyFile  string `json:"key_file"`
 }
 
+// route metrics 为空时不提供 Prometheus 指标
 type route struct {
-	GetIP  string `json:"get_ip"`
-	Center string `json:"center"`
+	GetIP   string `json:"get_ip"`
+	Center  string `json:"center"`
+	Metrics string `json:"metrics"`
 }
 
 func (conf *server) InitConf() (msg string, err error) {
@@ -37,6 +52,9 @@ func (conf *server) InitConf() (msg string, err error) {
 			GetIP:  "/",
 			Center: "/center",
 		},
+		Echo: echo{
+			UDPAddr: ":3478",
+		},
 	}
 	if err = common.MarshalAndSave(conf, ConfDir+"/"+ConfFilename); err != nil {
 		return
@@ -46,7 +64,20 @@ func (conf *server) InitConf() (msg string, err error) {
 }
 
 func (conf *server) LoadConf() (err error) {
-	return common.LoadAndUnmarshal(ConfDir+"/"+ConfFilename, &conf)
+	if err = common.LoadAndUnmarshal(ConfDir+"/"+ConfFilename, &conf); err != nil {
+		return
+	}
+	return conf.check()
+}
+
+func (conf *server) check() (err error) {
+	if err = conf.Log.Check(); err != nil {
+		return errors.New("服务端配置文件 " + ConfDir + "/" + ConfFilename + " 的 log " + err.Error())
+	}
+	if err = conf.Notify.Check(); err != nil {
+		return errors.New("服务端配置文件 " + ConfDir + "/" + ConfFilename + " 的 notify " + err.Error())
+	}
+	return
 }
 
 func (conf *server) GetLatestVersion() (str string) {
@@ -11,30 +11,61 @@ type service struct {
 	AliDNS      alidns      `json:"alidns"`
 	Cloudflare  cloudflare  `json:"cloudflare"`
 	HuaweiCloud huaweiCloud `json:"huawei_cloud"`
+	Volcengine  volcengine  `json:"volcengine"`
+	BaiduCloud  baiduCloud  `json:"baidu_cloud"`
+	JDCloud     jdCloud     `json:"jd_cloud"`
 }
 
 type dnspod struct {
-	Enable bool   `json:"enable"`
-	ID     string `json:"id"`
-	Token  string `json:"token"`
+	Enable   bool   `json:"enable"`
+	ID       string `json:"id"`
+	Token    string `json:"token"`
+	Endpoint string `json:"endpoint"`
 }
 
 type alidns struct {
 	Enable          bool   `json:"enable"`
 	AccessKeyId     string `json:"access_key_id"`
 	AccessKeySecret string `json:"access_key_secret"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
 }
 
 type cloudflare struct {
 	Enable   bool   `json:"enable"`
 	ZoneID   string `json:"zone_id"`
 	APIToken string `json:"api_token"`
+	Endpoint string `json:"endpoint"`
 }
 
 type huaweiCloud struct {
 	Enable          bool   `json:"enable"`
 	AccessKeyId     string `json:"access_key_id"`
 	SecretAccessKey string `json:"secret_access_key"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+	ProjectId       string `json:"project_id"`
+}
+
+type volcengine struct {
+	Enable          bool   `json:"enable"`
+	AccessKeyId     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	Endpoint        string `json:"endpoint"`
+}
+
+type baiduCloud struct {
+	Enable          bool   `json:"enable"`
+	AccessKeyId     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	Endpoint        string `json:"endpoint"`
+}
+
+type jdCloud struct {
+	Enable          bool   `json:"enable"`
+	AccessKeyId     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	Endpoint        string `json:"endpoint"`
 }
 
 func (conf *service) InitConf() (msg string, err error) {
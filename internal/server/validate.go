@@ -0,0 +1,172 @@
+package server
+
+import (
+	"ddns-watchdog/internal/client"
+	"ddns-watchdog/internal/common"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Validate 校验 ConfDir 中的服务端配置，启用 center_service 时同时校验 services.json 和 whitelist.json
+// online 时用白名单中每条记录对应的密钥查询一条解析记录
+func Validate(online bool) (r *common.ConfReport) {
+	r = &common.ConfReport{}
+	r.File(ConfFilename)
+	var srv server
+	if err := common.LoadAndUnmarshal(ConfDir+"/"+ConfFilename, &srv); err != nil {
+		r.Add("", "无法读取 "+err.Error())
+		return
+	}
+	r.AddError("", srv.check())
+	srv.validate(r)
+	if !srv.CenterService {
+		return
+	}
+
+	r.File(ServiceConfFilename)
+	var svc service
+	if err := common.LoadAndUnmarshal(ConfDir+"/"+ServiceConfFilename, &svc); err != nil {
+		r.Add("", "无法读取 "+err.Error())
+		return
+	}
+	svc.validate(r)
+
+	r.File(WhitelistFilename)
+	var wl map[string]whitelistStruct
+	if err := common.LoadAndUnmarshal(ConfDir+"/"+WhitelistFilename, &wl); err != nil {
+		r.Add("", "无法读取 "+err.Error())
+		return
+	}
+	for _, token := range slices.Sorted(maps.Keys(wl)) {
+		instance := wl[token]
+		if !instance.Enable {
+			continue
+		}
+		// 字段名中不输出完整的 token
+		field := instance.Description
+		if field == "" {
+			field = token[:min(len(token), 4)] + "******"
+		}
+		n := len(r.Issues)
+		instance.validate(r, field, svc)
+		// 格式有误时请求服务商没有意义
+		if !online || len(r.Issues) != n {
+			continue
+		}
+		vc, _ := virtualClient(instance, svc)
+		data, _ := json.Marshal(vc)
+		if _, err := client.TestCredential(instance.Service, data); err != nil {
+			r.Add(field, "测试密钥失败 "+common.RedactError(err).Error())
+		}
+	}
+	return
+}
+
+// validate 检查 check 之外的地址格式和占位内容
+func (conf *server) validate(r *common.ConfReport) {
+	r.Placeholders("", conf)
+	if conf.ServerAddr == "" {
+		r.Add("server_addr", "不能为空")
+	}
+	r.HostPort("server_addr", conf.ServerAddr)
+	if !conf.IsRootServer {
+		r.URL("root_server_url", conf.RootServerUrl)
+	}
+	for field, path := range map[string]string{"route.get_ip": conf.Route.GetIP, "route.center": conf.Route.Center,
+		"route.metrics": conf.Route.Metrics} {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			r.Add(field, path+" 需要以 \"/\" 开头")
+		}
+	}
+	if conf.TLS.Enable {
+		for field, file := range map[string]string{"tls.cert_file": conf.TLS.CertFile, "tls.key_file": conf.TLS.KeyFile} {
+			if file == "" {
+				r.Add(field, "启用 tls 时不能为空")
+			} else if _, err := os.Stat(file); err != nil {
+				r.Add(field, err.Error())
+			}
+		}
+	}
+	if conf.Echo.Enable {
+		r.HostPort("echo.udp_addr", conf.Echo.UDPAddr)
+		r.HostPort("echo.tcp_addr", conf.Echo.TCPAddr)
+	}
+}
+
+// validate 检查已启用服务的密钥和 endpoint
+func (conf *service) validate(r *common.ConfReport) {
+	for _, s := range []struct {
+		name     string
+		enable   bool
+		conf     any
+		keys     map[string]string
+		endpoint string
+	}{
+		{"dnspod", conf.DNSPod.Enable, conf.DNSPod,
+			map[string]string{"id": conf.DNSPod.ID, "token": conf.DNSPod.Token}, conf.DNSPod.Endpoint},
+		{"alidns", conf.AliDNS.Enable, conf.AliDNS,
+			map[string]string{"access_key_id": conf.AliDNS.AccessKeyId, "access_key_secret": conf.AliDNS.AccessKeySecret},
+			common.EndpointURL(conf.AliDNS.Endpoint)},
+		{"cloudflare", conf.Cloudflare.Enable, conf.Cloudflare,
+			map[string]string{"zone_id": conf.Cloudflare.ZoneID, "api_token": conf.Cloudflare.APIToken}, conf.Cloudflare.Endpoint},
+		{"huawei_cloud", conf.HuaweiCloud.Enable, conf.HuaweiCloud,
+			map[string]string{"access_key_id": conf.HuaweiCloud.AccessKeyId, "secret_access_key": conf.HuaweiCloud.SecretAccessKey},
+			common.EndpointURL(conf.HuaweiCloud.Endpoint)},
+		{"volcengine", conf.Volcengine.Enable, conf.Volcengine,
+			map[string]string{"access_key_id": conf.Volcengine.AccessKeyId, "secret_access_key": conf.Volcengine.SecretAccessKey},
+			conf.Volcengine.Endpoint},
+		{"baidu_cloud", conf.BaiduCloud.Enable, conf.BaiduCloud,
+			map[string]string{"access_key_id": conf.BaiduCloud.AccessKeyId, "secret_access_key": conf.BaiduCloud.SecretAccessKey},
+			conf.BaiduCloud.Endpoint},
+		{"jd_cloud", conf.JDCloud.Enable, conf.JDCloud,
+			map[string]string{"access_key_id": conf.JDCloud.AccessKeyId, "secret_access_key": conf.JDCloud.SecretAccessKey},
+			conf.JDCloud.Endpoint},
+	} {
+		if !s.enable {
+			continue
+		}
+		r.Placeholders(s.name, s.conf)
+		for _, k := range slices.Sorted(maps.Keys(s.keys)) {
+			if s.keys[k] == "" {
+				r.Add(s.name+"."+k, "启用 "+s.name+" 时不能为空")
+			}
+		}
+		r.URL(s.name+".endpoint", s.endpoint)
+	}
+}
+
+// validate 按服务商的约定检查白名单中的域名和解析记录，field 为这条记录在输出中的名称
+// HuaweiCloud 的 domain 为 Zone 名称，subdomain 为以 "." 结尾的完整域名，其他服务商的 subdomain 为主机记录
+func (instance whitelistStruct) validate(r *common.ConfReport, field string, services service) {
+	if _, httpStatus := virtualClient(instance, services); httpStatus == http.StatusBadRequest {
+		r.Add(field+".service", "不支持的服务 "+instance.Service)
+		return
+	} else if httpStatus == http.StatusForbidden {
+		r.Add(field+".service", ServiceConfFilename+" 没有启用 "+instance.Service)
+	}
+
+	record := instance.DomainRecord
+	r.Placeholders(field+".domain_record", record)
+	huawei := instance.Service == common.HuaweiCloud
+	r.AddError(field+".domain_record.domain", common.CheckDomain(record.Domain, huawei))
+	if record.Subdomain.A == "" && record.Subdomain.AAAA == "" {
+		r.Add(field+".domain_record.subdomain", "a 和 aaaa 不能都为空")
+	}
+	for _, sub := range []struct{ field, name string }{{"a", record.Subdomain.A}, {"aaaa", record.Subdomain.AAAA}} {
+		if sub.name == "" {
+			continue
+		}
+		subField := field + ".domain_record.subdomain." + sub.field
+		if !huawei {
+			r.AddError(subField, common.CheckSubdomain(sub.name, record.Domain))
+		} else if err := common.CheckDomain(sub.name, true); err != nil {
+			r.AddError(subField, err)
+		} else {
+			r.AddError(subField, common.CheckInZone(sub.name, record.Domain))
+		}
+	}
+}